@@ -176,8 +176,8 @@ type AvgSparse struct {
 }
 
 func (v *AvgSparse) Value(transition int, feature interface{}) int64 {
-	transitions, exists := v.Vals[feature]
-	if exists && transition < transitions.Len() {
+	// GetValue is bounded; the Len of a map store isn't its largest transition
+	if transitions, exists := v.Vals[feature]; exists {
 		if histValue := transitions.GetValue(transition); histValue != nil {
 			return histValue.Value
 		}
@@ -4,56 +4,77 @@ import "testing"
 
 func TestHistoryValue(t *testing.T) {
 	var h *HistoryValue
-	// test average of single occurence (integration of 1)
-	h = NewHistoryValue(0, 1.0)
+	// test the integrated value of a single occurence (integration of 1)
+	h = NewHistoryValue(0, 1)
 	h.Integrate(1)
-	if h.Value != 1.0 {
-		t.Errorf("Expected 1.0 average, got %v", h.Value)
+	if h.Value != 1 {
+		t.Errorf("Expected 1 integrated, got %v", h.Value)
 	}
 
 	// should be 0
-	h = NewHistoryValue(0, 0.0)
+	h = NewHistoryValue(0, 0)
 	// value of 4, generation 2
-	h.Increment(2)
-	h.Increment(2)
-	h.Increment(2)
-	h.Increment(2)
-	// value of 4 remains, integrate generation 4
-	// should be average of 2
+	h.Add(2, 1)
+	h.Add(2, 1)
+	h.Add(2, 1)
+	h.Add(2, 1)
+	// value of 4 remains, integrate generation 2
+	// the value was 0 until generation 2
 	h.Integrate(2)
-	// test average of two values same number of occurences
-	if h.Value != 0.0 {
-		t.Errorf("Expected 0.0 average, got %v", h.Value)
+	if h.Value != 0 {
+		t.Errorf("Expected 0 integrated, got %v", h.Value)
 	}
 
-	// test average of same value multiple occurences
-	h = NewHistoryValue(0, 0.0)
+	// test integration of same value multiple occurences
+	h = NewHistoryValue(0, 0)
 	// value of 4, generation 2
-	h.Increment(2)
-	h.Increment(2)
-	h.Increment(2)
-	h.Increment(2)
+	h.Add(2, 1)
+	h.Add(2, 1)
+	h.Add(2, 1)
+	h.Add(2, 1)
 	// value of 4 remains, integrate generation 4
-	// should be average of 2
+	// should be 8, an average of 2
 	h.Integrate(4)
-	// test average of two values same number of occurences
-	if h.Value != 2.0 {
-		t.Errorf("Expected 2.0 average, got %v", h.Value)
+	if h.Value != 8 {
+		t.Errorf("Expected 8 integrated, got %v", h.Value)
 	}
 
-	// test average with ratio occurence:
-	// [0 x4, 20 x2, 40 x2] = 15
-	h = NewHistoryValue(0, 0.0)
-	h.Increment(4)
+	// test integration with ratio occurence:
+	// [0 x4, 20 x2, 40 x2] = 120, an average of 15
+	h = NewHistoryValue(0, 0)
+	h.Add(4, 0)
 	// shortcut to set value
-	h.Value = 20.0
-	h.Increment(6)
-	h.Value = 40.0
+	h.Value = 20
+	h.Add(6, 0)
+	h.Value = 40
 	h.Integrate(8)
 
-	if h.Value != 15.0 {
-		t.Errorf("Expected 15.0 average, got %v", h.Value)
+	if h.Value != 120 {
+		t.Errorf("Expected 120 integrated, got %v", h.Value)
 	}
 
 	// test various
 }
+
+func TestAvgSparseValue(t *testing.T) {
+	v := &AvgSparse{}
+	// g weighs 2 transitions, one past their count
+	v.Deserialize(map[interface{}]map[int]int64{"f": {0: 3, 1: -2}, "g": {1: 5, 7: 1}}, 0)
+	scores := &ArrayStore{}
+	scores.Init()
+	transitions := []int{0, 1, 2, 7, 8}
+	scores.SetTransitions(transitions)
+	for _, feature := range []string{"f", "g", "h"} {
+		scores.Clear()
+		v.SetScores(feature, scores, false)
+		for _, transition := range transitions {
+			expected, _ := scores.Get(transition)
+			if value := v.Value(transition, feature); value != expected {
+				t.Errorf("Expected %s transition %d to weigh %d as its scores do, got %d", feature, transition, expected, value)
+			}
+		}
+	}
+	if value := v.Value(7, "g"); value != 1 {
+		t.Errorf("Expected g transition 7 to weigh 1, got %d", value)
+	}
+}
@@ -42,6 +42,9 @@ type ScoredStore interface {
 	Set(transition int, score int64)
 	SetTransitions(transitions []int)
 	IncAll(store TransitionScoreStore, integrated bool)
+	// IncSorted increments the stored transitions by the scores of parallel
+	// slices sorted by transition
+	IncSorted(transitions []int32, scores []int64)
 	Inc(transition int, score int64)
 	Len() int
 	Clear()
@@ -61,7 +64,7 @@ func (s *ArrayStore) Get(transition int) (int64, bool) {
 	return 0, false
 }
 func (s *ArrayStore) Set(transition int, score int64) {
-	if len(s.DataArray) < transition {
+	if transition < len(s.DataArray) {
 		s.DataArray[transition] = score
 	}
 }
@@ -91,8 +94,17 @@ func (s *ArrayStore) IncAll(store TransitionScoreStore, integrated bool) {
 	}
 }
 
+func (s *ArrayStore) IncSorted(transitions []int32, scores []int64) {
+	for i, transition := range transitions {
+		if int(transition) >= len(s.DataArray) {
+			return
+		}
+		s.DataArray[transition] += scores[i]
+	}
+}
+
 func (s *ArrayStore) Inc(transition int, score int64) {
-	if len(s.DataArray) < transition {
+	if transition < len(s.DataArray) {
 		s.DataArray[transition] += score
 	}
 }
@@ -175,6 +187,25 @@ func (s *MapStore) Inc(transition int, score int64) {
 	// }
 }
 
+func (s *MapStore) IncSorted(transitions []int32, scores []int64) {
+	for i, transition := range s.transitions {
+		// binary search, the stored transitions are few and sort.Search
+		// costs a closure call per probe
+		lo, hi := 0, len(transitions)
+		for lo < hi {
+			mid := int(uint(lo+hi) >> 1)
+			if int(transitions[mid]) < transition {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		if lo < len(transitions) && int(transitions[lo]) == transition {
+			s.scores[i] += scores[lo]
+		}
+	}
+}
+
 func (s *MapStore) IncAll(store TransitionScoreStore, integrated bool) {
 	var val *HistoryValue
 	for i, transition := range s.transitions {
@@ -256,6 +287,11 @@ func (s *HybridStore) IncAll(store TransitionScoreStore, integrated bool) {
 	s.ArrayStore.IncAll(store, integrated)
 	s.MapStore.IncAll(store, integrated)
 }
+func (s *HybridStore) IncSorted(transitions []int32, scores []int64) {
+	s.ArrayStore.IncSorted(transitions, scores)
+	s.MapStore.IncSorted(transitions, scores)
+}
+
 func (s *HybridStore) Len() int {
 	return s.ArrayStore.Len() + s.MapStore.Len()
 }
@@ -0,0 +1,62 @@
+package featurevector
+
+import "testing"
+
+func TestArrayStoreBounds(t *testing.T) {
+	s := &ArrayStore{}
+	s.Init()
+	s.SetTransitions([]int{0, 2})
+	s.Set(2, 5)
+	s.Inc(2, 1)
+	s.Inc(0, -1)
+	// out of range transitions are ignored
+	s.Set(3, 7)
+	s.Inc(3, 7)
+	s.Inc(10, 7)
+	if s.Len() != 3 {
+		t.Errorf("Expected 3 slots, got %d", s.Len())
+	}
+	for transition, expected := range []int64{-1, 0, 6} {
+		if score, _ := s.Get(transition); score != expected {
+			t.Errorf("Transition %d: expected %d, got %d", transition, expected, score)
+		}
+	}
+	if _, exists := s.Get(3); exists {
+		t.Errorf("Expected no transition 3")
+	}
+}
+
+func TestIncSorted(t *testing.T) {
+	transitions, scores := []int32{0, 2, 3, 5, 9}, []int64{1, 2, 3, 4, 5}
+
+	array := &ArrayStore{}
+	array.Init()
+	array.SetTransitions([]int{0, 1, 2, 3})
+	array.IncSorted(transitions, scores)
+	for transition, expected := range []int64{1, 0, 2, 3} {
+		if score, _ := array.Get(transition); score != expected {
+			t.Errorf("ArrayStore transition %d: expected %d, got %d", transition, expected, score)
+		}
+	}
+
+	mapStore := &MapStore{}
+	mapStore.Init()
+	mapStore.SetTransitions([]int{9, 1, 3})
+	mapStore.IncSorted(transitions, scores)
+	for transition, expected := range map[int]int64{9: 5, 1: 0, 3: 3} {
+		if score, _ := mapStore.Get(transition); score != expected {
+			t.Errorf("MapStore transition %d: expected %d, got %d", transition, expected, score)
+		}
+	}
+
+	hybrid := &HybridStore{cutoff: 4}
+	hybrid.Init()
+	hybrid.SetTransitions([]int{0, 2, 5, 7})
+	hybrid.IncSorted(transitions, scores)
+	hybrid.IncSorted(transitions[1:2], scores[1:2])
+	for transition, expected := range map[int]int64{0: 1, 1: 0, 2: 4, 5: 4, 7: 0} {
+		if score, _ := hybrid.Get(transition); score != expected {
+			t.Errorf("HybridStore transition %d: expected %d, got %d", transition, expected, score)
+		}
+	}
+}
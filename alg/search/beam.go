@@ -2,6 +2,7 @@ package search
 
 import (
 	"container/heap"
+	"context"
 	"fmt"
 	"log"
 	"strings"
@@ -30,10 +31,6 @@ type Beam struct {
 
 	Size                 int
 	EstimatedTransitions int
-	EarlyUpdateAt        int
-
-	// beam parsing variables
-	currentBeamSize int
 
 	// flags
 	Averaged           bool
@@ -47,21 +44,56 @@ type Beam struct {
 	NoRecover          bool
 	Align              bool
 
-	// used for performance tuning
-	lastRoundStart time.Time
-	DurTotal       time.Duration
+	// what ParseContext does when its context is done
+	Expiry Expiry
 
 	// used for debug output
 	Transitions *util.EnumSet
 
-	candidateScorePool    *sync.Pool
 	IntegrationGeneration int
 	ScoredStoreDense      bool
 }
 
-var _ Interface = &Beam{}
+// beamSearch is the state of a single search with a Beam. The Beam, its
+// model and base configuration are only read while searching, so a parsing
+// Beam serves any number of concurrent searches.
+type beamSearch struct {
+	*Beam
+
+	earlyUpdateAt int
+
+	// panics raised while expanding candidates in worker goroutines
+	expandPanic CapturedPanic
+}
+
+// score stores are reused by the searches of all beams
+var (
+	denseStores = &sync.Pool{New: featurevector.MakeDenseStore}
+	mapStores   = &sync.Pool{New: featurevector.MakeMapStore}
+)
+
+var _ Interface = &beamSearch{}
+var _ KBest = &Beam{}
 var _ perceptron.EarlyUpdateInstanceDecoder = &Beam{}
 
+func (b *Beam) newSearch() *beamSearch {
+	return &beamSearch{Beam: b, earlyUpdateAt: -1}
+}
+
+func (b *Beam) scoreStores() *sync.Pool {
+	if b.ScoredStoreDense {
+		return denseStores
+	}
+	return mapStores
+}
+
+func (b *Beam) estimatedTransitions() int {
+	if b.EstimatedTransitions == 0 {
+		return b.Size
+	}
+	return b.EstimatedTransitions
+}
+
 func (b *Beam) Name() string {
 	notAligned := ""
 	if !b.Align {
@@ -78,7 +110,7 @@ func (b *Beam) Concurrent() bool {
 	return b.ConcurrentExec
 }
 
-func (b *Beam) StartItem(p Problem) []Candidate {
+func (b *beamSearch) StartItem(p Problem) []Candidate {
 	if b.Base == nil {
 		panic("Set Base to a transition.Configuration to parse")
 	}
@@ -88,22 +120,10 @@ func (b *Beam) StartItem(p Problem) []Candidate {
 	if b.Model == nil {
 		panic("Set a Model")
 	}
-	if b.EstimatedTransitions == 0 {
-		b.EstimatedTransitions = b.Size
-	}
-
 	c := b.Base.Copy()
 	c.Clear()
 	c.Init(p)
 
-	if b.candidateScorePool == nil {
-		if b.ScoredStoreDense {
-			b.candidateScorePool = &sync.Pool{New: featurevector.MakeDenseStore}
-		} else {
-			b.candidateScorePool = &sync.Pool{New: featurevector.MakeMapStore}
-		}
-	}
-	b.currentBeamSize = 0
 	firstCandidates := make([]Candidate, 1)
 	firstCandidate := &ScoredConfiguration{c, transition.ConstTransition(0), NewScoreState(), nil, 0, 0, true, b.Averaged}
 	firstCandidates[0] = firstCandidate
@@ -126,12 +146,12 @@ func (b *Beam) Clear(agenda Agenda) Agenda {
 	return agenda
 }
 
-func (b *Beam) Insert(cs chan Candidate, a Agenda) []Candidate { //Agenda {
+func (b *beamSearch) Insert(cs chan Candidate, a Agenda) []Candidate { //Agenda {
 	var tempAgendaSize int
 	if b.ShortTempAgenda {
 		tempAgendaSize = b.Size
 	} else {
-		tempAgendaSize = b.EstimatedTransitions
+		tempAgendaSize = b.estimatedTransitions()
 	}
 	tempAgenda := NewAgenda(tempAgendaSize)
 	tempAgendaHeap := heap.Interface(tempAgenda)
@@ -161,6 +181,7 @@ func (b *Beam) Insert(cs chan Candidate, a Agenda) []Candidate { //Agenda {
 		// heap.Push(tempAgendaHeap, currentScoredConf)
 		// heaping += time.Since(lastMem)
 	}
+	b.expandPanic.Repanic()
 	// lastMem = time.Now()
 	// agenda := a.(*BaseAgenda)
 	// agenda.Lock()
@@ -180,7 +201,7 @@ func (b *Beam) Insert(cs chan Candidate, a Agenda) []Candidate { //Agenda {
 	return retval
 }
 
-func (b *Beam) Expand(c Candidate, p Problem, candidateNum int) chan Candidate {
+func (b *beamSearch) Expand(c Candidate, p Problem, candidateNum int) chan Candidate {
 	var (
 		lastMem          time.Time
 		featuring        time.Duration
@@ -191,9 +212,11 @@ func (b *Beam) Expand(c Candidate, p Problem, candidateNum int) chan Candidate {
 	candidate := c.(*ScoredConfiguration)
 	conf := candidate.C
 	lastMem = time.Now()
-	retChan := make(chan Candidate, b.EstimatedTransitions)
+	retChan := make(chan Candidate, b.estimatedTransitions())
 	// scores := make([]int64, 0, b.EstimatedTransitions)
 	go func(currentConf transition.Configuration, candidateChan chan Candidate) {
+		defer close(candidateChan)
+		defer b.expandPanic.Capture()
 		var (
 			transNum int
 			score    int64
@@ -205,7 +228,7 @@ func (b *Beam) Expand(c Candidate, p Problem, candidateNum int) chan Candidate {
 			transType   byte
 			transitions []int
 		)
-		scores = b.candidateScorePool.Get().(featurevector.ScoredStore)
+		scores = b.scoreStores().Get().(featurevector.ScoredStore)
 		// scores.Init()
 		scores.Clear()
 		transType, transitions = b.TransFunc.GetTransitions(currentConf)
@@ -213,7 +236,7 @@ func (b *Beam) Expand(c Candidate, p Problem, candidateNum int) chan Candidate {
 			// log.Println("\tSetting transitions to", transitions)
 		}
 		scores.SetTransitions(transitions)
-		scorer := b.Model.(*TransitionModel.AvgMatrixSparse)
+		scorer := b.Model.(TransitionModel.Scorer)
 		if b.DecodeTest {
 			if b.ScoredStoreDense {
 
@@ -228,7 +251,9 @@ func (b *Beam) Expand(c Candidate, p Problem, candidateNum int) chan Candidate {
 			log.Println("Features")
 		}
 		feats := b.FeatExtractor.Features(conf, false, transType, transitions)
-		b.FeatExtractor.SetLog(false)
+		if ShowFeats {
+			b.FeatExtractor.SetLog(false)
+		}
 		featuring += time.Since(lastMem)
 
 		var newFeatList *transition.FeaturesList
@@ -276,8 +301,7 @@ func (b *Beam) Expand(c Candidate, p Problem, candidateNum int) chan Candidate {
 			}
 			candidateChan <- c
 		}
-		b.candidateScorePool.Put(scores)
-		close(candidateChan)
+		b.scoreStores().Put(scores)
 	}(conf, retChan)
 	// b.DurExpanding += time.Since(start)
 	return retChan
@@ -369,8 +393,23 @@ func (b *Beam) Top(a Agenda) Candidate {
 	return bestCandidate
 }
 
-func (b *Beam) SetEarlyUpdate(i int) {
-	b.EarlyUpdateAt = i
+// KBest returns copies of up to k candidates of an agenda sorted by Best,
+// best first
+func (b *Beam) KBest(a Agenda, k int) []Candidate {
+	agenda := a.(*BaseAgenda)
+	if k > agenda.Len() {
+		k = agenda.Len()
+	}
+	candidates := make([]Candidate, k)
+	for i, candidate := range agenda.Confs[:k] {
+		candidate.Expand(b.TransFunc)
+		candidates[i] = candidate.Copy()
+	}
+	return candidates
+}
+
+func (b *beamSearch) SetEarlyUpdate(i int) {
+	b.earlyUpdateAt = i
 }
 
 func (b *Beam) GoalTest(p Problem, c Candidate, rounds int) bool {
@@ -383,7 +422,7 @@ func (b *Beam) GoalTest(p Problem, c Candidate, rounds int) bool {
 	}
 }
 
-func (b *Beam) TopB(a Agenda, B int) ([]Candidate, bool) {
+func (b *beamSearch) TopB(a Agenda, B int) ([]Candidate, bool) {
 	// start := time.Now()
 	agenda := a.(*BaseAgenda).Confs
 	candidates := make([]Candidate, len(agenda))
@@ -410,6 +449,7 @@ func (b *Beam) TopB(a Agenda, B int) ([]Candidate, bool) {
 		wg.Add(1)
 		go func(c Candidate) {
 			defer wg.Done()
+			defer b.expandPanic.Capture()
 			c.(*ScoredConfiguration).Expand(b.TransFunc)
 		}(candidate)
 		if !b.Concurrent() {
@@ -417,16 +457,28 @@ func (b *Beam) TopB(a Agenda, B int) ([]Candidate, bool) {
 		}
 	}
 	wg.Wait()
+	b.expandPanic.Repanic()
 	// b.DurTopB += time.Since(start)
 	return candidates, allTerminal
 }
 
+// Parse may be called concurrently, every call searches with its own state
 func (b *Beam) Parse(problem Problem) (transition.Configuration, interface{}) {
-	start := time.Now()
+	c, params, _, _ := b.ParseContext(context.Background(), problem)
+	return c, params
+}
+
+// ParseContext is Parse stopping when ctx is done: the parse is aborted
+// with the error of ctx, or finished greedily if Expiry is EXPIRY_GREEDY
+func (b *Beam) ParseContext(ctx context.Context, problem Problem) (transition.Configuration, interface{}, Outcome, error) {
 	prefix := log.Prefix()
 	// log.SetPrefix("Parsing ")
 	// log.Println("Starting parse")
-	beamScored := Search(b, problem, b.Size).(*ScoredConfiguration)
+	candidate, outcome, err := SearchContext(ctx, b.newSearch(), problem, b.Size, b.Expiry)
+	if err != nil {
+		return nil, nil, outcome, err
+	}
+	beamScored := candidate.(*ScoredConfiguration)
 	// build result parameters
 	var resultParams *ParseResultParameters
 	if b.ReturnModelValue || b.ReturnSequence {
@@ -446,13 +498,66 @@ func (b *Beam) Parse(problem Problem) (transition.Configuration, interface{}) {
 	// log.Println("Total Time:", b.DurTotal.Nanoseconds())
 	// log.Println("\n", beamScored.C.GetSequence())
 	log.SetPrefix(prefix)
-	b.DurTotal += time.Since(start)
-	return beamScored.C, resultParams
+	return beamScored.C, resultParams, outcome, nil
+}
+
+// ScoredResult is a parsed configuration with its model score
+type ScoredResult struct {
+	C     transition.Configuration
+	Score float64
 }
 
+// ParseKBest parses the problem and returns up to k analyses of the final
+// agenda with their scores, best first. Analyses with the same key are
+// the same analysis and only the best scoring one is kept; with a nil key
+// every candidate is kept.
+func (b *Beam) ParseKBest(problem Problem, k int, key func(transition.Configuration) string) []ScoredResult {
+	results, _, _ := b.ParseKBestContext(context.Background(), problem, k, key)
+	return results
+}
+
+// ParseKBestContext is ParseKBest stopping when ctx is done, as
+// ParseContext; a parse finished greedily has a single result
+func (b *Beam) ParseKBestContext(ctx context.Context, problem Problem, k int, key func(transition.Configuration) string) ([]ScoredResult, Outcome, error) {
+	candidates, outcome, err := SearchKBestContext(ctx, b.newSearch(), problem, b.Size, b.Size, b.Expiry)
+	if err != nil {
+		return nil, outcome, err
+	}
+	results := make([]ScoredResult, len(candidates))
+	for i, candidate := range candidates {
+		scored := candidate.(*ScoredConfiguration)
+		results[i] = ScoredResult{scored.C, scored.Score()}
+	}
+	return Distinct(results, k, key), outcome, nil
+}
+
+// Distinct returns up to k of the results sorted best first, keeping only
+// the first result of every key; with a nil key the first k are kept
+func Distinct(results []ScoredResult, k int, key func(transition.Configuration) string) []ScoredResult {
+	if k > len(results) {
+		k = len(results)
+	}
+	distinct := make([]ScoredResult, 0, k)
+	seen := make(map[string]bool, len(results))
+	for _, result := range results {
+		if len(distinct) == k {
+			break
+		}
+		if key != nil {
+			analysis := key(result.C)
+			if seen[analysis] {
+				continue
+			}
+			seen[analysis] = true
+		}
+		distinct = append(distinct, result)
+	}
+	return distinct
+}
+
+// DecodeEarlyUpdate sets the model of the beam, so unlike Parse it must not
+// be called concurrently
 func (b *Beam) DecodeEarlyUpdate(goldInstance perceptron.DecodedInstance, m perceptron.Model) (perceptron.DecodedInstance, interface{}, interface{}, int, int, float64) {
-	b.EarlyUpdateAt = -1
-	start := time.Now()
 	prefix := log.Prefix()
 	// log.SetPrefix("Training ")
 	// log.Println("Starting decode")
@@ -470,7 +575,8 @@ func (b *Beam) DecodeEarlyUpdate(goldInstance perceptron.DecodedInstance, m perc
 	b.ReturnModelValue = true
 
 	// log.Println("Begin search..")
-	beamResult, goldResult := SearchEarlyUpdate(b, sent, b.Size, goldSequence)
+	state := b.newSearch()
+	beamResult, goldResult := SearchEarlyUpdate(state, sent, b.Size, goldSequence)
 	// log.Println("Search ended")
 
 	beamScored := beamResult.(*ScoredConfiguration)
@@ -555,8 +661,7 @@ func (b *Beam) DecodeEarlyUpdate(goldInstance perceptron.DecodedInstance, m perc
 	// }
 
 	log.SetPrefix(prefix)
-	b.DurTotal += time.Since(start)
-	return &perceptron.Decoded{goldInstance.Instance(), beamScored.C}, parsedFeatures, goldFeatures, b.EarlyUpdateAt, len(goldSequence) - 1, beamScore
+	return &perceptron.Decoded{goldInstance.Instance(), beamScored.C}, parsedFeatures, goldFeatures, state.earlyUpdateAt, len(goldSequence) - 1, beamScore
 }
 
 func (b *Beam) Aligned() bool {
@@ -574,10 +679,12 @@ func (b *Beam) Idle(c Candidate, candidateNum int) Candidate {
 	} else {
 		newFeatList = &transition.FeaturesList{feats, transition.IDLE, nil}
 	}
-	scores := b.candidateScorePool.Get().(featurevector.ScoredStore)
+	stores := b.scoreStores()
+	scores := stores.Get().(featurevector.ScoredStore)
+	defer stores.Put(scores)
 	scores.Clear()
 	scores.SetTransitions([]int{transition.IDLE.Value()})
-	scorer := b.Model.(*TransitionModel.AvgMatrixSparse)
+	scorer := b.Model.(TransitionModel.Scorer)
 	if b.DecodeTest {
 		if b.ScoredStoreDense {
 			scores.(*featurevector.ArrayStore).Generation = b.IntegrationGeneration
@@ -690,17 +797,13 @@ func (scs ScoredConfigurations) Get(i int) Candidate {
 	return scs[i]
 }
 
+// Equal compares the last configuration of the sequence; an Equaler is
+// never a Candidate, as their Equal methods differ
 func (scs ScoredConfigurations) Equal(otherEq util.Equaler) bool {
-	switch other := otherEq.(type) {
-	case Candidate:
-		return scs[0].Equal(other)
-	default:
-		// log.Println("Equating", scs[len(scs)-1].C, "and", otherEq)
-		// log.Println(scs[len(scs)-1].C.GetSequence())
-		// log.Println(otherEq.GetSequence())
-		return otherEq.Equal(scs[len(scs)-1].C)
-		panic("Cannot compare to other")
-	}
+	// log.Println("Equating", scs[len(scs)-1].C, "and", otherEq)
+	// log.Println(scs[len(scs)-1].C.GetSequence())
+	// log.Println(otherEq.GetSequence())
+	return otherEq.Equal(scs[len(scs)-1].C)
 }
 
 func (s *ScoredConfiguration) AddScore(newScore int64, assignment uint16) {
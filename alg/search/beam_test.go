@@ -1,5 +1,17 @@
 package search
 
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"yap/alg/featurevector"
+	"yap/alg/perceptron"
+	"yap/alg/transition"
+	TransitionModel "yap/alg/transition/model"
+	"yap/util"
+)
+
 // import (
 // 	"yap/alg/featurevector"
 // 	"yap/alg/perceptron"
@@ -172,3 +184,271 @@ package search
 // 	}
 // 	t.Error("bla")
 // }
+
+// bitsProblem is a sequence of length bits to choose; the context of the
+// search is canceled when the first configuration of length cancelAt is
+// built
+type bitsProblem struct {
+	length   int
+	cancelAt int
+	cancel   context.CancelFunc
+}
+
+// bitsConf is a configuration choosing one bit per transition
+type bitsConf struct {
+	problem  *bitsProblem
+	bits     []int
+	last     transition.Transition
+	previous *bitsConf
+}
+
+var _ transition.Configuration = &bitsConf{}
+
+func (c *bitsConf) Init(p interface{}) { c.problem = p.(*bitsProblem) }
+func (c *bitsConf) Terminal() bool     { return len(c.bits) == c.problem.length }
+func (c *bitsConf) Copy() transition.Configuration {
+	newConf := *c
+	newConf.bits = append([]int(nil), c.bits...)
+	return &newConf
+}
+func (c *bitsConf) CopyTo(other transition.Configuration) { *other.(*bitsConf) = *c }
+func (c *bitsConf) Clear()                                { c.bits, c.last, c.previous = nil, nil, nil }
+func (c *bitsConf) Len() int                              { return len(c.bits) }
+func (c *bitsConf) Previous() transition.Configuration {
+	if c.previous == nil {
+		return nil
+	}
+	return c.previous
+}
+func (c *bitsConf) SetPrevious(p transition.Configuration) { c.previous = p.(*bitsConf) }
+func (c *bitsConf) GetSequence() transition.ConfigurationSequence {
+	var seq transition.ConfigurationSequence
+	for cur := c; cur != nil; cur = cur.previous {
+		seq = append(seq, cur)
+	}
+	return seq
+}
+func (c *bitsConf) SetLastTransition(t transition.Transition) { c.last = t }
+func (c *bitsConf) GetLastTransition() transition.Transition  { return c.last }
+func (c *bitsConf) String() string                            { return fmt.Sprint(c.bits) }
+func (c *bitsConf) Equal(other util.Equaler) bool {
+	return c.String() == other.(*bitsConf).String()
+}
+func (c *bitsConf) Address(location []byte, offset int) (int, bool, bool) { return 0, false, false }
+func (c *bitsConf) GenerateAddresses(nodeID int, location []byte) []int   { return nil }
+func (c *bitsConf) Attribute(source byte, nodeID int, attribute []byte, transitions []int) (interface{}, bool, bool) {
+	return nil, false, false
+}
+func (c *bitsConf) Assignment() uint16 { return 0 }
+func (c *bitsConf) State() byte        { return 'B' }
+
+// bitsSystem appends the bit of a transition
+type bitsSystem struct{}
+
+var _ transition.TransitionSystem = bitsSystem{}
+
+func (bitsSystem) Transition(from transition.Configuration, t transition.Transition) transition.Configuration {
+	c := from.Copy().(*bitsConf)
+	c.bits = append(c.bits, t.Value())
+	c.last, c.previous = t, from.(*bitsConf)
+	if p := c.problem; p.cancel != nil && len(c.bits) == p.cancelAt {
+		p.cancel()
+	}
+	return c
+}
+func (bitsSystem) TransitionTypes() []string { return []string{"B"} }
+func (s bitsSystem) YieldTransitions(conf transition.Configuration) (byte, chan int) {
+	transType, values := s.GetTransitions(conf)
+	transitions := make(chan int, len(values))
+	for _, value := range values {
+		transitions <- value
+	}
+	close(transitions)
+	return transType, transitions
+}
+func (bitsSystem) GetTransitions(conf transition.Configuration) (byte, []int) {
+	if conf.Terminal() {
+		return 'B', nil
+	}
+	return 'B', []int{0, 1}
+}
+func (bitsSystem) Oracle() transition.Oracle { return nil }
+func (bitsSystem) AddDefaultOracle()         {}
+func (bitsSystem) Name() string              { return "Bits" }
+
+// bitsFeature is the position of the next bit and the last bit chosen
+type bitsFeature [2]int
+
+// bitsExtractor extracts the bitsFeature of a configuration
+type bitsExtractor struct{}
+
+func (bitsExtractor) Features(instance perceptron.Instance, flag bool, transType byte, transitions []int) []featurevector.Feature {
+	c := instance.(*bitsConf)
+	last := -1
+	if len(c.bits) > 0 {
+		last = c.bits[len(c.bits)-1]
+	}
+	return []featurevector.Feature{bitsFeature{len(c.bits), last}}
+}
+func (bitsExtractor) EstimatedNumberOfFeatures() int { return 1 }
+func (bitsExtractor) SetLog(bool)                    {}
+
+// bitsModel scores the bits 0 and 1 by feature
+type bitsModel map[bitsFeature][2]int64
+
+var (
+	_ TransitionModel.Interface = bitsModel{}
+	_ TransitionModel.Scorer    = bitsModel{}
+)
+
+func (m bitsModel) SetTransitionScores(features []featurevector.Feature, scores featurevector.ScoredStore, integrated bool) {
+	for _, feature := range features {
+		weights := m[feature.(bitsFeature)]
+		scores.Inc(0, weights[0])
+		scores.Inc(1, weights[1])
+	}
+}
+func (m bitsModel) TransitionScore(t transition.Transition, features []featurevector.Feature) int64 {
+	var score int64
+	for _, feature := range features {
+		score += m[feature.(bitsFeature)][t.Value()]
+	}
+	return score
+}
+func (m bitsModel) Score(features interface{}) int64                                    { return 0 }
+func (m bitsModel) Add(features interface{}) perceptron.Model                           { return m }
+func (m bitsModel) Subtract(features interface{}) perceptron.Model                      { return m }
+func (m bitsModel) AddSubtract(goldFeatures, decodedFeatures interface{}, amount int64) {}
+func (m bitsModel) ScalarDivide(int64)                                                  {}
+func (m bitsModel) Copy() perceptron.Model                                              { return m }
+func (m bitsModel) AddModel(perceptron.Model)                                           {}
+func (m bitsModel) New() perceptron.Model                                               { return bitsModel{} }
+
+// a garden path: 1 is the best first bit, but only 0 0 1 scores well
+var testBitsModel = bitsModel{
+	{0, -1}: {2, 3},
+	{1, 1}:  {-10, -9},
+	{1, 0}:  {1, 2},
+	{2, 1}:  {1, 2},
+	{2, 0}:  {3, 4},
+}
+
+func newBitsBeam(expiry Expiry) *Beam {
+	return &Beam{
+		Base:          &bitsConf{},
+		TransFunc:     bitsSystem{},
+		FeatExtractor: bitsExtractor{},
+		Model:         testBitsModel,
+		Size:          2,
+		Expiry:        expiry,
+	}
+}
+
+func TestParseContextExpiry(t *testing.T) {
+	AllOut = false
+	tests := []struct {
+		name     string
+		expiry   Expiry
+		cancelAt int
+		outcome  Outcome
+		err      error
+		bits     string
+	}{
+		{"complete", EXPIRY_ABORT, 0, OUTCOME_COMPLETE, nil, "[0 0 1]"},
+		{"greedy mid search", EXPIRY_GREEDY, 1, OUTCOME_GREEDY, nil, "[1 1 1]"},
+		{"greedy at the last round", EXPIRY_GREEDY, 2, OUTCOME_GREEDY, nil, "[0 1 1]"},
+		{"abort mid search", EXPIRY_ABORT, 1, OUTCOME_ABORTED, context.Canceled, ""},
+	}
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		problem := &bitsProblem{length: 3}
+		if test.cancelAt > 0 {
+			problem.cancelAt, problem.cancel = test.cancelAt, cancel
+		}
+		conf, _, outcome, err := newBitsBeam(test.expiry).ParseContext(ctx, problem)
+		cancel()
+		if outcome != test.outcome || err != test.err {
+			t.Errorf("%s: expected outcome %v and error %v, got %v and %v", test.name, test.outcome, test.err, outcome, err)
+			continue
+		}
+		if test.err != nil {
+			if conf != nil {
+				t.Errorf("%s: expected no configuration, got %v", test.name, conf)
+			}
+			continue
+		}
+		if conf.String() != test.bits {
+			t.Errorf("%s: expected %s, got %v", test.name, test.bits, conf)
+		}
+	}
+}
+
+func TestParseContextExpired(t *testing.T) {
+	AllOut = false
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	conf, _, outcome, err := newBitsBeam(EXPIRY_GREEDY).ParseContext(ctx, &bitsProblem{length: 3})
+	if outcome != OUTCOME_GREEDY || err != nil {
+		t.Fatalf("Expected a greedy parse, got %v %v", outcome, err)
+	}
+	if conf.String() != "[1 1 1]" {
+		t.Errorf("Expected the greedy parse [1 1 1], got %v", conf)
+	}
+	if _, _, outcome, err = newBitsBeam(EXPIRY_ABORT).ParseContext(ctx, &bitsProblem{length: 3}); outcome != OUTCOME_ABORTED || err != context.Canceled {
+		t.Errorf("Expected an aborted parse, got %v %v", outcome, err)
+	}
+}
+
+// run with -race: searches keep their state per call, so one Beam serves
+// concurrent parses, complete, greedy and k-best alike, with the results of
+// sequential ones
+func TestParseContextConcurrent(t *testing.T) {
+	AllOut = false
+	beam := newBitsBeam(EXPIRY_GREEDY)
+	beam.ConcurrentExec = true
+	parse := func(i int) string {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		problem := &bitsProblem{length: 3}
+		switch i % 3 {
+		case 1:
+			problem.cancelAt, problem.cancel = 1, cancel
+		case 2:
+			results, outcome, err := beam.ParseKBestContext(ctx, problem, 2, nil)
+			if err != nil {
+				return err.Error()
+			}
+			parsed := fmt.Sprint(outcome)
+			for _, result := range results {
+				parsed += fmt.Sprint(" ", result.C, result.Score)
+			}
+			return parsed
+		}
+		conf, _, outcome, err := beam.ParseContext(ctx, problem)
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprint(outcome, conf)
+	}
+	expected := []string{parse(0), parse(1), parse(2)}
+	if expected[0] != "complete [0 0 1]" || expected[1] != "greedy [1 1 1]" {
+		t.Fatalf("Unexpected sequential parses %v", expected)
+	}
+	var (
+		wg      sync.WaitGroup
+		results = make([]string, 48)
+	)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = parse(i)
+		}(i)
+	}
+	wg.Wait()
+	for i, result := range results {
+		if result != expected[i%3] {
+			t.Errorf("Parse %d: expected %s, got %s", i, expected[i%3], result)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package search
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sort"
@@ -32,6 +33,13 @@ var _ perceptron.InstanceDecoder = &Deterministic{}
 
 // Parser functions
 func (d *Deterministic) Parse(problem Problem) (transition.Configuration, interface{}) {
+	c, params, _, _ := d.ParseContext(context.Background(), problem)
+	return c, params
+}
+
+// ParseContext is Parse stopping with the error of ctx when ctx is done; a
+// deterministic parse is greedy already, so it is always aborted
+func (d *Deterministic) ParseContext(ctx context.Context, problem Problem) (transition.Configuration, interface{}, Outcome, error) {
 	if d.TransFunc == nil {
 		panic("Can't parse without a transition system")
 	}
@@ -45,6 +53,9 @@ func (d *Deterministic) Parse(problem Problem) (transition.Configuration, interf
 	var prevConf transition.Configuration
 	// deterministic parsing algorithm
 	for !c.Terminal() {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, OUTCOME_ABORTED, err
+		}
 		prevConf = c
 		c, _ = transitionClassifier.TransitionWithConf(c)
 		if c == nil {
@@ -66,7 +77,7 @@ func (d *Deterministic) Parse(problem Problem) (transition.Configuration, interf
 		}
 	}
 
-	return c, resultParams
+	return c, resultParams, OUTCOME_COMPLETE, nil
 }
 
 func (d *Deterministic) ParseOracle(gold perceptron.DecodedInstance) (configuration transition.Configuration, result interface{}) {
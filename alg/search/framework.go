@@ -1,6 +1,7 @@
 package search
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sync"
@@ -58,23 +59,129 @@ type Interface interface {
 
 type IdleFunc func(c Candidate, candidateNum int) Candidate
 
+// CapturedPanic holds a panic raised in a search worker goroutine so it can be
+// re-raised in the goroutine running the search, where callers can recover it
+type CapturedPanic struct {
+	sync.Mutex
+	value interface{}
+}
+
+// Capture must be deferred directly by the goroutine being guarded
+func (c *CapturedPanic) Capture() {
+	if r := recover(); r != nil {
+		c.Set(r)
+	}
+}
+
+func (c *CapturedPanic) Set(r interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	if c.value == nil {
+		c.value = r
+	}
+}
+
+// Repanic re-raises (and clears) a captured panic, if any
+func (c *CapturedPanic) Repanic() {
+	c.Lock()
+	r := c.value
+	c.value = nil
+	c.Unlock()
+	if r != nil {
+		panic(r)
+	}
+}
+
 type Idle interface {
 	Idle(c Candidate, candidateNum int) Candidate
 }
 
+// KBest is implemented by searches that can return more than the single
+// best candidate of the final agenda
+type KBest interface {
+	KBest(a Agenda, k int) []Candidate
+}
+
+// Expiry selects what a search does when its context is done
+type Expiry int
+
+const (
+	// stop the search and return the context's error
+	EXPIRY_ABORT Expiry = iota
+	// finish the search greedily, expanding only the best candidate of
+	// every round from the current one on
+	EXPIRY_GREEDY
+)
+
+// Outcome tells how a search ended
+type Outcome int
+
+const (
+	OUTCOME_COMPLETE Outcome = iota
+	OUTCOME_GREEDY
+	OUTCOME_ABORTED
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OUTCOME_COMPLETE:
+		return "complete"
+	case OUTCOME_GREEDY:
+		return "greedy"
+	case OUTCOME_ABORTED:
+		return "aborted"
+	default:
+		return fmt.Sprintf("Outcome(%d)", int(o))
+	}
+}
+
 func Search(b Interface, problem Problem, B int) Candidate {
-	candidate, _ := search(b, problem, B, 1, false, nil)
+	candidate, _, _, _, _ := search(context.Background(), b, problem, B, 1, false, nil, EXPIRY_ABORT)
 	return candidate
 }
 
+// SearchContext is Search stopping when ctx is done, as selected by expiry;
+// the error is that of ctx when the search is aborted
+func SearchContext(ctx context.Context, b Interface, problem Problem, B int, expiry Expiry) (Candidate, Outcome, error) {
+	candidate, _, _, outcome, err := search(ctx, b, problem, B, 1, false, nil, expiry)
+	return candidate, outcome, err
+}
+
+// SearchKBest returns up to k candidates of the final agenda, best first;
+// only the best candidate is returned if b does not implement KBest
+func SearchKBest(b Interface, problem Problem, B, k int) []Candidate {
+	_, _, kbest, _, _ := search(context.Background(), b, problem, B, k, false, nil, EXPIRY_ABORT)
+	return kbest
+}
+
+// SearchKBestContext is SearchKBest stopping when ctx is done; a search
+// finished greedily returns only its best candidate
+func SearchKBestContext(ctx context.Context, b Interface, problem Problem, B, k int, expiry Expiry) ([]Candidate, Outcome, error) {
+	_, _, kbest, outcome, err := search(ctx, b, problem, B, k, false, nil, expiry)
+	return kbest, outcome, err
+}
+
 func SearchEarlyUpdate(b Interface, problem Problem, B int, goldSequence Candidates) (Candidate, Candidate) {
-	return search(b, problem, B, 1, true, goldSequence)
+	best, gold, _, _, _ := search(context.Background(), b, problem, B, 1, true, goldSequence, EXPIRY_ABORT)
+	return best, gold
+}
+
+// bestCandidate returns the highest scoring candidate, the first of equals
+func bestCandidate(candidates []Candidate) Candidate {
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if candidate.Score() > best.Score() {
+			best = candidate
+		}
+	}
+	return best
 }
 
-func search(b Interface, problem Problem, B, topK int, earlyUpdate bool, goldSequence Candidates) (Candidate, Candidate) {
+func search(ctx context.Context, b Interface, problem Problem, B, topK int, earlyUpdate bool, goldSequence Candidates, expiry Expiry) (Candidate, Candidate, []Candidate, Outcome, error) {
 	var (
 		goldValue Candidate
 		best      Candidate
+		kbest     []Candidate
 		agenda    Agenda
 
 		// for early update
@@ -91,6 +198,11 @@ func search(b Interface, problem Problem, B, topK int, earlyUpdate bool, goldSeq
 		idleCandidates        bool = false
 		idleFunc              IdleFunc
 		idleGoldTransitions   int
+
+		workerPanic CapturedPanic
+
+		// set once ctx is done and the search goes on greedily
+		greedy bool
 	)
 	tempAgendas := make([][]Candidate, 0, B)
 
@@ -136,6 +248,14 @@ func search(b Interface, problem Problem, B, topK int, earlyUpdate bool, goldSeq
 			}
 		}
 
+		if !greedy && ctx.Err() != nil {
+			if expiry != EXPIRY_GREEDY || earlyUpdate {
+				return nil, nil, nil, OUTCOME_ABORTED, ctx.Err()
+			}
+			greedy = true
+			candidates = []Candidate{bestCandidate(candidates)}
+		}
+
 		best = nil
 		tempAgendas = tempAgendas[0:0]
 		resultsReady = make(chan chan int, B)
@@ -144,8 +264,12 @@ func search(b Interface, problem Problem, B, topK int, earlyUpdate bool, goldSeq
 		if len(candidates) > cap(tempAgendas) {
 			panic(fmt.Sprintf("Should not have more candidates than the capacity of the tempAgenda: (%d,%d)\n", len(candidates), cap(tempAgendas)))
 		}
+		// sized up front, the workers fill in their entries concurrently
+		tempAgendas = tempAgendas[0:len(candidates)]
 		// for each candidate in candidates
 		go func() {
+			defer close(resultsReady)
+			defer workerPanic.Capture()
 			if b.Aligned() {
 				minCandidateAlignment = candidates[0].(Aligned).Alignment()
 				if earlyUpdate && candidates[0].Equal(goldValue) {
@@ -168,7 +292,7 @@ func search(b Interface, problem Problem, B, topK int, earlyUpdate bool, goldSeq
 				minAgendaAlignment = -1
 			}
 			for i, candidate := range candidates {
-				tempAgendas = append(tempAgendas, nil)
+				tempAgendas[i] = nil
 				readyChan := make(chan int, 1)
 				resultsReady <- readyChan
 				if b.Aligned() && candidate.(Aligned).Alignment() > minCandidateAlignment {
@@ -192,6 +316,15 @@ func search(b Interface, problem Problem, B, topK int, earlyUpdate bool, goldSeq
 				wg.Add(1)
 				go func(ag Agenda, cand Candidate, j int, doneChan chan int) {
 					defer wg.Done()
+					doneClosed := false
+					defer func() {
+						if r := recover(); r != nil {
+							workerPanic.Set(r)
+							if !doneClosed {
+								close(doneChan)
+							}
+						}
+					}()
 
 					// agenda <- INSERT(EXPAND(candidate,problem),agenda)
 					// tempAgendas[i] = b.Insert(b.Expand(candidate, problem, i), agenda)
@@ -199,6 +332,7 @@ func search(b Interface, problem Problem, B, topK int, earlyUpdate bool, goldSeq
 
 					doneChan <- j
 					close(doneChan)
+					doneClosed = true
 					// readyChan <- i
 					// close(readyChan)
 					if !b.Concurrent() {
@@ -229,7 +363,6 @@ func search(b Interface, problem Problem, B, topK int, earlyUpdate bool, goldSeq
 				// }
 				// *** </POSSIBLY REDUNDANT>
 			}
-			close(resultsReady)
 		}()
 		// wg.Wait()
 
@@ -243,6 +376,7 @@ func search(b Interface, problem Problem, B, topK int, earlyUpdate bool, goldSeq
 				}
 			}
 		}
+		workerPanic.Repanic()
 
 		// for _, tempCandidates := range tempAgendas {
 		// 	agenda.AddCandidates(tempCandidates)
@@ -299,6 +433,10 @@ func search(b Interface, problem Problem, B, topK int, earlyUpdate bool, goldSeq
 
 		// candidates <- TOP-B(agenda, B)
 		candidates, allTerminal = b.TopB(agenda, B)
+		if greedy {
+			best = bestCandidate(candidates)
+			candidates, allTerminal = []Candidate{best}, best.Terminal()
+		}
 
 		// if GOALTEST(problem,best)
 		if ((allTerminal || earlyUpdate) && b.GoalTest(problem, best, i)) || i > MAX_TRANSITIONS {
@@ -320,10 +458,21 @@ func search(b Interface, problem Problem, B, topK int, earlyUpdate bool, goldSeq
 			log.Println("Next Round", i-1)
 		}
 	}
-	if !earlyUpdate {
+	if greedy {
+		best = candidates[0]
+	} else if !earlyUpdate {
 		best = b.Best(agenda)
+		if kbestSearch, ok := b.(KBest); ok && topK > 1 {
+			kbest = kbestSearch.KBest(agenda, topK)
+		}
 	}
 	best = best.Copy()
+	if kbest == nil {
+		kbest = []Candidate{best}
+	}
 	agenda = b.Clear(agenda)
-	return best, goldValue
+	if greedy {
+		return best, goldValue, kbest, OUTCOME_GREEDY, nil
+	}
+	return best, goldValue, kbest, OUTCOME_COMPLETE, nil
 }
@@ -23,6 +23,7 @@ const (
 	REQUIREMENTS_SEPARATOR         = ";" // separates multiple requirements
 	APPROX_ELEMENTS                = 20
 	ALLOW_IDLE                     = true
+	GENERATOR_ADDRESS              = "Ci" // generates an element per child, e.g. S0Ci
 )
 
 var (
@@ -40,6 +41,12 @@ type FeatureTemplateElement struct {
 	IsGenerator bool
 }
 
+// IsGeneratorAddress reports whether the address of a feature element
+// generates an element per node, like S0Ci for every child of S0
+func IsGeneratorAddress(address []byte) bool {
+	return len(address) >= 4 && string(address[2:4]) == GENERATOR_ADDRESS
+}
+
 type FeatureTemplate struct {
 	Elements                                   []FeatureTemplateElement
 	Requirements                               []string
@@ -523,7 +530,6 @@ func (x *GenericExtractor) Features(instance Instance, idle bool, transType byte
 		if hasNilRequirement {
 			features[i] = nil
 		} else {
-			(&featureTemplates[i]).Elements[0].IsGenerator = elements[template.CachedElementIDs[0]].IsGenerator
 			if elements[template.CachedElementIDs[0]].IsGenerator || elementIsGenerator[template.CachedElementIDs[0]] {
 				if x.Log {
 					log.Printf("\t\tIsGenerator")
@@ -639,7 +645,6 @@ func (x *GenericExtractor) GetFeatureElement(conf Configuration, templateElement
 	if isGenerator {
 		addresses = conf.GenerateAddresses(address, []byte(templateElement.Address))
 		resultArray = make([]interface{}, len(addresses))
-		templateElement.IsGenerator = true
 	} else {
 		singleAddress[0] = address
 		addresses = singleAddress[0:1]
@@ -689,6 +694,8 @@ func (x *GenericExtractor) ParseFeatureElement(featElementStr string) (*FeatureT
 
 	element.ConfStr = featElementStrPatchedWP
 	element.Address = []byte(elementParts[0])
+	// set once here, the templates are shared by concurrent searches
+	element.IsGenerator = IsGeneratorAddress(element.Address)
 	// TODO fix to get more than one digit of offset
 
 	// var (
@@ -797,6 +804,7 @@ func (x *GenericExtractor) UpdateFeatureElementCache(feat *FeatureTemplate, idle
 				fullElement.Attributes = make([][]byte, 1)
 				fullElement.Attributes[0] = attr
 				fullElement.ConfStr = *fullConfStr
+				fullElement.IsGenerator = element.IsGenerator
 				group.Elements = append(group.Elements, *fullElement)
 				// log.Println("\t\tGenerated", fullElement.ConfStr)
 			}
@@ -0,0 +1,717 @@
+package model
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"unsafe"
+	. "yap/alg/featurevector"
+	"yap/alg/perceptron"
+	"yap/alg/transition"
+)
+
+// CompiledMatrix is an inference only form of an AvgMatrixSparse: the
+// averaging history is dropped and the feature keys of every template are
+// hashed into an open addressed table of flat arrays, which can be used in
+// place from a memory mapped file
+type CompiledMatrix struct {
+	Tables []*CompiledTable
+	// releases the memory the tables point into, if any
+	release func() error
+}
+
+// CompiledTable holds the weights of one feature template
+type CompiledTable struct {
+	// feature key hashes, 0 marks an empty slot; the length is a power of 2
+	Keys []uint64
+	// the weights of the key in slot i are at Starts[i]:Starts[i+1]
+	Starts []uint32
+	// transitions, sorted within a slot, and their weights; the weights of
+	// a quantized table are Scale times Values16 or Values8 instead
+	Transitions []int32
+	Values      []int64
+	Values16    []int16
+	Values8     []int8
+	Scale       int64
+}
+
+// CompiledTableSize is the number of slots and weights of a table, and the
+// bits and scale of its weights; 0 bits are unquantized 64 bit weights
+type CompiledTableSize struct {
+	Slots, Entries int
+	Bits           int
+	Scale          int64
+}
+
+// CompileStats counts the feature keys of a compiled model
+type CompileStats struct {
+	Features, Weights int
+	// keys that can't match a feature at parse time, such as pointers
+	Unhashable int
+	// keys whose hash equals that of another key of the template
+	Collisions int
+}
+
+var (
+	_ perceptron.Model = &CompiledMatrix{}
+	_ Interface        = &CompiledMatrix{}
+	_ Scorer           = &CompiledMatrix{}
+	_ Scorer           = &AvgMatrixSparse{}
+)
+
+const (
+	fnvOffset64 uint64 = 14695981039346656037
+	fnvPrime64  uint64 = 1099511628211
+)
+
+// type tags of the feature hash, so equal bytes of different types differ
+const (
+	tagNil byte = iota
+	tagInt
+	tagString
+	tagInterfaceArray
+	tagIntArray
+	tagNamedInt
+	tagNamedUint
+	tagNamedString
+	tagBool
+	tagArray
+)
+
+// HashFeature returns a 64 bit hash of a feature key; keys that don't
+// compare by value, such as pointers, are not hashable
+func HashFeature(feature interface{}) (uint64, bool) {
+	h, ok := hashFeature(fnvOffset64, feature)
+	if h == 0 {
+		// 0 marks an empty slot
+		h = 1
+	}
+	return h, ok
+}
+
+func hashByte(h uint64, b byte) uint64 {
+	return (h ^ uint64(b)) * fnvPrime64
+}
+
+func hashUint64(h uint64, v uint64) uint64 {
+	for i := uint(0); i < 64; i += 8 {
+		h = hashByte(h, byte(v>>i))
+	}
+	return h
+}
+
+func hashString(h uint64, s string) uint64 {
+	h = hashUint64(h, uint64(len(s)))
+	for i := 0; i < len(s); i++ {
+		h = hashByte(h, s[i])
+	}
+	return h
+}
+
+func hashInterfaces(h uint64, values []interface{}) (uint64, bool) {
+	h = hashUint64(hashByte(h, tagInterfaceArray), uint64(len(values)))
+	var ok bool
+	for _, v := range values {
+		if h, ok = hashFeature(h, v); !ok {
+			return 0, false
+		}
+	}
+	return h, true
+}
+
+func hashInts(h uint64, values []int) uint64 {
+	h = hashUint64(hashByte(h, tagIntArray), uint64(len(values)))
+	for _, v := range values {
+		h = hashUint64(h, uint64(v))
+	}
+	return h
+}
+
+func hashFeature(h uint64, feature interface{}) (uint64, bool) {
+	switch f := feature.(type) {
+	case nil:
+		return hashByte(h, tagNil), true
+	case int:
+		return hashUint64(hashByte(h, tagInt), uint64(f)), true
+	case string:
+		return hashString(hashByte(h, tagString), f), true
+	case [2]interface{}:
+		return hashInterfaces(h, f[:])
+	case [3]interface{}:
+		return hashInterfaces(h, f[:])
+	case [4]interface{}:
+		return hashInterfaces(h, f[:])
+	case [5]interface{}:
+		return hashInterfaces(h, f[:])
+	case [6]interface{}:
+		return hashInterfaces(h, f[:])
+	case [2]int:
+		return hashInts(h, f[:]), true
+	case [3]int:
+		return hashInts(h, f[:]), true
+	case [4]int:
+		return hashInts(h, f[:]), true
+	case [5]int:
+		return hashInts(h, f[:]), true
+	case [6]int:
+		return hashInts(h, f[:]), true
+	}
+	// named and other basic types, with the type name in the hash
+	v := reflect.ValueOf(feature)
+	name := v.Type().String()
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return hashUint64(hashString(hashByte(h, tagNamedInt), name), uint64(v.Int())), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return hashUint64(hashString(hashByte(h, tagNamedUint), name), v.Uint()), true
+	case reflect.String:
+		return hashString(hashString(hashByte(h, tagNamedString), name), v.String()), true
+	case reflect.Bool:
+		var b byte
+		if v.Bool() {
+			b = 1
+		}
+		return hashByte(hashString(hashByte(h, tagBool), name), b), true
+	case reflect.Array:
+		h = hashUint64(hashString(hashByte(h, tagArray), name), uint64(v.Len()))
+		var ok bool
+		for i := 0; i < v.Len(); i++ {
+			if h, ok = hashFeature(h, v.Index(i).Interface()); !ok {
+				return 0, false
+			}
+		}
+		return h, true
+	}
+	return 0, false
+}
+
+// lookup returns the range of the weights of a key hash
+func (t *CompiledTable) lookup(h uint64) (int, int, bool) {
+	if len(t.Keys) == 0 {
+		return 0, 0, false
+	}
+	mask := uint64(len(t.Keys) - 1)
+	for i := h & mask; ; i = (i + 1) & mask {
+		switch t.Keys[i] {
+		case h:
+			return int(t.Starts[i]), int(t.Starts[i+1]), true
+		case 0:
+			return 0, 0, false
+		}
+	}
+}
+
+func (t *CompiledTable) setScores(feature Feature, scores ScoredStore) {
+	h, ok := HashFeature(feature)
+	if !ok {
+		return
+	}
+	start, end, exists := t.lookup(h)
+	if !exists {
+		return
+	}
+	switch {
+	case t.Values8 != nil:
+		for i, transition := range t.Transitions[start:end] {
+			scores.Inc(int(transition), int64(t.Values8[start+i])*t.Scale)
+		}
+	case t.Values16 != nil:
+		for i, transition := range t.Transitions[start:end] {
+			scores.Inc(int(transition), int64(t.Values16[start+i])*t.Scale)
+		}
+	default:
+		scores.IncSorted(t.Transitions[start:end], t.Values[start:end])
+	}
+}
+
+// weight returns the i'th weight of the table
+func (t *CompiledTable) weight(i int) int64 {
+	switch {
+	case t.Values8 != nil:
+		return int64(t.Values8[i]) * t.Scale
+	case t.Values16 != nil:
+		return int64(t.Values16[i]) * t.Scale
+	}
+	return t.Values[i]
+}
+
+// Len returns the number of weights of the table
+func (t *CompiledTable) Len() int {
+	return len(t.Transitions)
+}
+
+// Value returns the weight of a feature for a transition
+func (t *CompiledTable) Value(transition int, feature interface{}) int64 {
+	h, ok := HashFeature(feature)
+	if !ok {
+		return 0
+	}
+	start, end, exists := t.lookup(h)
+	if !exists {
+		return 0
+	}
+	transitions := t.Transitions[start:end]
+	i := sort.Search(len(transitions), func(i int) bool { return int(transitions[i]) >= transition })
+	if i < len(transitions) && int(transitions[i]) == transition {
+		return t.weight(start + i)
+	}
+	return 0
+}
+
+func (t *CompiledTable) size() CompiledTableSize {
+	size := CompiledTableSize{Slots: len(t.Keys), Entries: len(t.Transitions)}
+	switch {
+	case t.Values8 != nil:
+		size.Bits, size.Scale = 8, t.Scale
+	case t.Values16 != nil:
+		size.Bits, size.Scale = 16, t.Scale
+	}
+	return size
+}
+
+func (c *CompiledMatrix) Score(features interface{}) int64 {
+	f := features.(*transition.FeaturesList)
+	if f.Previous == nil {
+		return 0
+	}
+	return c.Score(f.Previous) + c.TransitionScore(f.Transition, f.Previous.Features)
+}
+
+func (c *CompiledMatrix) TransitionScore(transition transition.Transition, features []Feature) int64 {
+	var (
+		retval   int64
+		intTrans int = transition.Value()
+	)
+	if len(features) > len(c.Tables) {
+		panic("Got more features than known matrix features")
+	}
+	for i, feat := range features {
+		if feat != nil {
+			switch f := feat.(type) {
+			case []interface{}:
+				for _, generatedFeat := range f {
+					retval += c.Tables[i].Value(intTrans, generatedFeat)
+				}
+			default:
+				retval += c.Tables[i].Value(intTrans, feat)
+			}
+		}
+	}
+	return retval
+}
+
+// SetTransitionScores sets the scores of the features; a compiled model
+// has no averaging history so integrated is ignored
+func (c *CompiledMatrix) SetTransitionScores(features []Feature, scores ScoredStore, integrated bool) {
+	for i, feat := range features {
+		if feat != nil {
+			switch f := feat.(type) {
+			case []interface{}:
+				for _, generatedFeat := range f {
+					c.Tables[i].setScores(generatedFeat, scores)
+				}
+			case TAF:
+				for feat, _ := range f.GetTransFeatures() {
+					c.Tables[i].setScores(feat, scores)
+				}
+			default:
+				c.Tables[i].setScores(feat, scores)
+			}
+		}
+	}
+}
+
+func (c *CompiledMatrix) Add(features interface{}) perceptron.Model {
+	panic("Cannot train a compiled (inference only) model")
+}
+
+func (c *CompiledMatrix) Subtract(features interface{}) perceptron.Model {
+	panic("Cannot train a compiled (inference only) model")
+}
+
+func (c *CompiledMatrix) AddSubtract(goldFeatures, decodedFeatures interface{}, amount int64) {
+	panic("Cannot train a compiled (inference only) model")
+}
+
+func (c *CompiledMatrix) ScalarDivide(val int64) {
+	panic("Cannot train a compiled (inference only) model")
+}
+
+func (c *CompiledMatrix) Copy() perceptron.Model {
+	panic("Cannot copy a compiled model")
+}
+
+func (c *CompiledMatrix) AddModel(m perceptron.Model) {
+	panic("Cannot add two compiled models")
+}
+
+func (c *CompiledMatrix) New() perceptron.Model {
+	panic("Cannot train a compiled (inference only) model")
+}
+
+// Close releases the memory mapped file of a loaded model; the model can't
+// be used after it
+func (c *CompiledMatrix) Close() error {
+	if c.release == nil {
+		return nil
+	}
+	release := c.release
+	c.release = nil
+	c.Tables = nil
+	return release()
+}
+
+// Sizes returns the sizes of the tables, which are needed to read their
+// arrays
+func (c *CompiledMatrix) Sizes() []CompiledTableSize {
+	sizes := make([]CompiledTableSize, len(c.Tables))
+	for i, table := range c.Tables {
+		sizes[i] = table.size()
+	}
+	return sizes
+}
+
+// compiledKey is a feature key of a template with its hash
+type compiledKey struct {
+	hash    uint64
+	weights map[int]int64
+}
+
+// CompileMatrix compiles the weights of a serialized model. Zero weights are
+// dropped, as are keys that can't be hashed or whose hash collides with
+// another key of the template.
+func CompileMatrix(data *AvgMatrixSparseSerialized) (*CompiledMatrix, CompileStats, error) {
+	var stats CompileStats
+	c := &CompiledMatrix{Tables: make([]*CompiledTable, len(data.Mat))}
+	for i, val := range data.Mat {
+		mat, ok := val.(map[interface{}]map[int]int64)
+		if !ok {
+			return nil, stats, fmt.Errorf("unknown serialization %T of feature template %d", val, i)
+		}
+		keys := make([]compiledKey, 0, len(mat))
+		for feature, weights := range mat {
+			h, ok := HashFeature(feature)
+			if !ok {
+				stats.Unhashable++
+				continue
+			}
+			keys = append(keys, compiledKey{h, weights})
+		}
+		// sorted by hash the table doesn't depend on map iteration order;
+		// weights of colliding keys are compared so the kept key is too
+		sort.Slice(keys, func(a, b int) bool {
+			if keys[a].hash != keys[b].hash {
+				return keys[a].hash < keys[b].hash
+			}
+			return fmt.Sprint(keys[a].weights) < fmt.Sprint(keys[b].weights)
+		})
+		unique := keys[:0]
+		for _, key := range keys {
+			if len(unique) > 0 && unique[len(unique)-1].hash == key.hash {
+				stats.Collisions++
+				continue
+			}
+			unique = append(unique, key)
+		}
+		table, err := compileTable(unique)
+		if err != nil {
+			return nil, stats, fmt.Errorf("feature template %d: %v", i, err)
+		}
+		c.Tables[i] = table
+		stats.Features += len(unique)
+		stats.Weights += table.Len()
+	}
+	return c, stats, nil
+}
+
+func compileTable(keys []compiledKey) (*CompiledTable, error) {
+	slots := 1
+	for slots < 2*len(keys) {
+		slots <<= 1
+	}
+	slotKeys := make([]int, slots)
+	for i := range slotKeys {
+		slotKeys[i] = -1
+	}
+	table := &CompiledTable{
+		Keys:   make([]uint64, slots),
+		Starts: make([]uint32, slots+1),
+	}
+	mask := uint64(slots - 1)
+	for k, key := range keys {
+		i := key.hash & mask
+		for table.Keys[i] != 0 {
+			i = (i + 1) & mask
+		}
+		table.Keys[i] = key.hash
+		slotKeys[i] = k
+	}
+	transitions := make([]int, 0, 10)
+	for i, k := range slotKeys {
+		if uint64(len(table.Values)) > math.MaxUint32 {
+			return nil, errors.New("too many weights")
+		}
+		table.Starts[i] = uint32(len(table.Values))
+		if k < 0 {
+			continue
+		}
+		transitions = transitions[:0]
+		for transition, value := range keys[k].weights {
+			if value != 0 {
+				transitions = append(transitions, transition)
+			}
+		}
+		sort.Ints(transitions)
+		for _, transition := range transitions {
+			if transition > math.MaxInt32 {
+				return nil, fmt.Errorf("transition %d out of range", transition)
+			}
+			table.Transitions = append(table.Transitions, int32(transition))
+			table.Values = append(table.Values, keys[k].weights[transition])
+		}
+	}
+	table.Starts[slots] = uint32(len(table.Values))
+	return table, nil
+}
+
+// Quantize stores the weights of every table as 8 or 16 bit integers times
+// a scale of the table, chosen so its largest weight fits. Weights that
+// round to 0 are dropped; Quantize returns how many were.
+func (c *CompiledMatrix) Quantize(bits int) (int, error) {
+	var qmax int64
+	switch bits {
+	case 8:
+		qmax = math.MaxInt8
+	case 16:
+		qmax = math.MaxInt16
+	default:
+		return 0, fmt.Errorf("can't quantize weights to %d bits", bits)
+	}
+	var dropped int
+	for i, table := range c.Tables {
+		if table.Values == nil && table.Len() > 0 {
+			return dropped, fmt.Errorf("feature template %d is already quantized", i)
+		}
+		var maxAbs int64
+		for _, value := range table.Values {
+			if value < 0 {
+				value = -value
+			}
+			if value > maxAbs {
+				maxAbs = value
+			}
+		}
+		scale := (maxAbs + qmax - 1) / qmax
+		if scale < 1 {
+			scale = 1
+		}
+		quantized := &CompiledTable{
+			Keys:   table.Keys,
+			Starts: make([]uint32, len(table.Starts)),
+			Scale:  scale,
+		}
+		var values8 []int8
+		var values16 []int16
+		for slot := 0; slot < len(table.Keys); slot++ {
+			quantized.Starts[slot] = uint32(len(quantized.Transitions))
+			for j := table.Starts[slot]; j < table.Starts[slot+1]; j++ {
+				value := table.Values[j]
+				// rounded to the nearest multiple of the scale
+				q := (value + scale/2) / scale
+				if value < 0 {
+					q = (value - scale/2) / scale
+				}
+				if q == 0 {
+					dropped++
+					continue
+				}
+				quantized.Transitions = append(quantized.Transitions, table.Transitions[j])
+				if bits == 8 {
+					values8 = append(values8, int8(q))
+				} else {
+					values16 = append(values16, int16(q))
+				}
+			}
+		}
+		quantized.Starts[len(table.Keys)] = uint32(len(quantized.Transitions))
+		if bits == 8 {
+			quantized.Values8 = append([]int8{}, values8...)
+		} else {
+			quantized.Values16 = append([]int16{}, values16...)
+		}
+		c.Tables[i] = quantized
+	}
+	return dropped, nil
+}
+
+// The arrays of the tables are written in order, little endian, each padded
+// to 8 bytes so they can be used in place when mapped to an aligned address
+
+func padding(n int) int {
+	return (8 - n%8) % 8
+}
+
+// valueSize is the number of bytes of a weight
+func (s CompiledTableSize) valueSize() int {
+	if s.Bits == 0 {
+		return 8
+	}
+	return s.Bits / 8
+}
+
+// ArraysSize returns the number of bytes of the arrays of tables of the
+// given sizes
+func ArraysSize(sizes []CompiledTableSize) int {
+	var n int
+	for _, size := range sizes {
+		for _, array := range [...]int{8 * size.Slots, 4 * (size.Slots + 1), 4 * size.Entries, size.valueSize() * size.Entries} {
+			n += array + padding(array)
+		}
+	}
+	return n
+}
+
+// WriteArrays writes the arrays of the tables
+func (c *CompiledMatrix) WriteArrays(w io.Writer) error {
+	var (
+		buf [8]byte
+		err error
+	)
+	write := func(b []byte) {
+		if err == nil {
+			_, err = w.Write(b)
+		}
+	}
+	pad := func(n int) {
+		for i := 0; i < padding(n); i++ {
+			write([]byte{0})
+		}
+	}
+	for _, table := range c.Tables {
+		for _, v := range table.Keys {
+			binary.LittleEndian.PutUint64(buf[:], v)
+			write(buf[:8])
+		}
+		for _, v := range table.Starts {
+			binary.LittleEndian.PutUint32(buf[:], v)
+			write(buf[:4])
+		}
+		pad(4 * len(table.Starts))
+		for _, v := range table.Transitions {
+			binary.LittleEndian.PutUint32(buf[:], uint32(v))
+			write(buf[:4])
+		}
+		pad(4 * len(table.Transitions))
+		for _, v := range table.Values {
+			binary.LittleEndian.PutUint64(buf[:], uint64(v))
+			write(buf[:8])
+		}
+		for _, v := range table.Values16 {
+			binary.LittleEndian.PutUint16(buf[:], uint16(v))
+			write(buf[:2])
+		}
+		pad(2 * len(table.Values16))
+		for _, v := range table.Values8 {
+			write([]byte{byte(v)})
+		}
+		pad(len(table.Values8))
+	}
+	return err
+}
+
+// littleEndian is true if the arrays can be used in place on this machine
+var littleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// NewCompiledMatrix returns the compiled model of tables of the given sizes
+// whose arrays are in data, written by WriteArrays. The tables point into
+// data when it is aligned and the machine is little endian, otherwise the
+// arrays are copied. release, if not nil, is called by Close.
+func NewCompiledMatrix(sizes []CompiledTableSize, data []byte, release func() error) (*CompiledMatrix, error) {
+	if len(data) != ArraysSize(sizes) {
+		return nil, fmt.Errorf("compiled model arrays are %d bytes, expected %d", len(data), ArraysSize(sizes))
+	}
+	inPlace := littleEndian && (len(data) == 0 || uintptr(unsafe.Pointer(&data[0]))%8 == 0)
+	c := &CompiledMatrix{Tables: make([]*CompiledTable, len(sizes)), release: release}
+	next := func(n int) []byte {
+		b := data[:n]
+		data = data[n+padding(n):]
+		return b
+	}
+	for i, size := range sizes {
+		if size.Slots <= 0 || size.Slots&(size.Slots-1) != 0 {
+			return nil, fmt.Errorf("compiled model table %d has %d slots, not a power of 2", i, size.Slots)
+		}
+		if size.Bits != 0 && size.Bits != 8 && size.Bits != 16 {
+			return nil, fmt.Errorf("compiled model table %d has unsupported %d bit weights", i, size.Bits)
+		}
+		table := &CompiledTable{Scale: size.Scale}
+		keys := next(8 * size.Slots)
+		starts := next(4 * (size.Slots + 1))
+		transitions := next(4 * size.Entries)
+		values := next(size.valueSize() * size.Entries)
+		if inPlace {
+			table.Keys = unsafe.Slice((*uint64)(unsafe.Pointer(&keys[0])), size.Slots)
+			table.Starts = unsafe.Slice((*uint32)(unsafe.Pointer(&starts[0])), size.Slots+1)
+			// the weights of a quantized table are set even if it's empty
+			switch size.Bits {
+			case 8:
+				table.Values8 = []int8{}
+			case 16:
+				table.Values16 = []int16{}
+			}
+			if size.Entries > 0 {
+				table.Transitions = unsafe.Slice((*int32)(unsafe.Pointer(&transitions[0])), size.Entries)
+				switch size.Bits {
+				case 8:
+					table.Values8 = unsafe.Slice((*int8)(unsafe.Pointer(&values[0])), size.Entries)
+				case 16:
+					table.Values16 = unsafe.Slice((*int16)(unsafe.Pointer(&values[0])), size.Entries)
+				default:
+					table.Values = unsafe.Slice((*int64)(unsafe.Pointer(&values[0])), size.Entries)
+				}
+			}
+		} else {
+			table.Keys = make([]uint64, size.Slots)
+			for j := range table.Keys {
+				table.Keys[j] = binary.LittleEndian.Uint64(keys[8*j:])
+			}
+			table.Starts = make([]uint32, size.Slots+1)
+			for j := range table.Starts {
+				table.Starts[j] = binary.LittleEndian.Uint32(starts[4*j:])
+			}
+			table.Transitions = make([]int32, size.Entries)
+			for j := range table.Transitions {
+				table.Transitions[j] = int32(binary.LittleEndian.Uint32(transitions[4*j:]))
+			}
+			switch size.Bits {
+			case 8:
+				table.Values8 = make([]int8, size.Entries)
+				for j := range table.Values8 {
+					table.Values8[j] = int8(values[j])
+				}
+			case 16:
+				table.Values16 = make([]int16, size.Entries)
+				for j := range table.Values16 {
+					table.Values16[j] = int16(binary.LittleEndian.Uint16(values[2*j:]))
+				}
+			default:
+				table.Values = make([]int64, size.Entries)
+				for j := range table.Values {
+					table.Values[j] = int64(binary.LittleEndian.Uint64(values[8*j:]))
+				}
+			}
+		}
+		if int(table.Starts[size.Slots]) != size.Entries {
+			return nil, fmt.Errorf("compiled model table %d is corrupt", i)
+		}
+		c.Tables[i] = table
+	}
+	return c, nil
+}
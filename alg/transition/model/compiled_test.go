@@ -0,0 +1,327 @@
+package model_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"yap/alg/featurevector"
+	"yap/alg/transition"
+	"yap/alg/transition/model"
+	"yap/app"
+	nlp "yap/nlp/types"
+	"yap/util"
+)
+
+func testWeights() *model.AvgMatrixSparseSerialized {
+	return &model.AvgMatrixSparseSerialized{
+		Mat: []interface{}{
+			map[interface{}]map[int]int64{
+				3:            {1: 10, 4: -2},
+				"word":       {2: 5, 3: 0},
+				[2]int{1, 2}: {7: 1},
+			},
+			map[interface{}]map[int]int64{
+				[2]interface{}{1, "word"}: {1: 3},
+				nlp.Token("word"):         {1: 4},
+			},
+		},
+	}
+}
+
+func writeModel(t *testing.T, header *app.ModelHeader, data *app.Serialization, weights *model.CompiledMatrix) string {
+	f, err := ioutil.TempFile("", "model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := app.WriteCompiledModel(f.Name(), header, data, weights); err != nil {
+		os.Remove(f.Name())
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestReadModelCorrupt(t *testing.T) {
+	for name, content := range map[string]string{
+		"empty":               "",
+		"garbage":             "not a model",
+		"magic only":          app.MODEL_MAGIC,
+		"compiled magic only": app.COMPILED_MODEL_MAGIC,
+		"compiled truncated":  app.COMPILED_MODEL_MAGIC + "\xff\x00\x00\x00\x00\x00\x00\x00",
+	} {
+		f, err := ioutil.TempFile("", "model")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		f.WriteString(content)
+		f.Close()
+		if _, _, _, err := app.LoadModel(f.Name()); err == nil {
+			t.Errorf("%s: expected an error reading a corrupt model", name)
+		}
+	}
+}
+
+func TestReadCompiledModel(t *testing.T) {
+	token := nlp.Token("token")
+	weights := testWeights()
+	weights.Mat[0].(map[interface{}]map[int]int64)[&token] = map[int]int64{1: 100}
+	compiled, stats, err := model.CompileMatrix(weights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Unhashable != 1 {
+		t.Errorf("expected the pointer key to be dropped, got %d unhashable keys", stats.Unhashable)
+	}
+	file := writeModel(t, nil, &app.Serialization{}, compiled)
+	defer os.Remove(file)
+	loaded, _, _, err := app.LoadModel(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.(io.Closer).Close()
+	for _, test := range []struct {
+		transition int
+		features   []featurevector.Feature
+		score      int64
+	}{
+		{1, []featurevector.Feature{3, nil}, 10},
+		{4, []featurevector.Feature{3, nil}, -2},
+		{2, []featurevector.Feature{"word", nil}, 5},
+		{3, []featurevector.Feature{"word", nil}, 0},
+		{1, []featurevector.Feature{&token, nil}, 0},
+		{7, []featurevector.Feature{[2]int{1, 2}, nil}, 1},
+		{1, []featurevector.Feature{nil, [2]interface{}{1, "word"}}, 3},
+		{1, []featurevector.Feature{nil, []interface{}{"word", nlp.Token("word")}}, 4},
+		{1, []featurevector.Feature{3, [2]interface{}{1, "word"}}, 13},
+		{1, []featurevector.Feature{5, [2]interface{}{2, "word"}}, 0},
+	} {
+		if score := loaded.TransitionScore(transition.ConstTransition(test.transition), test.features); score != test.score {
+			t.Errorf("transition %d of %v: got score %d, expected %d", test.transition, test.features, score, test.score)
+		}
+	}
+}
+
+func TestCompiledModelRoundTrip(t *testing.T) {
+	header := &app.ModelHeader{Version: app.MODEL_FORMAT_VERSION, Kind: app.MODEL_KIND_DEP, Labels: []string{"subj", "obj"}}
+	words := util.NewEnumSet(2)
+	words.Add("word")
+	data := &app.Serialization{WeightModel: testWeights(), EWord: words}
+	compiled, _, err := model.CompileMatrix(data.WeightModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := writeModel(t, header, data, compiled)
+	defer os.Remove(file)
+	if data.WeightModel == nil {
+		t.Errorf("expected the weights of the written model to be kept")
+	}
+	loaded, enums, loadedHeader, err := app.LoadModel(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.(io.Closer).Close()
+	if !reflect.DeepEqual(loadedHeader, header) {
+		t.Errorf("expected header %+v, got %+v", header, loadedHeader)
+	}
+	if enums.WeightModel != nil {
+		t.Errorf("expected no serialized weights in a compiled model")
+	}
+	if index, exists := enums.EWord.IndexOf("word"); !exists || index != 0 {
+		t.Errorf("expected the word enumeration, got %v", enums.EWord)
+	}
+	if !reflect.DeepEqual(loaded.(*model.CompiledMatrix).Sizes(), compiled.Sizes()) {
+		t.Errorf("expected table sizes %v, got %v", compiled.Sizes(), loaded.(*model.CompiledMatrix).Sizes())
+	}
+	readHeader, err := app.ReadModelHeader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(readHeader, header) {
+		t.Errorf("expected ReadModelHeader %+v, got %+v", header, readHeader)
+	}
+	if _, _, err := app.ReadModel(file); err == nil {
+		t.Errorf("expected an error reading a compiled model for training")
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	for _, test := range []struct {
+		bits    int
+		weights map[interface{}]map[int]int64
+		scale   int64
+		dropped int
+		values  map[int]int64
+	}{
+		// small weights keep a scale of 1
+		{8, map[interface{}]map[int]int64{1: {1: 100, 2: -127}}, 1, 0, map[int]int64{1: 100, 2: -127}},
+		// halves round away from 0
+		{8, map[interface{}]map[int]int64{1: {1: 254, 2: -3, 3: 4, 4: 5, 5: -1}}, 2, 0, map[int]int64{1: 254, 2: -4, 3: 4, 4: 6, 5: -2}},
+		{8, map[interface{}]map[int]int64{1: {1: 1000, 2: -500, 3: 3, 4: 4, 5: -4}}, 8, 1, map[int]int64{1: 1000, 2: -504, 3: 0, 4: 8, 5: -8}},
+		{16, map[interface{}]map[int]int64{1: {1: 65534, 2: -3, 3: 1}}, 2, 0, map[int]int64{1: 65534, 2: -4, 3: 2}},
+		{16, map[interface{}]map[int]int64{1: {1: 100, 2: -5}}, 1, 0, map[int]int64{1: 100, 2: -5}},
+	} {
+		compiled, _, err := model.CompileMatrix(&model.AvgMatrixSparseSerialized{Mat: []interface{}{test.weights}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dropped, err := compiled.Quantize(test.bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dropped != test.dropped {
+			t.Errorf("%v to %d bits: expected %d dropped, got %d", test.weights, test.bits, test.dropped, dropped)
+		}
+		table := compiled.Tables[0]
+		if table.Scale != test.scale {
+			t.Errorf("%v to %d bits: expected scale %d, got %d", test.weights, test.bits, test.scale, table.Scale)
+		}
+		if (test.bits == 8) != (table.Values8 != nil) || (test.bits == 16) != (table.Values16 != nil) || table.Values != nil {
+			t.Errorf("%v to %d bits: got weights of the wrong size", test.weights, test.bits)
+		}
+		for transition, value := range test.values {
+			if got := table.Value(transition, 1); got != value {
+				t.Errorf("%v to %d bits: transition %d expected %d, got %d", test.weights, test.bits, transition, value, got)
+			}
+		}
+		if _, err := compiled.Quantize(test.bits); err == nil {
+			t.Errorf("expected an error quantizing twice")
+		}
+	}
+	compiled, _, _ := model.CompileMatrix(testWeights())
+	if _, err := compiled.Quantize(4); err == nil {
+		t.Errorf("expected an error quantizing to 4 bits")
+	}
+}
+
+func TestReadQuantizedModel(t *testing.T) {
+	weights := &model.AvgMatrixSparseSerialized{
+		Mat: []interface{}{
+			map[interface{}]map[int]int64{
+				1: {1: 1000, 2: -500, 3: 3},
+				2: {1: 2},
+			},
+			map[interface{}]map[int]int64{
+				"word": {1: 7},
+			},
+		},
+	}
+	stats, err := model.PruneMatrix(weights, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.PrunedWeights != 4 || stats.PrunedFeatures != 2 {
+		t.Errorf("expected 4 weights of 2 features after pruning, got %d of %d", stats.PrunedWeights, stats.PrunedFeatures)
+	}
+	compiled, _, err := model.CompileMatrix(weights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped, err := compiled.Quantize(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 1 {
+		t.Errorf("expected the weight 3 to round to 0, got %d dropped", dropped)
+	}
+	file := writeModel(t, nil, &app.Serialization{}, compiled)
+	defer os.Remove(file)
+	loaded, _, _, err := app.LoadModel(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.(io.Closer).Close()
+	for _, test := range []struct {
+		transition int
+		features   []featurevector.Feature
+		score      int64
+	}{
+		// the scale of the first template is 8
+		{1, []featurevector.Feature{1, nil}, 1000},
+		{2, []featurevector.Feature{1, nil}, -504},
+		{3, []featurevector.Feature{1, nil}, 0},
+		{1, []featurevector.Feature{2, nil}, 0},
+		{1, []featurevector.Feature{nil, "word"}, 7},
+	} {
+		if score := loaded.TransitionScore(transition.ConstTransition(test.transition), test.features); score != test.score {
+			t.Errorf("transition %d of %v: got score %d, expected %d", test.transition, test.features, score, test.score)
+		}
+	}
+}
+
+func TestNewCompiledMatrixUnaligned(t *testing.T) {
+	for _, bits := range []int{0, 8, 16} {
+		compiled, _, err := model.CompileMatrix(testWeights())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bits > 0 {
+			if _, err := compiled.Quantize(bits); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var arrays bytes.Buffer
+		if err := compiled.WriteArrays(&arrays); err != nil {
+			t.Fatal(err)
+		}
+		sizes := compiled.Sizes()
+		if arrays.Len() != model.ArraysSize(sizes) {
+			t.Fatalf("%d bits: wrote %d bytes, expected %d", bits, arrays.Len(), model.ArraysSize(sizes))
+		}
+		// one byte in the arrays aren't aligned, so they are copied
+		buf := make([]byte, arrays.Len()+1)
+		copy(buf[1:], arrays.Bytes())
+		var released bool
+		loaded, err := model.NewCompiledMatrix(sizes, buf[1:], func() error { released = true; return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range buf {
+			buf[i] = 0xff
+		}
+		if !reflect.DeepEqual(loaded.Tables, compiled.Tables) {
+			t.Errorf("%d bits: expected the copied tables to equal the written ones", bits)
+		}
+		if err := loaded.Close(); err != nil || !released {
+			t.Errorf("%d bits: expected Close to release the arrays", bits)
+		}
+		if _, err := model.NewCompiledMatrix(sizes, arrays.Bytes()[1:], nil); err == nil {
+			t.Errorf("%d bits: expected an error for arrays of the wrong size", bits)
+		}
+	}
+}
+
+func TestCompiledMatchesAvgMatrixSparse(t *testing.T) {
+	avg := &model.AvgMatrixSparse{}
+	avg.Deserialize(testWeights())
+	compiled, _, err := model.CompileMatrix(testWeights())
+	if err != nil {
+		t.Fatal(err)
+	}
+	features := []interface{}{3, "word", [2]int{1, 2}, [2]interface{}{1, "word"}, nlp.Token("word"), 5, "other", [2]int{2, 1}}
+	for i := range avg.Mat {
+		for _, feature := range features {
+			for transition := 0; transition < 9; transition++ {
+				if expected, got := avg.Mat[i].Value(transition, feature), compiled.Tables[i].Value(transition, feature); got != expected {
+					t.Errorf("template %d transition %d of %v: expected %d, got %d", i, transition, feature, expected, got)
+				}
+			}
+			avgScores, compiledScores := &featurevector.MapStore{}, &featurevector.MapStore{}
+			avgScores.Init()
+			compiledScores.Init()
+			transitions := []int{0, 1, 2, 3, 4, 7, 8}
+			avgScores.SetTransitions(transitions)
+			compiledScores.SetTransitions(transitions)
+			templateFeatures := make([]featurevector.Feature, len(avg.Mat))
+			templateFeatures[i] = feature
+			avg.SetTransitionScores(templateFeatures, avgScores, false)
+			compiled.SetTransitionScores(templateFeatures, compiledScores, false)
+			if !reflect.DeepEqual(avgScores.ScoreMap(), compiledScores.ScoreMap()) {
+				t.Errorf("template %d scores of %v: expected %v, got %v", i, feature, avgScores.ScoreMap(), compiledScores.ScoreMap())
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TemplateStats are the counts and norms of the weights of a feature
+// template
+type TemplateStats struct {
+	Features, Weights int
+	L1, Max           int64
+	// sum of squares, a float64 as it overflows int64
+	L2 float64
+}
+
+func (s *TemplateStats) add(weight int64) {
+	magnitude := abs(weight)
+	s.Weights++
+	s.L1 += magnitude
+	s.L2 += float64(weight) * float64(weight)
+	if magnitude > s.Max {
+		s.Max = magnitude
+	}
+}
+
+// InspectMatrix returns the statistics of every feature template of a
+// serialized model by group of transitions. groupOf is the group of every
+// transition; the weights of transitions of other groups than groups are
+// skipped. The templates of every group are numbered from 0, so groups
+// share the weights of a template number and split them by the group of
+// the transition.
+func InspectMatrix(data *AvgMatrixSparseSerialized, groupOf, groups []byte) (map[byte][]TemplateStats, error) {
+	stats := make(map[byte][]TemplateStats, len(groups))
+	for _, g := range groups {
+		stats[g] = make([]TemplateStats, len(data.Mat))
+	}
+	for i, val := range data.Mat {
+		mat, ok := val.(map[interface{}]map[int]int64)
+		if !ok {
+			return nil, fmt.Errorf("unknown serialization %T of feature template %d", val, i)
+		}
+		for _, weights := range mat {
+			var seen [256]bool
+			for transition, weight := range weights {
+				if weight == 0 || transition < 0 || transition >= len(groupOf) {
+					continue
+				}
+				g := groupOf[transition]
+				if _, exists := stats[g]; !exists {
+					continue
+				}
+				stats[g][i].add(weight)
+				if !seen[g] {
+					seen[g] = true
+					stats[g][i].Features++
+				}
+			}
+		}
+	}
+	return stats, nil
+}
+
+// WeightedFeature is the weight of a feature of a template for a transition
+type WeightedFeature struct {
+	Template int
+	Feature  interface{}
+	Weight   int64
+}
+
+// TopFeatures returns up to top features of the first templates of a
+// serialized model with the largest positive weights for a transition, and
+// up to top with the largest negative weights, largest magnitude first.
+// Equal weights are ordered by name, which formats a feature. weighted is
+// the number of features with a weight for the transition.
+func TopFeatures(data *AvgMatrixSparseSerialized, transition, templates, top int, name func(WeightedFeature) string) (positive, negative []WeightedFeature, weighted int, err error) {
+	var features []WeightedFeature
+	for i := 0; i < templates && i < len(data.Mat); i++ {
+		mat, ok := data.Mat[i].(map[interface{}]map[int]int64)
+		if !ok {
+			return nil, nil, 0, fmt.Errorf("unknown serialization %T of feature template %d", data.Mat[i], i)
+		}
+		for feature, weights := range mat {
+			if weight := weights[transition]; weight != 0 {
+				features = append(features, WeightedFeature{i, feature, weight})
+			}
+		}
+	}
+	names := make([]string, len(features))
+	for j, w := range features {
+		names[j] = name(w)
+	}
+	order := make([]int, len(features))
+	for j := range order {
+		order[j] = j
+	}
+	sort.Slice(order, func(a, b int) bool {
+		wa, wb := abs(features[order[a]].Weight), abs(features[order[b]].Weight)
+		if wa != wb {
+			return wa > wb
+		}
+		return names[order[a]] < names[order[b]]
+	})
+	for _, j := range order {
+		switch w := features[j]; {
+		case w.Weight > 0 && len(positive) < top:
+			positive = append(positive, w)
+		case w.Weight < 0 && len(negative) < top:
+			negative = append(negative, w)
+		}
+	}
+	return positive, negative, len(features), nil
+}
@@ -0,0 +1,74 @@
+package model_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"yap/alg/transition/model"
+)
+
+func TestInspectMatrix(t *testing.T) {
+	data := &model.AvgMatrixSparseSerialized{Mat: []interface{}{
+		map[interface{}]map[int]int64{1: {0: 3, 1: -4, 2: 5}, 2: {0: -2, 1: 0}},
+		map[interface{}]map[int]int64{"word": {2: 1, 3: 7}},
+	}}
+	// transitions 0 and 1 are scored with group A, 2 with group M and 3
+	// with group P, which isn't inspected
+	stats, err := model.InspectMatrix(data, []byte("AAMP"), []byte("AM"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[byte][]model.TemplateStats{
+		'A': {{Features: 2, Weights: 3, L1: 9, Max: 4, L2: 29}, {}},
+		'M': {{Features: 1, Weights: 1, L1: 5, Max: 5, L2: 25}, {Features: 1, Weights: 1, L1: 1, Max: 1, L2: 1}},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected stats %+v, got %+v", expected, stats)
+	}
+	if _, err := model.InspectMatrix(&model.AvgMatrixSparseSerialized{Mat: []interface{}{"not weights"}}, nil, nil); err == nil {
+		t.Errorf("expected an error inspecting an unknown serialization")
+	}
+}
+
+func TestTopFeatures(t *testing.T) {
+	data := &model.AvgMatrixSparseSerialized{Mat: []interface{}{
+		map[interface{}]map[int]int64{1: {0: 3}, 2: {0: -4}, 3: {0: 3, 1: 9}, 4: {1: 1}},
+		map[interface{}]map[int]int64{"a": {0: -4}, "b": {0: 8}, "c": {0: 0}},
+		"beyond the templates of the transition",
+	}}
+	name := func(w model.WeightedFeature) string {
+		return fmt.Sprintf("%d:%v", w.Template, w.Feature)
+	}
+	for _, test := range []struct {
+		name               string
+		top                int
+		positive, negative []string
+	}{
+		{"all", 5, []string{"1:b 8", "0:1 3", "0:3 3"}, []string{"0:2 -4", "1:a -4"}},
+		{"ties by name", 1, []string{"1:b 8"}, []string{"0:2 -4"}},
+		{"none", 0, nil, nil},
+	} {
+		positive, negative, weighted, err := model.TopFeatures(data, 0, 2, test.top, name)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if weighted != 5 {
+			t.Errorf("%s: expected 5 weighted features, got %d", test.name, weighted)
+		}
+		format := func(features []model.WeightedFeature) (formatted []string) {
+			for _, w := range features {
+				formatted = append(formatted, fmt.Sprintf("%s %d", name(w), w.Weight))
+			}
+			return formatted
+		}
+		if got := format(positive); !reflect.DeepEqual(got, test.positive) {
+			t.Errorf("%s: expected top positive %v, got %v", test.name, test.positive, got)
+		}
+		if got := format(negative); !reflect.DeepEqual(got, test.negative) {
+			t.Errorf("%s: expected top negative %v, got %v", test.name, test.negative, got)
+		}
+	}
+	if _, _, _, err := model.TopFeatures(data, 0, 3, 1, name); err == nil {
+		t.Errorf("expected an error for an unknown serialization")
+	}
+}
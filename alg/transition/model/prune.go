@@ -0,0 +1,65 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PruneStats counts the weights of a model before and after pruning
+type PruneStats struct {
+	Features, Weights             int
+	PrunedFeatures, PrunedWeights int
+}
+
+func abs(value int64) int64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// PruneMatrix drops the weights of a serialized model whose magnitude is
+// below threshold and, if top is positive, all but the top largest weights
+// of every feature template; weights tied with the last one kept are kept
+// too. Features left without weights are dropped. The model is pruned in
+// place.
+func PruneMatrix(data *AvgMatrixSparseSerialized, threshold int64, top int) (PruneStats, error) {
+	var stats PruneStats
+	for i, val := range data.Mat {
+		mat, ok := val.(map[interface{}]map[int]int64)
+		if !ok {
+			return stats, fmt.Errorf("unknown serialization %T of feature template %d", val, i)
+		}
+		cut := threshold
+		if top > 0 {
+			magnitudes := make([]int64, 0, len(mat))
+			for _, weights := range mat {
+				for _, value := range weights {
+					magnitudes = append(magnitudes, abs(value))
+				}
+			}
+			if len(magnitudes) > top {
+				sort.Slice(magnitudes, func(a, b int) bool { return magnitudes[a] > magnitudes[b] })
+				if magnitudes[top-1] > cut {
+					cut = magnitudes[top-1]
+				}
+			}
+		}
+		for feature, weights := range mat {
+			stats.Features++
+			stats.Weights += len(weights)
+			for transition, value := range weights {
+				if value == 0 || abs(value) < cut {
+					delete(weights, transition)
+				}
+			}
+			if len(weights) == 0 {
+				delete(mat, feature)
+				continue
+			}
+			stats.PrunedFeatures++
+			stats.PrunedWeights += len(weights)
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,108 @@
+package model_test
+
+import (
+	"reflect"
+	"testing"
+	"yap/alg/transition/model"
+)
+
+type templateWeights map[interface{}]map[int]int64
+
+func TestPruneMatrix(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		weights   []templateWeights
+		threshold int64
+		top, bits int
+		pruned    []templateWeights
+		stats     model.PruneStats
+		// the weights of the pruned model quantized to bits
+		quantized []templateWeights
+		dropped   int
+	}{
+		{
+			name:      "threshold",
+			weights:   []templateWeights{{1: {1: 5, 2: -3, 3: 0}, 2: {1: 2}}},
+			threshold: 3,
+			pruned:    []templateWeights{{1: {1: 5, 2: -3}}},
+			stats:     model.PruneStats{Features: 2, Weights: 4, PrunedFeatures: 1, PrunedWeights: 2},
+		},
+		{
+			name:    "top with ties",
+			weights: []templateWeights{{1: {1: 5, 2: -4}, 2: {1: 4, 2: 1}}, {"word": {1: 1, 2: 2, 3: 3}}},
+			top:     2,
+			pruned:  []templateWeights{{1: {1: 5, 2: -4}, 2: {1: 4}}, {"word": {2: 2, 3: 3}}},
+			stats:   model.PruneStats{Features: 3, Weights: 7, PrunedFeatures: 3, PrunedWeights: 5},
+		},
+		{
+			name:    "top of fewer weights",
+			weights: []templateWeights{{1: {1: 5, 2: 0}}},
+			top:     3,
+			pruned:  []templateWeights{{1: {1: 5}}},
+			stats:   model.PruneStats{Features: 1, Weights: 2, PrunedFeatures: 1, PrunedWeights: 1},
+		},
+		{
+			name:      "threshold above top",
+			weights:   []templateWeights{{1: {1: 5, 2: -4, 3: 3}}},
+			threshold: 5,
+			top:       2,
+			pruned:    []templateWeights{{1: {1: 5}}},
+			stats:     model.PruneStats{Features: 1, Weights: 3, PrunedFeatures: 1, PrunedWeights: 1},
+		},
+		{
+			name:      "quantize",
+			weights:   []templateWeights{{1: {1: 1000, 2: -500, 3: 3, 4: 1}, 2: {1: 2}}, {"word": {1: 7}}},
+			threshold: 2,
+			top:       3,
+			bits:      8,
+			pruned:    []templateWeights{{1: {1: 1000, 2: -500, 3: 3}}, {"word": {1: 7}}},
+			stats:     model.PruneStats{Features: 3, Weights: 6, PrunedFeatures: 2, PrunedWeights: 4},
+			// the scale of the first template is 8, 3 rounds to 0
+			quantized: []templateWeights{{1: {1: 1000, 2: -504, 3: 0}}, {"word": {1: 7}}},
+			dropped:   1,
+		},
+	} {
+		data := &model.AvgMatrixSparseSerialized{Mat: make([]interface{}, len(test.weights))}
+		for i, weights := range test.weights {
+			data.Mat[i] = map[interface{}]map[int]int64(weights)
+		}
+		stats, err := model.PruneMatrix(data, test.threshold, test.top)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if stats != test.stats {
+			t.Errorf("%s: expected stats %+v, got %+v", test.name, test.stats, stats)
+		}
+		for i, pruned := range test.pruned {
+			if !reflect.DeepEqual(data.Mat[i], map[interface{}]map[int]int64(pruned)) {
+				t.Errorf("%s: template %d expected %v, got %v", test.name, i, pruned, data.Mat[i])
+			}
+		}
+		if test.bits == 0 {
+			continue
+		}
+		compiled, _, err := model.CompileMatrix(data)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		dropped, err := compiled.Quantize(test.bits)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if dropped != test.dropped {
+			t.Errorf("%s: expected %d dropped, got %d", test.name, test.dropped, dropped)
+		}
+		for i, quantized := range test.quantized {
+			for feature, weights := range quantized {
+				for transition, value := range weights {
+					if got := compiled.Tables[i].Value(transition, feature); got != value {
+						t.Errorf("%s: template %d transition %d of %v expected %d, got %d", test.name, i, transition, feature, value, got)
+					}
+				}
+			}
+		}
+	}
+	if _, err := model.PruneMatrix(&model.AvgMatrixSparseSerialized{Mat: []interface{}{"not weights"}}, 0, 1); err == nil {
+		t.Errorf("expected an error pruning an unknown serialization")
+	}
+}
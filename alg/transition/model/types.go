@@ -25,6 +25,13 @@ type Interface interface {
 	TransitionScore(transition Transition, features []Feature) int64
 }
 
+// Scorer sets the scores of the transitions in a store for the features of
+// a configuration; integrated uses the averaged weights of a model in
+// training
+type Scorer interface {
+	SetTransitionScores(features []Feature, scores ScoredStore, integrated bool)
+}
+
 func MakeFeature(transition, i int, feat interface{}) interface{} {
 	return [3]interface{}{transition, i, feat}
 }
@@ -31,6 +31,7 @@ var AppCommands = []*commander.Command{
 	//MALearnCmd(),
 	MACmd(),
 	HebMACmd(),
+	ModelCmd(),
 	// ValidateMAGoldCmd(),
 	// GenLemmasCmd(),
 	// GenUnAmbLemmasCmd(),
@@ -44,12 +45,22 @@ func AllCommands() *commander.Command {
 		Subcommands: AppCommands,
 		Flag:        *flag.NewFlagSet("app", flag.ExitOnError),
 	}
-	for _, app := range cmd.Subcommands {
+	wrapAppCommands(cmd.Subcommands)
+	return cmd
+}
+
+// wrapAppCommands adds the common flags to commands, and to the
+// subcommands of command groups such as model
+func wrapAppCommands(commands []*commander.Command) {
+	for _, app := range commands {
+		if app.Run == nil {
+			wrapAppCommands(app.Subcommands)
+			continue
+		}
 		app.Run = NewAppWrapCommand(app.Run)
 		app.Flag.IntVar(&CPUs, NUM_CPUS_FLAG, 0, "Max CPUS to use (runtime.GOMAXPROCS); 0 = all")
 		app.Flag.StringVar(&CPUProfile, "cpuprofile", "", "write cpu profile to file")
 	}
-	return cmd
 }
 
 func InitCommand() {
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"yap/alg/transition/model"
+	"yap/util"
+)
+
+// Compiled model files start with COMPILED_MODEL_MAGIC and the length of a
+// gob encoded compiledMeta, little endian. The arrays of the compiled
+// weights follow at the next multiple of 8 bytes, to be used in place from
+// the memory mapped file.
+const COMPILED_MODEL_MAGIC = "YAPCMODL"
+
+// compiledMeta is everything of a compiled model but its weights
+type compiledMeta struct {
+	Header *ModelHeader
+	// the enumerations of the model, without its weights
+	Enums *Serialization
+	Sizes []model.CompiledTableSize
+}
+
+// compiledArraysOffset is the offset of the arrays of a compiled model
+// whose metadata is of the given length
+func compiledArraysOffset(metaLen int) int {
+	n := len(COMPILED_MODEL_MAGIC) + 8 + metaLen
+	return n + (8-n%8)%8
+}
+
+// WriteCompiledModel writes a compiled model file of the header and
+// enumerations of a model with its compiled weights
+func WriteCompiledModel(file string, header *ModelHeader, data *Serialization, weights *model.CompiledMatrix) error {
+	enums := *data
+	enums.WeightModel = nil
+	var meta bytes.Buffer
+	if err := gob.NewEncoder(&meta).Encode(&compiledMeta{header, &enums, weights.Sizes()}); err != nil {
+		return err
+	}
+	fObj, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer fObj.Close()
+	writer := bufio.NewWriter(fObj)
+	writer.WriteString(COMPILED_MODEL_MAGIC)
+	var metaLen [8]byte
+	binary.LittleEndian.PutUint64(metaLen[:], uint64(meta.Len()))
+	writer.Write(metaLen[:])
+	metaEnd := len(COMPILED_MODEL_MAGIC) + len(metaLen) + meta.Len()
+	padding := compiledArraysOffset(meta.Len()) - metaEnd
+	meta.WriteTo(writer)
+	writer.Write(make([]byte, padding))
+	if err := weights.WriteArrays(writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return fObj.Close()
+}
+
+// readCompiledMeta reads the metadata of a compiled model
+func readCompiledMeta(data []byte) (*compiledMeta, int, error) {
+	prefix := len(COMPILED_MODEL_MAGIC) + 8
+	if len(data) < prefix || string(data[:len(COMPILED_MODEL_MAGIC)]) != COMPILED_MODEL_MAGIC {
+		return nil, 0, fmt.Errorf("not a compiled model")
+	}
+	metaLen := binary.LittleEndian.Uint64(data[len(COMPILED_MODEL_MAGIC):prefix])
+	if metaLen > uint64(len(data)-prefix) {
+		return nil, 0, fmt.Errorf("compiled model is truncated")
+	}
+	meta := &compiledMeta{}
+	if err := gob.NewDecoder(bytes.NewReader(data[prefix : prefix+int(metaLen)])).Decode(meta); err != nil {
+		return nil, 0, err
+	}
+	if meta.Header != nil && meta.Header.Version > MODEL_FORMAT_VERSION {
+		return nil, 0, fmt.Errorf("model format version %d is newer than the supported %d", meta.Header.Version, MODEL_FORMAT_VERSION)
+	}
+	if meta.Enums == nil {
+		meta.Enums = &Serialization{}
+	}
+	return meta, compiledArraysOffset(int(metaLen)), nil
+}
+
+// readCompiledHeader reads the header of a compiled model file
+func readCompiledHeader(reader io.Reader) (*ModelHeader, error) {
+	var prefix [len(COMPILED_MODEL_MAGIC) + 8]byte
+	if _, err := io.ReadFull(reader, prefix[:]); err != nil {
+		return nil, err
+	}
+	metaLen := binary.LittleEndian.Uint64(prefix[len(COMPILED_MODEL_MAGIC):])
+	meta := &compiledMeta{}
+	if err := gob.NewDecoder(io.LimitReader(reader, int64(metaLen))).Decode(meta); err != nil {
+		return nil, err
+	}
+	return meta.Header, nil
+}
+
+// isCompiledModel reports whether a model file is compiled
+func isCompiledModel(file string) (bool, error) {
+	fObj, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer fObj.Close()
+	magic := make([]byte, len(COMPILED_MODEL_MAGIC))
+	n, _ := io.ReadFull(fObj, magic)
+	return string(magic[:n]) == COMPILED_MODEL_MAGIC, nil
+}
+
+// LoadModel loads a model file for parsing, compiled or not. The weights of
+// a compiled model are used in place from the memory mapped file; the
+// returned Serialization has only the enumerations of the model.
+func LoadModel(file string) (model.Interface, *Serialization, *ModelHeader, error) {
+	compiled, err := isCompiledModel(file)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !compiled {
+		data, header, err := ReadModel(file)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		weights := &model.AvgMatrixSparse{}
+		weights.Deserialize(data.WeightModel)
+		data.WeightModel = nil
+		return weights, data, header, nil
+	}
+	data, unmap, err := util.MapFile(file)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	meta, offset, err := readCompiledMeta(data)
+	if err == nil && offset > len(data) {
+		err = fmt.Errorf("compiled model is truncated")
+	}
+	var weights *model.CompiledMatrix
+	if err == nil {
+		weights, err = model.NewCompiledMatrix(meta.Sizes, data[offset:], unmap)
+	}
+	if err != nil {
+		unmap()
+		return nil, nil, nil, fmt.Errorf("failed reading model %s: %v", file, err)
+	}
+	return weights, meta.Enums, meta.Header, nil
+}
@@ -48,13 +48,14 @@ func EstimatedBeamTransitions() int {
 	return ERel.Len()*2 + 2
 }
 
-func DepConfigOut(outModelFile string, b search.Interface, t transition.TransitionSystem) {
+func DepConfigOut(outModelFile string, b *search.Beam, t transition.TransitionSystem) {
 	log.Println("Configuration")
 	log.Printf("Beam:             \t%s", b.Name())
 	log.Printf("Transition System:\t%s", t.Name())
 	log.Printf("Iterations:\t\t%d", Iterations)
 	log.Printf("Beam Size:\t\t%d", BeamSize)
 	log.Printf("Beam Concurrent:\t%v", ConcurrentBeam)
+	log.Printf("Parse Workers:\t\t%d", parseWorkers())
 	log.Printf("Model file:\t\t%s", outModelFile)
 	log.Printf("Use Lemmas:\t\t%v", !lattice.IGNORE_LEMMA)
 	log.Printf("Word Type:\t\t%v", conll.WORD_TYPE)
@@ -135,11 +136,24 @@ func DepTrainAndParse(cmd *commander.Command, args []string) error {
 	} else {
 		REQUIRED_FLAGS = append(REQUIRED_FLAGS, "in")
 	}
+	if KBest > 1 {
+		if Stream {
+			return fmt.Errorf("-kbest is not supported with -stream")
+		}
+		VerifyFlags(cmd, []string{"okb"})
+	}
+	if Confidence && Stream {
+		return fmt.Errorf("-conf is not supported with -stream")
+	}
+	if Confidence && !useConllU {
+		return fmt.Errorf("-conf requires -conllu, the arc confidence is written to the MISC column")
+	}
 
 	// RegisterTypes()
 	var (
 		outModelFile string                           = fmt.Sprintf("%s.b%d", DepModelFile, BeamSize)
 		model        *transitionmodel.AvgMatrixSparse = &transitionmodel.AvgMatrixSparse{}
+		weights      transitionmodel.Interface
 		modelExists  bool
 	)
 	// search for model file locally or in data/ path
@@ -159,6 +173,11 @@ func DepTrainAndParse(cmd *commander.Command, args []string) error {
 	if allOut && !parseOut {
 		DepConfigOut(outModelFile, &search.Beam{}, transitionSystem)
 	}
+	if modelExists {
+		if err := ApplyModelHeader(cmd, outModelFile, MODEL_KIND_DEP); err != nil {
+			return err
+		}
+	}
 	// modelExists := false
 	relations, err := conf.ReadFile(DepLabelsFile)
 	if err != nil {
@@ -431,7 +450,11 @@ func DepTrainAndParse(cmd *commander.Command, args []string) error {
 			}
 			evaluator = MakeDepEvalStopCondition(sents, goldSents, testSents, asMorphGraphs, asMorphGoldGraphs, testAsMorphGraphs, decodeTestBeam, perceptron.InstanceDecoder(deterministic), BeamSize)
 		}
+		if modelHeader, err = NewModelHeader(MODEL_KIND_DEP); err != nil {
+			return err
+		}
 		_ = Train(goldSequences, Iterations, DepModelFile, model, perceptron.EarlyUpdateInstanceDecoder(beam), perceptron.InstanceDecoder(deterministic), evaluator)
+		weights = model
 		if allOut {
 			log.Println("Done Training")
 			log.Println()
@@ -441,7 +464,7 @@ func DepTrainAndParse(cmd *commander.Command, args []string) error {
 			model.Serialize(-1),
 			EWord, EPOS, EWPOS, EMHost, EMSuffix, EMorphProp, ETrans, ETokens,
 		}
-		WriteModel(outModelFile, serialization)
+		WriteModel(outModelFile, modelHeader, serialization)
 		if allOut {
 			log.Println("Done writing model")
 		}
@@ -449,8 +472,11 @@ func DepTrainAndParse(cmd *commander.Command, args []string) error {
 		if allOut && !parseOut {
 			log.Println("Found model file", outModelFile, " ... loading model")
 		}
-		serialization := ReadModel(outModelFile)
-		model.Deserialize(serialization.WeightModel)
+		var serialization *Serialization
+		weights, serialization, _, err = LoadModel(outModelFile)
+		if err != nil {
+			return err
+		}
 		EWord, EPOS, EWPOS, EMHost, EMSuffix = serialization.EWord, serialization.EPOS, serialization.EWPOS, serialization.EMHost, serialization.EMSuffix
 		if allOut && !parseOut {
 			log.Println("Loaded model")
@@ -562,7 +588,7 @@ func DepTrainAndParse(cmd *commander.Command, args []string) error {
 		TransFunc:            transitionSystem,
 		FeatExtractor:        extractor,
 		Base:                 conf,
-		Model:                model,
+		Model:                weights,
 		Size:                 BeamSize,
 		ConcurrentExec:       ConcurrentBeam,
 		ShortTempAgenda:      true,
@@ -592,12 +618,18 @@ func DepTrainAndParse(cmd *commander.Command, args []string) error {
 			log.Print("Parsing")
 		}
 
-		parsedGraphs := Parse(sents, beam)
+		parsedGraphs, agreements, err := ParseAndWriteKBest(sents, beam, RenderDepGraph)
+		if err != nil {
+			return err
+		}
 		if !parseOut {
 			log.Println("Converting to conll")
 		}
 		if useConllU {
 			graphAsConll := conllu.Graph2ConllUCorpus(parsedGraphs, EMHost, EMSuffix)
+			if Confidence {
+				SetArcConfidence(graphAsConll, parsedGraphs, agreements)
+			}
 			morphGraphs := conllu.MergeGraphAndMorphCorpus(graphAsConll, asMorphGraphs)
 			conllu.WriteFile(outConll, morphGraphs)
 			if !parseOut {
@@ -618,7 +650,10 @@ func DepTrainAndParse(cmd *commander.Command, args []string) error {
 		log.SetPrefix("")
 		log.SetFlags(0)
 		log.Print("Parsing started")
-		parsedGraphs := Parse(sents, beam)
+		parsedGraphs, _, err := ParseAndWriteKBest(sents, beam, RenderDepGraph)
+		if err != nil {
+			return err
+		}
 		graphAsConll := conll.Graph2ConllCorpus(parsedGraphs, EMHost, EMSuffix)
 		conll.WriteFile(outConll, graphAsConll)
 		log.Println("Wrote", len(parsedGraphs), "in conll format to", outConll)
@@ -626,6 +661,24 @@ func DepTrainAndParse(cmd *commander.Command, args []string) error {
 	return nil
 }
 
+// SetArcConfidence adds the confidence of the arc of every node of the
+// parsed graphs to the MISC column of their CoNLL-U rows
+func SetArcConfidence(sents, graphs []interface{}, agreements []*nlp.BeamAgreement) {
+	for i, sent := range sents {
+		graph := graphs[i].(nlp.LabeledDependencyGraph)
+		deps := sent.(conllu.Sentence).Deps
+		for _, nodeID := range graph.GetVertices() {
+			arc := graph.GetLabeledArc(nodeID)
+			row, exists := deps[nodeID+1]
+			if arc == nil || !exists {
+				continue
+			}
+			row.AppendMisc(fmt.Sprintf("ArcConfidence=%.3f", agreements[i].DepArc(arc)))
+			deps[nodeID+1] = row
+		}
+	}
+}
+
 func DepCmd() *commander.Command {
 	cmd := &commander.Command{
 		Run:       DepTrainAndParse,
@@ -652,6 +705,10 @@ runs dependency training/parsing
 	cmd.Flag.StringVar(&inputGold, "ing", "", "Optional - Dev Gold Parsed Sentences (for convergence)")
 	cmd.Flag.StringVar(&test, "test", "", "Test Conll File")
 	cmd.Flag.StringVar(&outConll, "oc", "", "Output Conll File")
+	cmd.Flag.StringVar(&outKBest, "okb", "", "Output K-Best Conll File (required with -kbest)")
+	cmd.Flag.IntVar(&KBest, "kbest", 1, "Number of distinct analyses per sentence written to the k-best file")
+	cmd.Flag.BoolVar(&Confidence, "conf", false, "Add the confidence of every arc to the MISC column of the CoNLL-U output (requires -conllu)")
+	cmd.Flag.IntVar(&ParseWorkers, "parse_workers", 1, "Number of sentences parsed concurrently; 0 = number of CPUs (GOMAXPROCS)")
 	cmd.Flag.StringVar(&DepFeaturesFile, "f", "zhangnivre2011.yaml", "Features Configuration File")
 	cmd.Flag.StringVar(&DepLabelsFile, "l", "hebtb.labels.conf", "Dependency Labels Configuration File")
 	//cmd.Flag.BoolVar(&conll.IGNORE_LEMMA, "nolemma", false, "Ignore lemmas")
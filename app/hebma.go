@@ -25,6 +25,7 @@ var (
 	HebMaXliter8out, HebMaAlwaysnnp   bool
 	HebMaNnpnofeats              bool
 	HebMaShowoov                 bool
+	HebMaUserLexiconFile         string
 	outJSON                 bool
 	HEB_MA_DEFAULT_DATA_DIRS       = []string{".", "data/bgulex"}
 )
@@ -90,6 +91,14 @@ func HebMA(cmd *commander.Command, args []string) error {
 	maData.LoadPrefixes(HebMaPrefixFile)
 	log.Println("Reading Morphological Analyzer BGU Lexicon")
 	maData.LoadLex(HebMaLexiconFile, HebMaNnpnofeats)
+	if len(HebMaUserLexiconFile) > 0 {
+		log.Println("Reading Morphological Analyzer User Lexicon")
+		userLex, err := ma.NewUserLex(HebMaUserLexiconFile, outFormat)
+		if err != nil {
+			panic(fmt.Sprintf("Failed reading user lexicon - %v", err))
+		}
+		maData.User = userLex
+	}
 	log.Println()
 	var (
 		sents        []nlp.BasicSentence
@@ -229,6 +238,7 @@ run lexicon-based morphological analyzer on raw input
 	}
 	cmd.Flag.StringVar(&HebMaPrefixFile, "prefix", "bgupreflex_withdef.utf8.hr", "Prefix file for morphological analyzer")
 	cmd.Flag.StringVar(&HebMaLexiconFile, "lexicon", "bgulex.utf8.hr", "Lexicon file for morphological analyzer")
+	cmd.Flag.StringVar(&HebMaUserLexiconFile, "userlexicon", "", "User lexicon file, consulted before the lexicon")
 	cmd.Flag.StringVar(&inRawFile, "raw", "", "Input raw (tokenized) file")
 	cmd.Flag.StringVar(&conlluFile, "conllu", "", "CoNLL-U-format input file")
 	cmd.Flag.StringVar(&outLatticeFile, "out", "", "Output lattice file")
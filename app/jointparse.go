@@ -92,7 +92,7 @@ func CombineToGoldMorphs(goldLats, ambLats []interface{}) ([]interface{}, int) {
 	return morphGraphs, numSentNoGold
 }
 
-func JointConfigOut(outModelFile string, b search.Interface, t transition.TransitionSystem) {
+func JointConfigOut(outModelFile string, b *search.Beam, t transition.TransitionSystem) {
 	log.Println("*** CONFIGURATION ***")
 	log.Printf("Beam:             \t%s", b.Name())
 	log.Printf("Transition System:\t%s", t.Name())
@@ -100,6 +100,7 @@ func JointConfigOut(outModelFile string, b search.Interface, t transition.Transi
 	log.Printf("Iterations:\t\t%d", Iterations)
 	log.Printf("Beam Size:\t\t%d", BeamSize)
 	log.Printf("Beam Concurrent:\t%v", ConcurrentBeam)
+	log.Printf("Parse Workers:\t\t%d", parseWorkers())
 	log.Printf("Parameter Func:\t%v", MdParamFuncName)
 	log.Printf("Use Lemmas:\t\t%v", !lattice.IGNORE_LEMMA)
 	log.Printf("Use POP:\t\t%v", UsePOP)
@@ -189,7 +190,7 @@ func JointTrainAndParse(cmd *commander.Command, args []string) error {
 
 	var (
 		arcSystem     transition.TransitionSystem
-		model         *transitionmodel.AvgMatrixSparse = &transitionmodel.AvgMatrixSparse{}
+		weights       transitionmodel.Interface
 		terminalStack int
 	)
 
@@ -223,6 +224,9 @@ func JointTrainAndParse(cmd *commander.Command, args []string) error {
 		outModelFile, modelExists = util.LocateFile(outModelFile, DEFAULT_MODEL_DIRS)
 	}
 	REQUIRED_FLAGS := []string{"in", "oc", "om", "os"}
+	if KBest > 1 {
+		REQUIRED_FLAGS = append(REQUIRED_FLAGS, "okb")
+	}
 	VerifyFlags(cmd, REQUIRED_FLAGS)
 
 	if !modelExists {
@@ -239,6 +243,13 @@ func JointTrainAndParse(cmd *commander.Command, args []string) error {
 	}
 
 	JointConfigOut(outModelFile, confBeam, transitionSystem)
+	if modelExists {
+		if err := ApplyModelHeader(cmd, outModelFile, MODEL_KIND_JOINT); err != nil {
+			return err
+		}
+		paramFunc = nlp.MDParams[MdParamFuncName]
+		mdTrans.ParamFunc = paramFunc
+	}
 
 	relations, err := conf.ReadFile(DepLabelsFile)
 	if err != nil {
@@ -626,6 +637,9 @@ func JointTrainAndParse(cmd *commander.Command, args []string) error {
 			// TODO: replace nil param with test sentences
 			evaluator = MakeJointEvalStopCondition(convAmbLat, convCombined, testAmbLat, testCombined, decodeTestBeam, perceptron.InstanceDecoder(deterministic), BeamSize)
 		}
+		if modelHeader, err = NewModelHeader(MODEL_KIND_JOINT); err != nil {
+			return err
+		}
 		_ = Train(goldSequences, Iterations, JointModelFile, model, perceptron.EarlyUpdateInstanceDecoder(beam), perceptron.InstanceDecoder(deterministic), evaluator)
 		search.AllOut = false
 		if allOut {
@@ -647,8 +661,11 @@ func JointTrainAndParse(cmd *commander.Command, args []string) error {
 		if allOut && !parseOut {
 			log.Println("Found model file", outModelFile, " ... loading model")
 		}
-		serialization := ReadModel(outModelFile)
-		model.Deserialize(serialization.WeightModel)
+		var serialization *Serialization
+		weights, serialization, _, err = LoadModel(outModelFile)
+		if err != nil {
+			return err
+		}
 		EWord, EPOS, EWPOS, EMHost, EMSuffix, EMorphProp, ETrans, ETokens = serialization.EWord, serialization.EPOS, serialization.EWPOS, serialization.EMHost, serialization.EMSuffix, serialization.EMorphProp, serialization.ETrans, serialization.ETokens
 		if allOut && !parseOut {
 			log.Println("Loaded model")
@@ -719,6 +736,10 @@ func JointTrainAndParse(cmd *commander.Command, args []string) error {
 		log.Println("Converting lattice format to internal structure")
 	}
 	predAmbLat := lattice.Lattice2SentenceCorpus(lAmb, EWord, EPOS, EWPOS, EMorphProp, EMHost, EMSuffix)
+	if err := ConstrainInput(predAmbLat); err != nil {
+		log.Println(err)
+		return err
+	}
 
 	if len(inputGold) > 0 {
 		log.Println("Reading test disambiguated lattice (for test ambiguous infusion)")
@@ -783,9 +804,12 @@ func JointTrainAndParse(cmd *commander.Command, args []string) error {
 		Transitions:          ETrans,
 		EstimatedTransitions: 1000, // chosen by random dice roll
 	}
-	beam.Model = model
+	beam.Model = weights
 	beam.ShortTempAgenda = true
-	parsedGraphs := Parse(predAmbLat, beam)
+	parsedGraphs, agreements, err := ParseAndWriteKBest(predAmbLat, beam, RenderMorphGraph)
+	if err != nil {
+		return err
+	}
 
 	if allOut {
 		log.Println("Converting", len(parsedGraphs), "to conll")
@@ -812,7 +836,11 @@ func JointTrainAndParse(cmd *commander.Command, args []string) error {
 
 		log.Println("Writing to mapping file")
 	}
-	mapping.WriteFile(outMap, GetInstances(parsedGraphs, GetJointMDConfig))
+	if Confidence {
+		mapping.WriteConfidenceFile(outMap, GetInstances(parsedGraphs, GetJointMDConfig), agreements)
+	} else {
+		mapping.WriteFile(outMap, GetInstances(parsedGraphs, GetJointMDConfig))
+	}
 	if allOut {
 		log.Println("Wrote", len(parsedGraphs), "in mapping format to", outMap)
 
@@ -845,12 +873,17 @@ runs morpho-syntactic training and parsing
 	cmd.Flag.StringVar(&tLatAmb, "tl", "", "Training Ambiguous Lattices File")
 	cmd.Flag.StringVar(&input, "in", "", "Dev Ambiguous Lattices File")
 	cmd.Flag.StringVar(&inputGold, "ing", "", "Optional - Gold Dev Lattices File (for infusion/convergence into dev ambiguous)")
+	cmd.Flag.StringVar(&inputConstraints, "constraints", "", "Optional - Partial annotations constraining the input (JSON array of token constraints per sentence line)")
 	cmd.Flag.StringVar(&test, "test", "", "Test Ambiguous Lattices File")
 	cmd.Flag.StringVar(&testGold, "testgold", "", "Optional - Gold Test Lattices File (for infusion into test ambiguous)")
 	cmd.Flag.StringVar(&outConll, "oc", "", "Output Conll File")
 	cmd.Flag.StringVar(&outSeg, "os", "", "Output Segmentation File")
 	cmd.Flag.StringVar(&outMap, "om", "", "Output Mapping File")
 	cmd.Flag.StringVar(&tSeg, "ots", "", "Output Training Segmentation File")
+	cmd.Flag.StringVar(&outKBest, "okb", "", "Output K-Best Conll File (required with -kbest)")
+	cmd.Flag.IntVar(&KBest, "kbest", 1, "Number of distinct analyses per sentence written to the k-best file")
+	cmd.Flag.IntVar(&ParseWorkers, "parse_workers", 1, "Number of sentences parsed concurrently; 0 = number of CPUs (GOMAXPROCS)")
+	cmd.Flag.BoolVar(&Confidence, "conf", false, "Add the confidence of every morpheme to the mapping output")
 	cmd.Flag.StringVar(&JointFeaturesFile, "f", "jointzeager.yaml", "Features Configuration File")
 	cmd.Flag.StringVar(&DepLabelsFile, "l", "hebtb.labels.conf", "Dependency Labels Configuration File")
 	cmd.Flag.StringVar(&MdParamFuncName, "p", "Funcs_Main_POS_Both_Prop", "Param Func types: ["+nlp.AllParamFuncNames+"]")
@@ -171,13 +171,14 @@ func conllul2Lattice(cl conllul.ConlluLattice) (lattice.Lattice) {
 }
 
 
-func MDConfigOut(outModelFile string, b search.Interface, t transition.TransitionSystem) {
+func MDConfigOut(outModelFile string, b *search.Beam, t transition.TransitionSystem) {
 	log.Println("Configuration")
 	log.Printf("Beam:\t\t%s", b.Name())
 	log.Printf("Transition System:\t%s", t.Name())
 	log.Printf("Iterations:\t\t%d", Iterations)
 	log.Printf("Beam Size:\t\t%d", BeamSize)
 	log.Printf("Beam Concurrent:\t%v", ConcurrentBeam)
+	log.Printf("Parse Workers:\t\t%d", parseWorkers())
 	log.Printf("Parameter Func:\t%v", MdParamFuncName)
 	log.Printf("Use POP:\t\t%v", UsePOP)
 	log.Printf("Infuse Gold Dev:\t%v", MdCombineGold)
@@ -259,6 +260,18 @@ func MDTrainAndParse(cmd *commander.Command, args []string) error {
 	} else {
 		REQUIRED_FLAGS = append(REQUIRED_FLAGS, "f")
 	}
+	if KBest > 1 {
+		if Stream {
+			return fmt.Errorf("-kbest is not supported with -stream")
+		}
+		REQUIRED_FLAGS = append(REQUIRED_FLAGS, "okb")
+	}
+	if Confidence && Stream {
+		return fmt.Errorf("-conf is not supported with -stream")
+	}
+	if len(inputConstraints) > 0 && Stream {
+		return fmt.Errorf("-constraints is not supported with -stream")
+	}
 	VerifyFlags(cmd, REQUIRED_FLAGS)
 
 	var (
@@ -290,6 +303,13 @@ func MDTrainAndParse(cmd *commander.Command, args []string) error {
 	}
 
 	MDConfigOut(outModelFile, confBeam, transitionSystem)
+	if modelExists {
+		if err := ApplyModelHeader(cmd, outModelFile, MODEL_KIND_MD); err != nil {
+			return err
+		}
+		paramFunc = nlp.MDParams[MdParamFuncName]
+		disambig.UsePOP = UsePOP
+	}
 
 	disambig.SwitchFormLemma = !lattice.IGNORE_LEMMA
 	if allOut {
@@ -647,6 +667,9 @@ func MDTrainAndParse(cmd *commander.Command, args []string) error {
 				evaluator = MakeMorphEvalStopCondition(convAmbLat, convCombined, testAmbLat, testCombined, decodeTestBeam, perceptron.InstanceDecoder(deterministic), BeamSize)
 			}
 		}
+		if modelHeader, err = NewModelHeader(MODEL_KIND_MD); err != nil {
+			return err
+		}
 		_ = Train(goldSequences, Iterations, MdModelFile, model, perceptron.EarlyUpdateInstanceDecoder(beam), perceptron.InstanceDecoder(deterministic), evaluator)
 
 		if allOut {
@@ -658,7 +681,7 @@ func MDTrainAndParse(cmd *commander.Command, args []string) error {
 				model.Serialize(-1),
 				EWord, EPOS, EWPOS, EMHost, EMSuffix, EMorphProp, ETrans, ETokens,
 			}
-			WriteModel(outModelFile, serialization)
+			WriteModel(outModelFile, modelHeader, serialization)
 			log.Println("Done")
 			// log.Print("Parsing test")
 		}
@@ -667,8 +690,10 @@ func MDTrainAndParse(cmd *commander.Command, args []string) error {
 	if allOut {
 		log.Println("Found model file", outModelFile, " ... loading model")
 	}
-	serialization := ReadModel(outModelFile)
-	model.Deserialize(serialization.WeightModel)
+	weights, serialization, _, err := LoadModel(outModelFile)
+	if err != nil {
+		return err
+	}
 	EWord, EPOS, EWPOS, EMHost, EMSuffix, EMorphProp, ETrans, ETokens = serialization.EWord, serialization.EPOS, serialization.EWPOS, serialization.EMHost, serialization.EMSuffix, serialization.EMorphProp, serialization.ETrans, serialization.ETokens
 
 	if MdUseWB {
@@ -722,7 +747,7 @@ func MDTrainAndParse(cmd *commander.Command, args []string) error {
 		}
 		predAmbLatStream := lattice.Lattice2SentenceStream(lAmb, EWord, EPOS, EWPOS, EMorphProp, EMHost, EMSuffix)
 		beam.ShortTempAgenda = true
-		beam.Model = model
+		beam.Model = weights
 		mappings := make(chan interface{}, 2)
 		if allOut {
 			log.Println("Starting parser")
@@ -774,6 +799,10 @@ func MDTrainAndParse(cmd *commander.Command, args []string) error {
 		}
 	}
 	predAmbLat := lattice.Lattice2SentenceCorpus(lAmb, EWord, EPOS, EWPOS, EMorphProp, EMHost, EMSuffix)
+	if err := ConstrainInput(predAmbLat); err != nil {
+		log.Println(err)
+		return err
+	}
 
 	if len(inputGold) > 0 {
 		log.Println("Reading test disambiguated lattice (for test ambiguous infusion)")
@@ -821,9 +850,12 @@ func MDTrainAndParse(cmd *commander.Command, args []string) error {
 		}
 	}
 	beam.ShortTempAgenda = true
-	beam.Model = model
+	beam.Model = weights
 
-	mappings := Parse(predAmbLat, beam)
+	mappings, agreements, err := ParseAndWriteKBest(predAmbLat, beam, RenderMDConfig)
+	if err != nil {
+		return err
+	}
 
 	/*	if allOut {
 			log.Println("Converting", len(parsedGraphs), "to conll")
@@ -850,9 +882,17 @@ func MDTrainAndParse(cmd *commander.Command, args []string) error {
 		log.Println("Writing to mapping file")
 	}
 	if useConllU {
-		mapping.UDWriteFile(outMap, mappings, clAmb)
+		if Confidence {
+			mapping.UDWriteConfidenceFile(outMap, mappings, clAmb, agreements)
+		} else {
+			mapping.UDWriteFile(outMap, mappings, clAmb)
+		}
 	} else {
-		mapping.WriteFile(outMap, mappings)
+		if Confidence {
+			mapping.WriteConfidenceFile(outMap, mappings, agreements)
+		} else {
+			mapping.WriteFile(outMap, mappings)
+		}
 	}
 
 	if allOut {
@@ -884,9 +924,14 @@ runs standalone morphological disambiguation training and parsing
 	cmd.Flag.StringVar(&tLatAmb, "tl", "", "Training Ambiguous Lattices File")
 	cmd.Flag.StringVar(&input, "in", "", "Dev-Test Ambiguous Lattices File")
 	cmd.Flag.StringVar(&inputGold, "ing", "", "Optional - Gold Dev-Test Lattices File (for infusion into dev-test ambiguous)")
+	cmd.Flag.StringVar(&inputConstraints, "constraints", "", "Optional - Partial annotations constraining the input (JSON array of token constraints per sentence line)")
 	cmd.Flag.StringVar(&test, "test", "", "Test Ambiguous Lattices File")
 	cmd.Flag.StringVar(&testGold, "testgold", "", "Optional - Gold Test Lattices File (for infusion into test ambiguous)")
 	cmd.Flag.StringVar(&outMap, "om", "", "Output Mapping File")
+	cmd.Flag.StringVar(&outKBest, "okb", "", "Output K-Best Mapping File (required with -kbest)")
+	cmd.Flag.IntVar(&KBest, "kbest", 1, "Number of distinct analyses per sentence written to the k-best file")
+	cmd.Flag.IntVar(&ParseWorkers, "parse_workers", 1, "Number of sentences parsed concurrently; 0 = number of CPUs (GOMAXPROCS)")
+	cmd.Flag.BoolVar(&Confidence, "conf", false, "Add the confidence of every morpheme to the mapping output")
 	cmd.Flag.StringVar(&MdFeaturesFile, "f", "standalone.md.yaml", "Features Configuration File")
 	cmd.Flag.StringVar(&MdParamFuncName, "p", "Funcs_Main_POS_Both_Prop", "Param Func types: ["+nlp.AllParamFuncNames+"]")
 	cmd.Flag.BoolVar(&AlignBeam, "align", false, "Use Beam Alignment")
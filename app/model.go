@@ -0,0 +1,92 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"yap/alg/transition/model"
+
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+)
+
+var (
+	modelInFile, modelOutFile string
+)
+
+// ModelCompile compiles a model file for parsing
+func ModelCompile(cmd *commander.Command, args []string) error {
+	VerifyFlags(cmd, []string{"in", "out"})
+	log.Println("Reading model", modelInFile)
+	data, header, err := ReadModel(modelInFile)
+	if err != nil {
+		return err
+	}
+	if header == nil {
+		log.Println("Model", modelInFile, "has no header, its settings won't be checked when parsing")
+	}
+	if data.WeightModel == nil {
+		return fmt.Errorf("model %s has no weights", modelInFile)
+	}
+	log.Println("Compiling", len(data.WeightModel.Mat), "feature templates")
+	weights, stats, err := model.CompileMatrix(data.WeightModel)
+	if err != nil {
+		return fmt.Errorf("failed compiling model %s: %v", modelInFile, err)
+	}
+	log.Printf("Compiled %d features with %d non-zero weights", stats.Features, stats.Weights)
+	if stats.Unhashable > 0 {
+		log.Printf("Dropped %d features that can't match when parsing (pointer keys)", stats.Unhashable)
+	}
+	if stats.Collisions > 0 {
+		log.Printf("Dropped %d features whose hash collides with another feature", stats.Collisions)
+	}
+	if err := WriteCompiledModel(modelOutFile, header, data, weights); err != nil {
+		return fmt.Errorf("failed writing compiled model %s: %v", modelOutFile, err)
+	}
+	inInfo, err := os.Stat(modelInFile)
+	if err != nil {
+		return err
+	}
+	outInfo, err := os.Stat(modelOutFile)
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote compiled model to %s (%d bytes, model was %d bytes)", modelOutFile, outInfo.Size(), inInfo.Size())
+	return nil
+}
+
+func ModelCompileCmd() *commander.Command {
+	cmd := &commander.Command{
+		Run:       ModelCompile,
+		UsageLine: "compile <file options>",
+		Short:     "compile a model into the inference only format",
+		Long: `
+compile a model into the inference only format
+
+	$ ./yap model compile -in <model file> -out <compiled model file>
+
+The compiled model drops the averaging history of the weights and stores
+them in flat arrays of hashed feature keys, which are memory mapped when
+the model is loaded. It is used in place of the original model file by
+md, dep, joint and api; it can't be trained further.
+
+`,
+		Flag: *flag.NewFlagSet("compile", flag.ExitOnError),
+	}
+	cmd.Flag.StringVar(&modelInFile, "in", "", "Model file")
+	cmd.Flag.StringVar(&modelOutFile, "out", "", "Output compiled model file")
+	return cmd
+}
+
+func ModelCmd() *commander.Command {
+	return &commander.Command{
+		UsageLine: "model <command>",
+		Short:     "convert and examine model files",
+		Subcommands: []*commander.Command{
+			ModelCompileCmd(),
+			ModelPruneCmd(),
+			ModelInspectCmd(),
+		},
+		Flag: *flag.NewFlagSet("model", flag.ExitOnError),
+	}
+}
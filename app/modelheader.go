@@ -0,0 +1,315 @@
+package app
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+	nlp "yap/nlp/types"
+	"yap/util"
+	"yap/util/conf"
+
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+)
+
+// Model files start with MODEL_MAGIC followed by a gob stream of the
+// ModelHeader and the Serialization. Files without the magic are models
+// written before headers were added: a bare Serialization.
+const (
+	MODEL_MAGIC          = "YAPMODEL"
+	MODEL_FORMAT_VERSION = 1
+
+	MODEL_KIND_MD    = "md"
+	MODEL_KIND_DEP   = "dep"
+	MODEL_KIND_JOINT = "joint"
+)
+
+// modelHeader is the header of the model being trained, written with every
+// intermediate model
+var modelHeader *ModelHeader
+
+// ModelHeader describes how a model was trained
+type ModelHeader struct {
+	Version int
+	// md, dep or joint
+	Kind       string
+	YapVersion string
+	Created    time.Time
+	// command line of the training run
+	Command []string
+
+	// feature configuration file, its MD5 and text
+	FeaturesFile string
+	FeaturesMD5  string
+	Features     string
+	// dependency labels, in enumeration order (dep and joint)
+	Labels []string
+
+	MdParamFunc    string
+	JointStrategy  string
+	OracleStrategy string
+	UsePOP         bool
+
+	// training data files with their MD5s
+	TrainingData []FileChecksum
+}
+
+type FileChecksum struct {
+	File string
+	MD5  string
+}
+
+// ModelSettings are the settings a model is loaded with
+type ModelSettings struct {
+	// md, dep or joint
+	Kind          string
+	FeaturesFile  string
+	LabelsFile    string
+	MdParamFunc   string
+	JointStrategy string
+	UsePOP        bool
+}
+
+// modelMismatch is a setting that differs from the one the model was
+// trained with; flag is the command line flag of the setting
+type modelMismatch struct {
+	flag, name     string
+	model, current string
+}
+
+func (m modelMismatch) String() string {
+	return fmt.Sprintf("%s is %s, the model was trained with %s", m.name, m.current, m.model)
+}
+
+// NewModelHeader describes a model of the given kind trained with the
+// current settings and training files
+func NewModelHeader(kind string) (*ModelHeader, error) {
+	settings := CurrentModelSettings(kind)
+	features, err := ioutil.ReadFile(settings.FeaturesFile)
+	if err != nil {
+		return nil, err
+	}
+	featuresMD5, err := util.MD5File(settings.FeaturesFile)
+	if err != nil {
+		return nil, err
+	}
+	header := &ModelHeader{
+		Version:      MODEL_FORMAT_VERSION,
+		Kind:         kind,
+		YapVersion:   VERSION,
+		Created:      time.Now(),
+		Command:      os.Args,
+		FeaturesFile: settings.FeaturesFile,
+		FeaturesMD5:  featuresMD5,
+		Features:     string(features),
+	}
+	if kind != MODEL_KIND_DEP {
+		header.MdParamFunc = MdParamFuncName
+		header.UsePOP = UsePOP
+	}
+	if kind == MODEL_KIND_JOINT {
+		header.JointStrategy = JointStrategy
+		header.OracleStrategy = OracleStrategy
+	}
+	if len(settings.LabelsFile) > 0 {
+		labels, err := conf.ReadFile(settings.LabelsFile)
+		if err != nil {
+			return nil, err
+		}
+		header.Labels = labels.Values
+	}
+	for _, file := range []string{tConll, tLatDis, tLatAmb} {
+		if len(file) == 0 {
+			continue
+		}
+		sum, err := util.MD5File(file)
+		if err != nil {
+			return nil, err
+		}
+		header.TrainingData = append(header.TrainingData, FileChecksum{file, sum})
+	}
+	return header, nil
+}
+
+// CurrentModelSettings returns the settings of the package flags a model
+// of the given kind is loaded with
+func CurrentModelSettings(kind string) ModelSettings {
+	settings := ModelSettings{
+		Kind:          kind,
+		MdParamFunc:   MdParamFuncName,
+		JointStrategy: JointStrategy,
+		UsePOP:        UsePOP,
+	}
+	switch kind {
+	case MODEL_KIND_MD:
+		settings.FeaturesFile = MdFeaturesFile
+	case MODEL_KIND_DEP:
+		settings.FeaturesFile = DepFeaturesFile
+		settings.LabelsFile = DepLabelsFile
+	case MODEL_KIND_JOINT:
+		settings.FeaturesFile = JointFeaturesFile
+		settings.LabelsFile = DepLabelsFile
+	}
+	return settings
+}
+
+// Check returns an error listing the settings that differ from those the
+// model was trained with. A nil header, of a model without one, is not
+// checked.
+func (h *ModelHeader) Check(s ModelSettings) error {
+	if h == nil {
+		return nil
+	}
+	mismatches, err := h.mismatches(s)
+	if err != nil {
+		return err
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	descriptions := make([]string, len(mismatches))
+	for i, m := range mismatches {
+		descriptions[i] = m.String()
+	}
+	return fmt.Errorf("%s model settings differ: %s", h.Kind, strings.Join(descriptions, "; "))
+}
+
+// mismatches compares the settings that affect parsing with a model of
+// the header's kind; the oracle strategy only affects training
+func (h *ModelHeader) mismatches(s ModelSettings) ([]modelMismatch, error) {
+	if h.Kind != s.Kind {
+		return []modelMismatch{{"", "model kind", h.Kind, s.Kind}}, nil
+	}
+	var mismatches []modelMismatch
+	featuresMD5, err := util.MD5File(s.FeaturesFile)
+	if err != nil {
+		return nil, err
+	}
+	if featuresMD5 != h.FeaturesMD5 {
+		mismatches = append(mismatches, modelMismatch{"f", "feature configuration",
+			fmt.Sprintf("%s (md5 %s)", h.FeaturesFile, h.FeaturesMD5),
+			fmt.Sprintf("%s (md5 %s)", s.FeaturesFile, featuresMD5)})
+	}
+	if h.Kind != MODEL_KIND_MD {
+		labels, err := conf.ReadFile(s.LabelsFile)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Join(labels.Values, " ") != strings.Join(h.Labels, " ") {
+			mismatches = append(mismatches, modelMismatch{"l", "label set",
+				fmt.Sprintf("%v", h.Labels),
+				fmt.Sprintf("%v of %s", labels.Values, s.LabelsFile)})
+		}
+	}
+	if h.Kind != MODEL_KIND_DEP {
+		if s.MdParamFunc != h.MdParamFunc {
+			mismatches = append(mismatches, modelMismatch{"p", "param func", h.MdParamFunc, s.MdParamFunc})
+		}
+		if s.UsePOP != h.UsePOP {
+			mismatches = append(mismatches, modelMismatch{"pop", "POP", fmt.Sprint(h.UsePOP), fmt.Sprint(s.UsePOP)})
+		}
+	}
+	if h.Kind == MODEL_KIND_JOINT && s.JointStrategy != h.JointStrategy {
+		mismatches = append(mismatches, modelMismatch{"jointstr", "joint strategy", h.JointStrategy, s.JointStrategy})
+	}
+	return mismatches, nil
+}
+
+// ApplyModelHeader checks the settings of a command against the header of
+// a model file: settings given on the command line must agree with the
+// model, the others are set from it. Models without a header are not
+// checked.
+func ApplyModelHeader(cmd *commander.Command, file, kind string) error {
+	header, err := ReadModelHeader(file)
+	if err != nil {
+		return err
+	}
+	if header == nil {
+		log.Println("Model", file, "has no header, its settings are not checked")
+		return nil
+	}
+	given := make(map[string]bool)
+	cmd.Flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	overrides := map[string]func(){
+		"p":        func() { MdParamFuncName = header.MdParamFunc },
+		"pop":      func() { UsePOP = header.UsePOP },
+		"jointstr": func() { JointStrategy = header.JointStrategy },
+	}
+	mismatches, err := header.mismatches(CurrentModelSettings(kind))
+	if err != nil {
+		return err
+	}
+	var conflicts []string
+	for _, m := range mismatches {
+		override, exists := overrides[m.flag]
+		if !exists || given[m.flag] {
+			if len(m.flag) > 0 {
+				conflicts = append(conflicts, fmt.Sprintf("-%s: %v", m.flag, m))
+			} else {
+				conflicts = append(conflicts, m.String())
+			}
+			continue
+		}
+		override()
+		log.Printf("Using %s %s of model %s", m.name, m.model, file)
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("model %s was trained with other settings: %s", file, strings.Join(conflicts, "; "))
+	}
+	if _, exists := nlp.MDParams[MdParamFuncName]; !exists && kind != MODEL_KIND_DEP {
+		return fmt.Errorf("param func %s of model %s doesn't exist", MdParamFuncName, file)
+	}
+	return nil
+}
+
+// ReadModelHeader reads only the header of a model file; it is nil for
+// models without one
+func ReadModelHeader(file string) (*ModelHeader, error) {
+	fObj, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fObj.Close()
+	reader := bufio.NewReader(fObj)
+	var header *ModelHeader
+	if magic, _ := reader.Peek(len(COMPILED_MODEL_MAGIC)); string(magic) == COMPILED_MODEL_MAGIC {
+		header, err = readCompiledHeader(reader)
+	} else {
+		header, _, err = readModelHeader(reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading model %s: %v", file, err)
+	}
+	return header, nil
+}
+
+// readModelHeader reads the header at the start of a model file, if any,
+// and returns the decoder of the rest of the file; compiled models have no
+// gob encoded weights to decode
+func readModelHeader(reader *bufio.Reader) (*ModelHeader, *gob.Decoder, error) {
+	decoder := gob.NewDecoder(reader)
+	magic, err := reader.Peek(len(MODEL_MAGIC))
+	if string(magic) == COMPILED_MODEL_MAGIC {
+		return nil, nil, fmt.Errorf("compiled models are inference only, use the model it was compiled from")
+	}
+	if err != nil || string(magic) != MODEL_MAGIC {
+		// a headerless model; a short file fails decoding
+		return nil, decoder, nil
+	}
+	reader.Discard(len(MODEL_MAGIC))
+	header := &ModelHeader{}
+	if err := decoder.Decode(header); err != nil {
+		return nil, nil, err
+	}
+	if header.Version > MODEL_FORMAT_VERSION {
+		return nil, nil, fmt.Errorf("model format version %d is newer than the supported %d", header.Version, MODEL_FORMAT_VERSION)
+	}
+	return header, decoder, nil
+}
@@ -0,0 +1,202 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"yap/alg/transition"
+	transitionmodel "yap/alg/transition/model"
+
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+)
+
+var (
+	inspectFeaturesFile, inspectTransition string
+	inspectTop                             int
+)
+
+// transitionGroup returns the extractor group of the feature templates a
+// transition is scored with: dep transitions use the arc templates, MD
+// transitions those of their state (POP or morpheme; lemma transitions
+// aren't in use)
+func transitionGroup(kind, name string) byte {
+	if kind == MODEL_KIND_DEP {
+		return 'A'
+	}
+	if name == "POP" {
+		return 'P'
+	}
+	if kind == MODEL_KIND_JOINT {
+		switch {
+		case name == "NO" || name == "IDLE" || name == "SH" || name == "RE" || name == "PR" || name == "AL" || name == "AR",
+			strings.HasPrefix(name, "LA-"), strings.HasPrefix(name, "RA-"):
+			return 'A'
+		}
+	}
+	return 'M'
+}
+
+// extractorGroups are the extractor groups of a kind of model, as set up
+// for parsing
+func extractorGroups(kind string) []byte {
+	switch kind {
+	case MODEL_KIND_DEP:
+		return []byte("A")
+	case MODEL_KIND_JOINT:
+		return []byte("MPLA")
+	}
+	return []byte("MPL")
+}
+
+// formatFeature formats the value of a feature stored in a model; values
+// the template can't format are printed as is
+func formatFeature(template transition.FeatureTemplate, feature interface{}) (formatted string) {
+	defer func() {
+		if r := recover(); r != nil {
+			formatted = fmt.Sprintf("%v", feature)
+		}
+	}()
+	// generated features are stored one generated value at a time
+	return template.FormatWithGenerator(feature, false)
+}
+
+// ModelInspect prints the statistics of the feature templates of a model
+// and the features with the largest weights for a transition
+func ModelInspect(cmd *commander.Command, args []string) error {
+	VerifyFlags(cmd, []string{"in"})
+	data, header, err := ReadModel(modelInFile)
+	if err != nil {
+		return err
+	}
+	if data.WeightModel == nil {
+		return fmt.Errorf("model %s has no weights", modelInFile)
+	}
+	kind := modelKind
+	if header != nil {
+		if len(kind) > 0 && kind != header.Kind {
+			return fmt.Errorf("-kind is %s, model %s is a %s model", kind, modelInFile, header.Kind)
+		}
+		kind = header.Kind
+	}
+	switch kind {
+	case MODEL_KIND_MD, MODEL_KIND_DEP, MODEL_KIND_JOINT:
+	case "":
+		return fmt.Errorf("model %s has no header, -kind is required", modelInFile)
+	default:
+		return fmt.Errorf("unknown model kind %s", kind)
+	}
+	var setup *transition.FeatureSetup
+	switch {
+	case len(inspectFeaturesFile) > 0:
+		if setup, err = transition.LoadFeatureConfFile(inspectFeaturesFile); err != nil {
+			return err
+		}
+	case header != nil:
+		log.Println("Using feature configuration", header.FeaturesFile, "of model", modelInFile)
+		setup = transition.LoadFeatureConf([]byte(header.Features))
+	default:
+		return fmt.Errorf("model %s has no header, -f is required", modelInFile)
+	}
+	EWord, EPOS, EWPOS, EMHost, EMSuffix, EMorphProp, ETrans, ETokens = data.EWord, data.EPOS, data.EWPOS, data.EMHost, data.EMSuffix, data.EMorphProp, data.ETrans, data.ETokens
+	groups := extractorGroups(kind)
+	extractor := SetupExtractor(setup, groups)
+	mat := data.WeightModel.Mat
+	if NumFeatures != len(mat) {
+		log.Printf("Feature configuration has %d templates, model %s has %d", NumFeatures, modelInFile, len(mat))
+	}
+	groupOf := make([]byte, ETrans.Len())
+	for i := range groupOf {
+		groupOf[i] = transitionGroup(kind, fmt.Sprintf("%v", ETrans.ValueOf(i)))
+	}
+
+	stats, err := transitionmodel.InspectMatrix(data.WeightModel, groupOf, groups)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s model %s: %d transitions, %d feature templates\n\n", kind, modelInFile, ETrans.Len(), len(mat))
+	fmt.Printf("%-5s %3s %9s %9s %12s %12s %10s  %s\n", "group", "#", "features", "weights", "L1", "L2", "max", "template")
+	for _, g := range groups {
+		for i, template := range extractor.TransTypeGroups[g].FeatureTemplates {
+			if i >= len(mat) {
+				break
+			}
+			s := stats[g][i]
+			fmt.Printf("%-5c %3d %9d %9d %12d %12.1f %10d  %s\n", g, i, s.Features, s.Weights, s.L1, math.Sqrt(s.L2), s.Max, template)
+		}
+	}
+
+	if len(inspectTransition) == 0 {
+		return nil
+	}
+	transitionIndex := -1
+	for i := 0; i < ETrans.Len(); i++ {
+		if fmt.Sprintf("%v", ETrans.ValueOf(i)) == inspectTransition {
+			transitionIndex = i
+			break
+		}
+	}
+	if transitionIndex < 0 {
+		names := make([]string, 0, 20)
+		for i := 0; i < ETrans.Len() && i < cap(names); i++ {
+			names = append(names, fmt.Sprintf("%v", ETrans.ValueOf(i)))
+		}
+		return fmt.Errorf("model %s has no transition %s, its transitions start with: %s", modelInFile, inspectTransition, strings.Join(names, " "))
+	}
+	g := groupOf[transitionIndex]
+	templates := extractor.TransTypeGroups[g].FeatureTemplates
+	name := func(w transitionmodel.WeightedFeature) string {
+		template := templates[w.Template]
+		return fmt.Sprintf("%s = %s", template, formatFeature(template, w.Feature))
+	}
+	positive, negative, weighted, err := transitionmodel.TopFeatures(data.WeightModel, transitionIndex, len(templates), inspectTop, name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nTransition %s (%d, group %c): %d weighted features\n", inspectTransition, transitionIndex, g, weighted)
+	fmt.Println("\nTop positive:")
+	for _, w := range positive {
+		fmt.Printf("%10d  %s\n", w.Weight, name(w))
+	}
+	fmt.Println("\nTop negative:")
+	for _, w := range negative {
+		fmt.Printf("%10d  %s\n", w.Weight, name(w))
+	}
+	return nil
+}
+
+func ModelInspectCmd() *commander.Command {
+	cmd := &commander.Command{
+		Run:       ModelInspect,
+		UsageLine: "inspect <file options>",
+		Short:     "print the feature templates and top features of a model",
+		Long: `
+print the feature templates and top features of a model
+
+	$ ./yap model inspect -in <model file> [-f <features file>] [-t <transition> [-top <n>]]
+
+Prints the number of features and weights of every feature template with
+the L1 norm, L2 norm and largest magnitude of its weights. Templates are
+grouped as the extractor groups them: A for arcs, M for morphemes and P
+for POP.
+
+With -t the features with the largest positive and negative weights for
+the transition are printed, formatted with the enumerations of the model,
+e.g. -t RA-subj for a dep model or the projection of a morpheme for an
+MD transition.
+
+The feature configuration is read from the model header unless -f is
+given; models without a header need -f and -kind. Compiled models keep
+only the hashes of features, inspect the model they were compiled from.
+
+`,
+		Flag: *flag.NewFlagSet("inspect", flag.ExitOnError),
+	}
+	cmd.Flag.StringVar(&modelInFile, "in", "", "Model file")
+	cmd.Flag.StringVar(&inspectFeaturesFile, "f", "", "Optional - Features Configuration File (default: that of the model header)")
+	cmd.Flag.StringVar(&modelKind, "kind", "", "Model kind [md, dep, joint], for models without a header")
+	cmd.Flag.StringVar(&inspectTransition, "t", "", "Optional - Transition to print the top features of")
+	cmd.Flag.IntVar(&inspectTop, "top", 20, "Number of top positive and negative features")
+	return cmd
+}
@@ -0,0 +1,304 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"yap/alg/transition/model"
+	"yap/eval"
+	"yap/nlp/format/conll"
+	"yap/nlp/format/lattice"
+
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+)
+
+var (
+	pruneThreshold           int64
+	pruneTop, quantize       int
+	modelKind                string
+	pruneDevIn, pruneDevGold string
+)
+
+// ModelPrune prunes and quantizes the weights of a model, and compares the
+// accuracy of the original and the pruned model on a dev set
+func ModelPrune(cmd *commander.Command, args []string) error {
+	VerifyFlags(cmd, []string{"in", "out"})
+	if pruneThreshold < 0 || pruneTop < 0 {
+		return fmt.Errorf("-threshold and -top can't be negative")
+	}
+	if quantize != 0 && quantize != 8 && quantize != 16 {
+		return fmt.Errorf("-quantize must be 0, 8 or 16, not %d", quantize)
+	}
+	if len(pruneDevIn) > 0 != (len(pruneDevGold) > 0) {
+		return fmt.Errorf("-dev_in and -dev_gold must be given together")
+	}
+	log.Println("Reading model", modelInFile)
+	data, header, err := ReadModel(modelInFile)
+	if err != nil {
+		return err
+	}
+	if data.WeightModel == nil {
+		return fmt.Errorf("model %s has no weights", modelInFile)
+	}
+	kind := modelKind
+	if header != nil {
+		if len(kind) > 0 && kind != header.Kind {
+			return fmt.Errorf("-kind is %s, model %s is a %s model", kind, modelInFile, header.Kind)
+		}
+		kind = header.Kind
+	}
+	if len(pruneDevIn) > 0 {
+		switch kind {
+		case MODEL_KIND_MD, MODEL_KIND_DEP, MODEL_KIND_JOINT:
+		case "":
+			return fmt.Errorf("model %s has no header, -kind is required to parse the dev set", modelInFile)
+		default:
+			return fmt.Errorf("unknown model kind %s", kind)
+		}
+	}
+
+	stats, err := model.PruneMatrix(data.WeightModel, pruneThreshold, pruneTop)
+	if err != nil {
+		return fmt.Errorf("failed pruning model %s: %v", modelInFile, err)
+	}
+	log.Printf("Kept %d of %d weights of %d of %d features", stats.PrunedWeights, stats.Weights, stats.PrunedFeatures, stats.Features)
+	if quantize == 0 {
+		if err := writeModel(modelOutFile, header, data); err != nil {
+			return fmt.Errorf("failed writing model %s: %v", modelOutFile, err)
+		}
+	} else {
+		weights, compileStats, err := model.CompileMatrix(data.WeightModel)
+		if err != nil {
+			return fmt.Errorf("failed compiling model %s: %v", modelInFile, err)
+		}
+		if dropped := compileStats.Unhashable + compileStats.Collisions; dropped > 0 {
+			log.Printf("Dropped %d features that can't be compiled", dropped)
+		}
+		dropped, err := weights.Quantize(quantize)
+		if err != nil {
+			return err
+		}
+		log.Printf("Quantized weights to %d bits, dropped %d that round to 0", quantize, dropped)
+		if err := WriteCompiledModel(modelOutFile, header, data, weights); err != nil {
+			return fmt.Errorf("failed writing compiled model %s: %v", modelOutFile, err)
+		}
+	}
+	inInfo, err := os.Stat(modelInFile)
+	if err != nil {
+		return err
+	}
+	outInfo, err := os.Stat(modelOutFile)
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote pruned model to %s (%d bytes, model was %d bytes)", modelOutFile, outInfo.Size(), inInfo.Size())
+
+	if len(pruneDevIn) == 0 {
+		return nil
+	}
+	dir, err := ioutil.TempDir("", "yap-prune")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	log.Println("Parsing dev set", pruneDevIn, "with the original model")
+	original, err := devScores(kind, modelInFile, filepath.Join(dir, "original"), args)
+	if err != nil {
+		return err
+	}
+	log.Println("Parsing dev set", pruneDevIn, "with the pruned model")
+	pruned, err := devScores(kind, modelOutFile, filepath.Join(dir, "pruned"), args)
+	if err != nil {
+		return err
+	}
+	for i, metric := range devMetrics(kind) {
+		log.Printf("Dev %s: original %.4f, pruned %.4f (%+.4f)", metric, original[i], pruned[i], pruned[i]-original[i])
+	}
+	return nil
+}
+
+// devMetrics are the names of the scores devScores returns for a kind of
+// model; joint models are scored on their morphemes, as in training
+func devMetrics(kind string) []string {
+	if kind == MODEL_KIND_DEP {
+		return []string{"UAS", "LAS"}
+	}
+	return []string{"morpheme F1"}
+}
+
+// devScores parses the dev set with a model by running the command of its
+// kind with args, writing output files with the given prefix, and scores
+// the output against the gold dev set
+func devScores(kind, file, prefix string, args []string) ([]float64, error) {
+	var cmd *commander.Command
+	switch kind {
+	case MODEL_KIND_MD:
+		cmd = MdCmd()
+	case MODEL_KIND_DEP:
+		cmd = DepCmd()
+	case MODEL_KIND_JOINT:
+		cmd = JointCmd()
+	}
+	// a new command resets the flag variables to their defaults
+	if err := cmd.Flag.Parse(args); err != nil {
+		return nil, err
+	}
+	output := prefix + ".out"
+	flags := map[string]string{"in": pruneDevIn}
+	switch kind {
+	case MODEL_KIND_MD:
+		flags["om"] = output
+	case MODEL_KIND_DEP:
+		flags["oc"] = output
+	case MODEL_KIND_JOINT:
+		flags["om"], flags["oc"], flags["os"] = output, prefix+".conll", prefix+".seg"
+		flags["m"] = file
+	}
+	if kind != MODEL_KIND_JOINT {
+		// md and dep load {m}.b{b}; -mn is only looked up in the default
+		// model directories, where an absolute path is never found
+		location, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		link := fmt.Sprintf("%s.b%d", prefix, BeamSize)
+		if err := os.Symlink(location, link); err != nil {
+			return nil, err
+		}
+		flags["m"], flags["mn"] = prefix, link
+	}
+	for name, value := range flags {
+		if err := cmd.Flag.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := cmd.Run(cmd, nil); err != nil {
+		return nil, err
+	}
+	if kind == MODEL_KIND_DEP {
+		return depScores(output, pruneDevGold)
+	}
+	return morphScores(output, pruneDevGold)
+}
+
+// morphScores returns the F1 of the morphemes of a mapping file, compared
+// with those of the gold mapping by token, form, POS and features
+func morphScores(file, goldFile string) ([]float64, error) {
+	test, err := lattice.ReadFile(file, 0)
+	if err != nil {
+		return nil, err
+	}
+	gold, err := lattice.ReadFile(goldFile, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(test) != len(gold) {
+		return nil, fmt.Errorf("%s has %d sentences, gold %s has %d", file, len(test), goldFile, len(gold))
+	}
+	total := &eval.Total{}
+	for i, sent := range test {
+		total.Add(compareMorphs(sent, gold[i]))
+	}
+	return []float64{total.F1()}, nil
+}
+
+// compareMorphs counts the morphemes of a sentence as in
+// nlp.Spellout.Compare: TN are the gold morphemes that weren't found
+func compareMorphs(test, gold lattice.Lattice) *eval.Result {
+	key := func(e lattice.Edge) string {
+		return fmt.Sprintf("%d\t%s\t%s\t%s", e.Token, e.Word, e.PosTag, e.FeatStr)
+	}
+	result := &eval.Result{}
+	goldMorphs := make(map[string]int)
+	for _, edges := range gold {
+		for _, e := range edges {
+			goldMorphs[key(e)]++
+		}
+	}
+	for _, edges := range test {
+		for _, e := range edges {
+			if goldMorphs[key(e)] > 0 {
+				goldMorphs[key(e)]--
+				result.TP++
+			} else {
+				result.FP++
+			}
+		}
+	}
+	for _, count := range goldMorphs {
+		result.TN += count
+	}
+	return result
+}
+
+// depScores returns the UAS and LAS of a conll file against the gold file
+func depScores(file, goldFile string) ([]float64, error) {
+	test, err := conll.ReadFile(file, 0)
+	if err != nil {
+		return nil, err
+	}
+	gold, err := conll.ReadFile(goldFile, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(test) != len(gold) {
+		return nil, fmt.Errorf("%s has %d sentences, gold %s has %d", file, len(test), goldFile, len(gold))
+	}
+	var tokens, unlabeled, labeled int
+	for i, sent := range gold {
+		for id, goldRow := range sent {
+			tokens++
+			row, exists := test[i][id]
+			if !exists || row.Head != goldRow.Head {
+				continue
+			}
+			unlabeled++
+			if row.DepRel == goldRow.DepRel {
+				labeled++
+			}
+		}
+	}
+	if tokens == 0 {
+		return nil, fmt.Errorf("gold %s has no tokens", goldFile)
+	}
+	return []float64{float64(unlabeled) / float64(tokens), float64(labeled) / float64(tokens)}, nil
+}
+
+func ModelPruneCmd() *commander.Command {
+	cmd := &commander.Command{
+		Run:       ModelPrune,
+		UsageLine: "prune <file options> [-- <md, dep or joint options>]",
+		Short:     "prune and quantize the weights of a model",
+		Long: `
+prune and quantize the weights of a model
+
+	$ ./yap model prune -in <model file> -out <pruned model file> [-threshold <n>] [-top <n>] [-quantize 8|16] [-dev_in <file> -dev_gold <file>] [-- <options>]
+
+Weights whose magnitude is below -threshold are dropped, and with -top
+only the n largest weights of every feature template are kept. The pruned
+model is written like the original, or with -quantize as a compiled model
+(see yap model compile) whose weights are 8 or 16 bit integers scaled per
+feature template.
+
+With -dev_in and -dev_gold the dev set is parsed with the original and the
+pruned model and their accuracy is reported: morpheme F1 against a gold
+mapping file for md and joint models, UAS and LAS against a gold conll file
+for dep models. The options after -- are passed to the md, dep or joint
+command, e.g. -f and -l of models without a header.
+
+`,
+		Flag: *flag.NewFlagSet("prune", flag.ExitOnError),
+	}
+	cmd.Flag.StringVar(&modelInFile, "in", "", "Model file")
+	cmd.Flag.StringVar(&modelOutFile, "out", "", "Output pruned model file")
+	cmd.Flag.Int64Var(&pruneThreshold, "threshold", 0, "Drop weights whose magnitude is below the threshold")
+	cmd.Flag.IntVar(&pruneTop, "top", 0, "Keep only the n largest weights of every feature template; 0 = all")
+	cmd.Flag.IntVar(&quantize, "quantize", 0, "Quantize weights to 8 or 16 bits, writing a compiled model; 0 = don't")
+	cmd.Flag.StringVar(&modelKind, "kind", "", "Model kind [md, dep, joint], for models without a header")
+	cmd.Flag.StringVar(&pruneDevIn, "dev_in", "", "Optional - Dev set input file (lattices for md and joint, conll for dep)")
+	cmd.Flag.StringVar(&pruneDevGold, "dev_gold", "", "Optional - Dev set gold file (mapping for md and joint, conll for dep)")
+	return cmd
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"runtime"
+	"sync"
+)
+
+// parseWorkers returns the number of sentences to parse concurrently
+func parseWorkers() int {
+	if ParseWorkers > 0 {
+		return ParseWorkers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// parallelParse calls parse for every index below n, on parseWorkers
+// goroutines
+func parallelParse(n int, parse func(i int)) {
+	var wg sync.WaitGroup
+	indices := make(chan int)
+	for w := 0; w < parseWorkers(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				parse(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
+
+// orderedParse parses the instances of a stream with up to parseWorkers
+// sentences in flight, and sends the results to out in input order
+func orderedParse(instances chan interface{}, out chan interface{}, parse func(i int, instance interface{}) interface{}) {
+	// the results of the sentences in flight, in input order; the one
+	// being waited on is taken off the queue
+	pending := make(chan chan interface{}, parseWorkers()-1)
+	go func() {
+		defer close(pending)
+		var i int
+		for instance := range instances {
+			result := make(chan interface{}, 1)
+			pending <- result
+			go func(i int, instance interface{}) {
+				result <- parse(i, instance)
+			}(i, instance)
+			i++
+		}
+	}()
+	for result := range pending {
+		out <- <-result
+	}
+}
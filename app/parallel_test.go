@@ -0,0 +1,55 @@
+package app
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOrderedParse(t *testing.T) {
+	defer func(workers int) { ParseWorkers = workers }(ParseWorkers)
+	for _, workers := range []int{1, 3, 8} {
+		ParseWorkers = workers
+		var (
+			lock              sync.Mutex
+			inFlight, maxSeen int
+		)
+		instances, out := make(chan interface{}), make(chan interface{})
+		go func() {
+			for i := 0; i < 40; i++ {
+				instances <- i
+			}
+			close(instances)
+		}()
+		go func() {
+			orderedParse(instances, out, func(i int, instance interface{}) interface{} {
+				lock.Lock()
+				inFlight++
+				if inFlight > maxSeen {
+					maxSeen = inFlight
+				}
+				lock.Unlock()
+				// later sentences often finish first
+				time.Sleep(time.Duration((i*7)%5) * time.Millisecond)
+				lock.Lock()
+				inFlight--
+				lock.Unlock()
+				return instance
+			})
+			close(out)
+		}()
+		var next int
+		for result := range out {
+			if result.(int) != next {
+				t.Fatalf("%d workers: expected result %d, got %v", workers, next, result)
+			}
+			next++
+		}
+		if next != 40 {
+			t.Errorf("%d workers: expected 40 results, got %d", workers, next)
+		}
+		if maxSeen > workers {
+			t.Errorf("%d workers: got %d sentences in flight", workers, maxSeen)
+		}
+	}
+}
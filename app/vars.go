@@ -9,6 +9,7 @@ import (
 	// dep "yap/nlp/parser/dependency/transition"
 	"yap/eval"
 	"yap/nlp/format/conll"
+	"yap/nlp/format/constraints"
 	"yap/nlp/format/mapping"
 	"yap/nlp/format/raw"
 	"yap/nlp/format/segmentation"
@@ -20,6 +21,8 @@ import (
 	dep "yap/nlp/parser/dependency/transition"
 	"yap/nlp/parser/dependency/transition/morph"
 
+	"bufio"
+	"bytes"
 	"encoding/gob"
 	"fmt"
 	"log"
@@ -51,6 +54,8 @@ var (
 	UsePOP               bool
 	limit                int
 	Stream               bool
+	// number of sentences parsed concurrently; 0 = GOMAXPROCS
+	ParseWorkers         int
 
 	// global enumerations
 	ERel, ETrans, EWord, EPOS, EWPOS, EMHost, EMSuffix *util.EnumSet
@@ -70,11 +75,18 @@ var (
 	tSeg             string
 	input, inputLat  string
 	inputGold        string
+	inputConstraints string
 	test             string
 	testGold         string
 	outLat, outSeg   string
 	outMap           string
 	outConll         string
+	outKBest         string
+
+	// number of analyses per sentence written to outKBest; 1 = best only
+	KBest int
+	// add the confidence of every morpheme to the mapping output
+	Confidence bool
 	//modelFile        string
 	//modelName        string
 	//featuresFile     string
@@ -108,73 +120,113 @@ type Serialization struct {
 	ETokens                              *util.EnumSet
 }
 
-func WriteModel(file string, data *Serialization) {
+// WriteModel writes a model file: the header followed by the model. A nil
+// header writes the model alone, as models without a header were written.
+func WriteModel(file string, header *ModelHeader, data *Serialization) {
+	if err := writeModel(file, header, data); err != nil {
+		log.Fatalln("Failed writing model to", file, err)
+	}
+}
+
+// writeModel writes a model file as WriteModel does, returning its error
+func writeModel(file string, header *ModelHeader, data *Serialization) (err error) {
 	fObj, err := os.Create(file)
 	if err != nil {
-		log.Fatalln("Failed creating model file", file, err)
-		return
+		return err
 	}
 	defer func() {
 		fObj.Close()
 		if r := recover(); r != nil {
-			fmt.Println(r)
+			err = fmt.Errorf("%v", r)
 		}
 	}()
-	//defer fObj.Close()
-	writer := gob.NewEncoder(fObj)
-	err = writer.Encode(data)
-	if err != nil {
-		log.Fatalln("Failed writing model model to", file, err)
-		panic("Failed to write model")
+	bufWriter := bufio.NewWriter(fObj)
+	writer := gob.NewEncoder(bufWriter)
+	if header != nil {
+		bufWriter.WriteString(MODEL_MAGIC)
+		err = writer.Encode(header)
 	}
+	if err == nil {
+		err = writer.Encode(data)
+	}
+	if err == nil {
+		err = bufWriter.Flush()
+	}
+	if err == nil {
+		err = fObj.Close()
+	}
+	return err
 }
 
-func ReadModel(file string) *Serialization {
-	data := &Serialization{}
+// ReadModel reads a model file and its header; the header is nil for
+// models written without one
+func ReadModel(file string) (*Serialization, *ModelHeader, error) {
 	fObj, err := os.Open(file)
 	if err != nil {
-		log.Fatalln("Failed reading model from", file, err)
-		return nil
+		return nil, nil, err
 	}
 	defer fObj.Close()
-	reader := gob.NewDecoder(fObj)
-	reader.Decode(data)
-	return data
+	header, reader, err := readModelHeader(bufio.NewReader(fObj))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed reading model %s: %v", file, err)
+	}
+	data := &Serialization{}
+	if err := reader.Decode(data); err != nil {
+		return nil, nil, fmt.Errorf("failed reading model %s: %v", file, err)
+	}
+	return data, header, nil
 }
 
 func SetupRelationEnum(labels []string) {
 	if ERel != nil {
 		return
 	}
-	ERel = util.NewEnumSet(len(labels) + 1)
-	ERel.Add(nlp.DepRel(nlp.ROOT_LABEL))
+	ERel = NewRelationEnum(labels)
+}
+
+// NewRelationEnum enumerates the dependency labels after the root label
+func NewRelationEnum(labels []string) *util.EnumSet {
+	eRel := util.NewEnumSet(len(labels) + 1)
+	eRel.Add(nlp.DepRel(nlp.ROOT_LABEL))
 	for _, label := range labels {
-		ERel.Add(nlp.DepRel(label))
+		eRel.Add(nlp.DepRel(label))
 	}
-	ERel.Frozen = true
+	eRel.Frozen = true
+	return eRel
 }
 
 func SetupTransEnum(relations []string) {
-	ETrans = util.NewEnumSet((len(relations)+1)*2 + 2)
-	_, _ = ETrans.Add("IDLE") // dummy no action transition for zpar equivalence
-	iSH, _ := ETrans.Add("SH")
-	iRE, _ := ETrans.Add("RE")
-	_, _ = ETrans.Add("AL") // dummy action transition for zpar equivalence
-	_, _ = ETrans.Add("AR") // dummy action transition for zpar equivalence
-	iPR, _ := ETrans.Add("PR")
+	ETrans = NewTransEnum(relations)
+	iSH, _ := ETrans.IndexOf("SH")
+	iRE, _ := ETrans.IndexOf("RE")
+	iPR, _ := ETrans.IndexOf("PR")
 	SH = transition.ConstTransition(iSH)
 	RE = transition.ConstTransition(iRE)
 	PR = transition.ConstTransition(iPR)
 	LA = transition.ConstTransition(iPR + 1)
-	ETrans.Add("LA-" + string(nlp.ROOT_LABEL))
+	iRA, _ := ETrans.IndexOf("RA-" + string(nlp.ROOT_LABEL))
+	RA = transition.ConstTransition(iRA)
+}
+
+// NewTransEnum enumerates the arc eager transitions of the dependency
+// parser with the relations
+func NewTransEnum(relations []string) *util.EnumSet {
+	eTrans := util.NewEnumSet((len(relations)+1)*2 + 2)
+	_, _ = eTrans.Add("IDLE") // dummy no action transition for zpar equivalence
+	eTrans.Add("SH")
+	eTrans.Add("RE")
+	_, _ = eTrans.Add("AL") // dummy action transition for zpar equivalence
+	_, _ = eTrans.Add("AR") // dummy action transition for zpar equivalence
+	eTrans.Add("PR")
+	eTrans.Add("LA-" + string(nlp.ROOT_LABEL))
 	for _, transition := range relations {
-		ETrans.Add("LA-" + string(transition))
+		eTrans.Add("LA-" + string(transition))
 	}
-	RA = transition.ConstTransition(ETrans.Len())
-	ETrans.Add("RA-" + string(nlp.ROOT_LABEL))
+	eTrans.Add("RA-" + string(nlp.ROOT_LABEL))
 	for _, transition := range relations {
-		ETrans.Add("RA-" + string(transition))
+		eTrans.Add("RA-" + string(transition))
 	}
+	return eTrans
 }
 
 func SetupMorphTransEnum(relations []string) {
@@ -432,59 +484,149 @@ type Parser interface {
 	Parse(search.Problem) (transition.Configuration, interface{})
 }
 
+// ParseStream parses the instances on ParseWorkers goroutines, writing the
+// results in input order
 func ParseStream(instances chan interface{}, writeStream chan interface{}, parser Parser) {
-	// runtime.GOMAXPROCS(1)
-	// Search.AllOut = true
 	startTime := time.Now()
-
-	// prevGC := debug.SetGCPercent(-1)
-	var i int
-	for instance := range instances {
-		// if i%50 == 0 {
-		// 	debug.SetGCPercent(100)
-		// 	runtime.GC()
-		// 	debug.SetGCPercent(-1)
-		// }
-		log.Println("Parsing instance", i) //, "len", len(sent.Tokens()))
-		// }
+	orderedParse(instances, writeStream, func(i int, instance interface{}) interface{} {
+		log.Println("Parsing instance", i)
 		result, _ := parser.Parse(instance)
-		writeStream <- result
-		i++
-	}
+		warnUnconstrained(i, result)
+		return result
+	})
 	if allOut {
 		parseTime := time.Since(startTime)
 		log.Println("PARSE Total Time:", parseTime)
 	}
-	// debug.SetGCPercent(prevGC)
 	close(writeStream)
 }
 
+// Parse parses the instances on ParseWorkers goroutines; the parser must
+// support concurrent calls, as search.Beam does
 func Parse(instances []interface{}, parser Parser) []interface{} {
-	// runtime.GOMAXPROCS(1)
-	// Search.AllOut = true
 	startTime := time.Now()
-
-	// prevGC := debug.SetGCPercent(-1)
 	parsed := make([]interface{}, len(instances))
-	for i, instance := range instances {
-		// if i%50 == 0 {
-		// 	debug.SetGCPercent(100)
-		// 	runtime.GC()
-		// 	debug.SetGCPercent(-1)
-		// }
+	parallelParse(len(instances), func(i int) {
 		log.Println("Parsing instance", i) //, "len", len(sent.Tokens()))
-		// }
-		result, _ := parser.Parse(instance)
-		parsed[i] = result
-	}
+		parsed[i], _ = parser.Parse(instances[i])
+		warnUnconstrained(i, parsed[i])
+	})
 	if allOut {
 		parseTime := time.Since(startTime)
 		log.Println("PARSE Total Time:", parseTime)
 	}
-	// debug.SetGCPercent(prevGC)
 	return parsed
 }
 
+// warnUnconstrained logs a parse of instance i that broke a constraint of
+// its input
+func warnUnconstrained(i int, result interface{}) {
+	if c, ok := result.(nlp.Constrained); ok && c.Unconstrained() {
+		log.Println("Warning: the parse of instance", i, "broke a constraint of its input")
+	}
+}
+
+// A Renderer writes a parsed configuration in an output format. Analyses of
+// a k-best list that render the same are the same analysis.
+type Renderer func(transition.Configuration) string
+
+func RenderMorphGraph(c transition.Configuration) string {
+	buf := new(bytes.Buffer)
+	conll.Write(buf, []interface{}{conll.MorphGraph2Conll(c.(nlp.MorphDependencyGraph))})
+	return buf.String()
+}
+
+func RenderMDConfig(c transition.Configuration) string {
+	buf := new(bytes.Buffer)
+	mapping.Write(buf, []interface{}{c})
+	return buf.String()
+}
+
+func RenderDepGraph(c transition.Configuration) string {
+	buf := new(bytes.Buffer)
+	conll.Write(buf, []interface{}{conll.Graph2Conll(c.(nlp.LabeledDependencyGraph), EMHost, EMSuffix)})
+	return buf.String()
+}
+
+type KBestParser interface {
+	ParseKBest(search.Problem, int, func(transition.Configuration) string) []search.ScoredResult
+}
+
+// ParseKBest parses every instance keeping up to k distinct analyses, and
+// returns the best analysis of every instance as Parse does
+func ParseKBest(instances []interface{}, parser KBestParser, k int, render Renderer) ([]interface{}, [][]search.ScoredResult) {
+	startTime := time.Now()
+	parsed := make([]interface{}, len(instances))
+	kbest := make([][]search.ScoredResult, len(instances))
+	parallelParse(len(instances), func(i int) {
+		log.Println("Parsing instance", i, "keeping", k, "best")
+		kbest[i] = parser.ParseKBest(instances[i], k, render)
+		parsed[i] = kbest[i][0].C
+		warnUnconstrained(i, parsed[i])
+	})
+	if allOut {
+		parseTime := time.Since(startTime)
+		log.Println("PARSE Total Time:", parseTime)
+	}
+	return parsed, kbest
+}
+
+// ParseAndWriteKBest parses the instances, also writing the k-best analyses
+// to outKBest when KBest > 1. With Confidence set, the agreement of the
+// analyses in the final beam of every instance is returned as well.
+func ParseAndWriteKBest(instances []interface{}, beam *search.Beam, render Renderer) ([]interface{}, []*nlp.BeamAgreement, error) {
+	if KBest <= 1 && !Confidence {
+		return Parse(instances, beam), nil, nil
+	}
+	parsed, beams := ParseKBest(instances, beam, beam.Size, nil)
+	if KBest > 1 {
+		kbest := make([][]search.ScoredResult, len(beams))
+		for i, results := range beams {
+			kbest[i] = search.Distinct(results, KBest, render)
+		}
+		if err := WriteKBestFile(outKBest, kbest, render); err != nil {
+			return nil, nil, err
+		}
+		if allOut {
+			log.Println("Wrote", KBest, "best analyses of", len(kbest), "sentences to", outKBest)
+		}
+	}
+	if !Confidence {
+		return parsed, nil, nil
+	}
+	return parsed, BeamAgreements(beams), nil
+}
+
+// BeamAgreements counts the choices of all analyses of every final beam
+func BeamAgreements(beams [][]search.ScoredResult) []*nlp.BeamAgreement {
+	agreements := make([]*nlp.BeamAgreement, len(beams))
+	for i, results := range beams {
+		agreements[i] = nlp.NewBeamAgreement()
+		for _, result := range results {
+			agreements[i].Add(result.C)
+		}
+	}
+	return agreements
+}
+
+// WriteKBestFile writes the rendered analyses of every sentence best first,
+// each preceded by comment lines with its sentence, rank and model score
+func WriteKBestFile(filename string, kbest [][]search.ScoredResult, render Renderer) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	for i, results := range kbest {
+		for rank, result := range results {
+			fmt.Fprintf(writer, "# sent_id = %d\n# rank = %d\n# score = %v\n", i+1, rank+1, result.Score)
+			writer.WriteString(render(result.C))
+		}
+	}
+	return writer.Flush()
+}
+
 func GetMDConfigAsLattices(instance interface{}) util.Equaler {
 	return instance.(*disambig.MDConfig).Lattices
 }
@@ -844,6 +986,25 @@ func serialize(perceptronModel perceptron.Model, iteration, generations int) str
 		EWord, EPOS, EWPOS, EMHost, EMSuffix, EMorphProp, ETrans, ETokens,
 	}
 	modelFile := fmt.Sprintf("model.temp.i%d", iteration)
-	WriteModel(modelFile, serialization)
+	WriteModel(modelFile, modelHeader, serialization)
 	return modelFile
 }
+
+// ConstrainInput sets the partial annotations read from inputConstraints,
+// if given, on the input lattice sentences
+func ConstrainInput(instances []interface{}) error {
+	if len(inputConstraints) == 0 {
+		return nil
+	}
+	sents, err := constraints.ReadFile(inputConstraints)
+	if err != nil {
+		return err
+	}
+	if err := constraints.ApplyAll(instances, sents); err != nil {
+		return err
+	}
+	if allOut {
+		log.Println("Constrained input with", inputConstraints)
+	}
+	return nil
+}
@@ -97,10 +97,24 @@ type Row struct {
 	TokenID int
 }
 
+// AppendMisc adds an attribute to the MISC column of the row
+func (r *Row) AppendMisc(attribute string) {
+	if len(r.Misc) == 0 || r.Misc == "_" {
+		r.Misc = attribute
+	} else {
+		r.Misc += "|" + attribute
+	}
+}
+
 func (r Row) String() string {
 	if len(r.Lemma) == 0 {
 		r.Lemma = strings.Replace(r.Form, "_", "", -1)
 	}
+	// a negative head marks a row without a dependency annotation
+	head := "_"
+	if r.Head >= 0 {
+		head = fmt.Sprintf("%d", r.Head)
+	}
 	fields := []string{
 		fmt.Sprintf("%d", r.ID),
 		r.Form,
@@ -108,7 +122,7 @@ func (r Row) String() string {
 		r.UPosTag,
 		r.XPosTag,
 		r.FeatStr,
-		fmt.Sprintf("%d", r.Head),
+		head,
 		r.DepRel,
 		strings.Join(r.Deps, FEATURE_SEPARATOR),
 		r.Misc,
@@ -0,0 +1,90 @@
+package constraints
+
+// Package constraints reads partial annotations that constrain parsing
+// constraint files contain a JSON array of token constraints per line,
+// a line per sentence in the order of the input; an empty line leaves its
+// sentence unconstrained
+
+import (
+	nlp "yap/nlp/types"
+
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+const MAX_LINE = 1024 * 1024
+
+// Token fixes the segmentation of a token (zero-based index in its sentence)
+// to the given morphemes
+type Token struct {
+	Token     int                 `json:"token"`
+	Morphemes nlp.TokenConstraint `json:"morphemes"`
+}
+
+type Sentence []Token
+
+// Apply sets the constraints of a sentence on its lattices
+func Apply(lattices nlp.LatticeSentence, sent Sentence) error {
+	byToken := make(map[int]nlp.TokenConstraint, len(sent))
+	for _, token := range sent {
+		if len(token.Morphemes) == 0 {
+			return fmt.Errorf("constraint for token %d has no morphemes", token.Token)
+		}
+		if _, exists := byToken[token.Token]; exists {
+			return fmt.Errorf("more than one constraint for token %d", token.Token)
+		}
+		byToken[token.Token] = token.Morphemes
+	}
+	return lattices.Constrain(byToken)
+}
+
+// ApplyAll sets the constraints of every sentence on the lattice sentences
+// of a corpus, in order
+func ApplyAll(instances []interface{}, sents []Sentence) error {
+	if len(sents) > len(instances) {
+		return fmt.Errorf("got constraints for %d sentences but only %d sentences", len(sents), len(instances))
+	}
+	for i, sent := range sents {
+		if len(sent) == 0 {
+			continue
+		}
+		if err := Apply(instances[i].(nlp.LatticeSentence), sent); err != nil {
+			return fmt.Errorf("sentence %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func Read(reader io.Reader) ([]Sentence, error) {
+	var sentences []Sentence
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_LINE)
+	for i := 0; scanner.Scan(); i++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		var sent Sentence
+		if len(line) > 0 {
+			if err := json.Unmarshal(line, &sent); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+		}
+		sentences = append(sentences, sent)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sentences, nil
+}
+
+func ReadFile(filename string) ([]Sentence, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(file)
+}
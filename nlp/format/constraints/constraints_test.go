@@ -0,0 +1,86 @@
+package constraints
+
+import (
+	"strings"
+	"testing"
+	"yap/alg/graph"
+	nlp "yap/nlp/types"
+)
+
+func testMorph(id, from, to int, form, pos string) *nlp.EMorpheme {
+	return &nlp.EMorpheme{Morpheme: nlp.Morpheme{
+		BasicDirectedEdge: graph.BasicDirectedEdge{id, from, to},
+		Form:              form,
+		CPOS:              pos,
+		POS:               pos,
+	}}
+}
+
+// BGN: either B+GN or BGN
+func testSentence() nlp.LatticeSentence {
+	return nlp.LatticeSentence{{
+		Token: "BGN",
+		Morphemes: nlp.Morphemes{
+			testMorph(0, 0, 1, "B", "PREPOSITION"),
+			testMorph(1, 0, 2, "BGN", "NNP"),
+			testMorph(2, 1, 2, "GN", "NN"),
+		},
+		Next:     map[int][]int{0: {0, 1}, 1: {2}},
+		BottomId: 0,
+		TopId:    2,
+	}}
+}
+
+func TestRead(t *testing.T) {
+	input := `[{"token": 0, "morphemes": [{"form": "B"}, {"pos": "NN", "head": {"token": -1, "morpheme": 0}}]}]
+
+[]
+`
+	sents, err := Read(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sents) != 3 {
+		t.Fatalf("Expected 3 sentences, got %d", len(sents))
+	}
+	if len(sents[0]) != 1 || len(sents[0][0].Morphemes) != 2 {
+		t.Fatalf("Expected a constraint of 2 morphemes, got %v", sents[0])
+	}
+	if head := sents[0][0].Morphemes[1].Head; head == nil || !head.IsRoot() {
+		t.Errorf("Expected a root head, got %v", head)
+	}
+	if len(sents[1]) != 0 || len(sents[2]) != 0 {
+		t.Errorf("Expected unconstrained sentences, got %v and %v", sents[1], sents[2])
+	}
+}
+
+func TestApply(t *testing.T) {
+	lats := testSentence()
+	if err := Apply(lats, Sentence{{Token: 0, Morphemes: nlp.TokenConstraint{{Form: "B"}, {}}}}); err != nil {
+		t.Fatal(err)
+	}
+	constraint := lats[0].Constraint
+	if !constraint.Allows(&lats[0], 0, lats[0].Morphemes[0]) {
+		t.Error("Expected the prefix to be allowed")
+	}
+	if constraint.Allows(&lats[0], 0, lats[0].Morphemes[1]) {
+		t.Error("Expected the unsegmented token to be pruned")
+	}
+}
+
+func TestApplyUnsatisfiable(t *testing.T) {
+	for _, sent := range []Sentence{
+		{{Token: 0, Morphemes: nlp.TokenConstraint{{POS: "VB"}}}},
+		{{Token: 0, Morphemes: nlp.TokenConstraint{{}, {}, {}}}},
+		{{Token: 1, Morphemes: nlp.TokenConstraint{{}}}},
+		{{Token: 0, Morphemes: nlp.TokenConstraint{{Head: &nlp.MorphRef{Token: 0, Morph: 0}}}}},
+	} {
+		lats := testSentence()
+		if err := Apply(lats, sent); err == nil {
+			t.Errorf("Expected an error applying %v", sent)
+		}
+		if lats[0].Constraint != nil {
+			t.Errorf("Expected no constraint set applying %v", sent)
+		}
+	}
+}
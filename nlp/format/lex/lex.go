@@ -251,6 +251,10 @@ func ParseMSRSuffix(hostPOS, msr string) (string, string, map[string]string, str
 }
 
 func ProcessUDAnalyzedToken(analysis string) (*AnalyzedToken, error) {
+	return processUDAnalyzedToken(analysis, ADD_NNP_NO_FEATS)
+}
+
+func processUDAnalyzedToken(analysis string, nnpNoFeats bool) (*AnalyzedToken, error) {
 	var (
 		split, msrs           []string
 		curToken              *AnalyzedToken
@@ -270,7 +274,7 @@ func ProcessUDAnalyzedToken(analysis string) (*AnalyzedToken, error) {
 		Token:     split[0],
 		Morphemes: make([]types.BasicMorphemes, 0, (splitLen-1)/2),
 	}
-	if ADD_NNP_NO_FEATS {
+	if nnpNoFeats {
 		// manually add NNP stripped of feats
 		for i = 1; i < splitLen; i += 2 {
 			msrs = strings.Split(split[i], MSR_SEPARATOR)
@@ -527,6 +531,10 @@ func ProcessUDAnalyzedPrefix(analysis string) (*AnalyzedToken, error) {
 	return curToken, nil
 }
 func ProcessAnalyzedToken(analysis string) (*AnalyzedToken, error) {
+	return processAnalyzedToken(analysis, ADD_NNP_NO_FEATS)
+}
+
+func processAnalyzedToken(analysis string, nnpNoFeats bool) (*AnalyzedToken, error) {
 	var (
 		split, msrs    []string
 		curToken       *AnalyzedToken
@@ -544,7 +552,7 @@ func ProcessAnalyzedToken(analysis string) (*AnalyzedToken, error) {
 		Token:     split[0],
 		Morphemes: make([]types.BasicMorphemes, 0, (splitLen-1)/2),
 	}
-	if ADD_NNP_NO_FEATS {
+	if nnpNoFeats {
 		// manually add NNP stripped of feats
 		for i = 1; i < splitLen; i += 2 {
 			msrs = strings.Split(split[i], MSR_SEPARATOR)
@@ -738,6 +746,11 @@ func ProcessAnalyzedPrefix(analysis string) (*AnalyzedToken, error) {
 type LexReader func(string) (*AnalyzedToken, error)
 
 func Read(input io.Reader, format string, maType string) ([]*AnalyzedToken, error) {
+	return ReadLex(input, format, maType, ADD_NNP_NO_FEATS)
+}
+
+// ReadLex is Read with nnpNoFeats in place of ADD_NNP_NO_FEATS
+func ReadLex(input io.Reader, format string, maType string, nnpNoFeats bool) ([]*AnalyzedToken, error) {
 	tokens := make([]*AnalyzedToken, 0, APPROX_LEX_SIZE)
 	scan := bufio.NewScanner(input)
 	var reader LexReader
@@ -745,7 +758,9 @@ func Read(input io.Reader, format string, maType string) ([]*AnalyzedToken, erro
 	case "spmrl":
 		switch format {
 		case "lexicon":
-			reader = ProcessAnalyzedToken
+			reader = func(analysis string) (*AnalyzedToken, error) {
+				return processAnalyzedToken(analysis, nnpNoFeats)
+			}
 		case "prefix":
 			reader = ProcessAnalyzedPrefix
 		default:
@@ -753,7 +768,9 @@ func Read(input io.Reader, format string, maType string) ([]*AnalyzedToken, erro
 	case "ud":
 		switch format {
 		case "lexicon":
-			reader = ProcessUDAnalyzedToken
+			reader = func(analysis string) (*AnalyzedToken, error) {
+				return processUDAnalyzedToken(analysis, nnpNoFeats)
+			}
 		case "prefix":
 			reader = ProcessUDAnalyzedPrefix
 		default:
@@ -772,11 +789,16 @@ func Read(input io.Reader, format string, maType string) ([]*AnalyzedToken, erro
 	return tokens, nil
 }
 func ReadFile(filename string, format string, maType string) ([]*AnalyzedToken, error) {
+	return ReadLexFile(filename, format, maType, ADD_NNP_NO_FEATS)
+}
+
+// ReadLexFile is ReadFile with nnpNoFeats in place of ADD_NNP_NO_FEATS
+func ReadLexFile(filename string, format string, maType string, nnpNoFeats bool) ([]*AnalyzedToken, error) {
 	file, err := os.Open(filename)
 	defer file.Close()
 	if err != nil {
 		return nil, err
 	}
 
-	return Read(file, format, maType)
+	return ReadLex(file, format, maType, nnpNoFeats)
 }
@@ -12,6 +12,10 @@ import (
 )
 
 func UDWriteMorph(writer io.Writer, morph *nlp.EMorpheme, curMorph int) {
+	udWriteMorph(writer, morph, curMorph, "_")
+}
+
+func udWriteMorph(writer io.Writer, morph *nlp.EMorpheme, curMorph int, misc string) {
 	writer.Write([]byte(fmt.Sprintf("%d\t", curMorph)))
 	//writer.Write([]byte(morph.Lemma))
 	writer.Write([]byte(morph.Form))
@@ -28,13 +32,27 @@ func UDWriteMorph(writer io.Writer, morph *nlp.EMorpheme, curMorph int) {
 	} else {
 		writer.Write([]byte(morph.FeatureStr))
 	}
-	for j := 0; j < 4; j++ {
+	for j := 0; j < 3; j++ {
 		writer.Write([]byte("\t_"))
 	}
+	writer.Write([]byte{'\t'})
+	writer.Write([]byte(misc))
 	writer.Write([]byte{'\n'})
 }
 
 func WriteMorph(writer io.Writer, morph *nlp.EMorpheme, curMorph, curToken int) {
+	writeMorphColumns(writer, morph, curMorph, curToken)
+	writer.Write([]byte{'\n'})
+}
+
+// WriteMorphConfidence writes a morpheme line with the confidence of the
+// morpheme in an additional column
+func WriteMorphConfidence(writer io.Writer, morph *nlp.EMorpheme, curMorph, curToken int, confidence float64) {
+	writeMorphColumns(writer, morph, curMorph, curToken)
+	writer.Write([]byte(fmt.Sprintf("\t%.3f\n", confidence)))
+}
+
+func writeMorphColumns(writer io.Writer, morph *nlp.EMorpheme, curMorph, curToken int) {
 	writer.Write([]byte(fmt.Sprintf("%d\t%d\t", curMorph, curMorph+1)))
 	writer.Write([]byte(morph.Form))
 	writer.Write([]byte{'\t'})
@@ -54,10 +72,20 @@ func WriteMorph(writer io.Writer, morph *nlp.EMorpheme, curMorph, curToken int)
 		writer.Write([]byte(morph.FeatureStr))
 	}
 	writer.Write([]byte{'\t'})
-	writer.Write([]byte(fmt.Sprintf("%d\n", curToken+1)))
+	writer.Write([]byte(fmt.Sprintf("%d", curToken+1)))
 }
 
 func UDWrite(writer io.Writer, mappedSents []interface{}, conllul []conllul.ConlluLattice) {
+	udWrite(writer, mappedSents, conllul, nil)
+}
+
+// UDWriteConfidence writes the mappings as UDWrite does, with the confidence
+// of every morpheme in the MISC column
+func UDWriteConfidence(writer io.Writer, mappedSents []interface{}, conllul []conllul.ConlluLattice, agreements []*nlp.BeamAgreement) {
+	udWrite(writer, mappedSents, conllul, agreements)
+}
+
+func udWrite(writer io.Writer, mappedSents []interface{}, conllul []conllul.ConlluLattice, agreements []*nlp.BeamAgreement) {
 	var curMorph int
 	for i, mappedSent := range mappedSents {
 		curMorph = 1
@@ -79,7 +107,11 @@ func UDWrite(writer io.Writer, mappedSents []interface{}, conllul []conllul.Conl
 					// log.Println("\t", "Morph is nil, continuing")
 					continue
 				}
-				UDWriteMorph(writer, morph, curMorph)
+				if agreements != nil {
+					udWriteMorph(writer, morph, curMorph, fmt.Sprintf("Confidence=%.3f", agreements[i].Morpheme(morph)))
+				} else {
+					UDWriteMorph(writer, morph, curMorph)
+				}
 				curMorph++
 			}
 		}
@@ -88,8 +120,18 @@ func UDWrite(writer io.Writer, mappedSents []interface{}, conllul []conllul.Conl
 }
 
 func Write(writer io.Writer, mappedSents []interface{}) {
+	write(writer, mappedSents, nil)
+}
+
+// WriteConfidence writes the mappings as Write does, adding the confidence
+// of every morpheme according to the agreement of its sentence's beam
+func WriteConfidence(writer io.Writer, mappedSents []interface{}, agreements []*nlp.BeamAgreement) {
+	write(writer, mappedSents, agreements)
+}
+
+func write(writer io.Writer, mappedSents []interface{}, agreements []*nlp.BeamAgreement) {
 	var curMorph int
-	for _, mappedSent := range mappedSents {
+	for s, mappedSent := range mappedSents {
 		curMorph = 0
 		for i, mapping := range mappedSent.(*disambig.MDConfig).Mappings {
 			// log.Println("At token", i, mapping.Token)
@@ -106,7 +148,11 @@ func Write(writer io.Writer, mappedSents []interface{}) {
 					// log.Println("\t", "Morph is nil, continuing")
 					continue
 				}
-				WriteMorph(writer, morph, curMorph, i)
+				if agreements != nil {
+					WriteMorphConfidence(writer, morph, curMorph, i, agreements[s].Morpheme(morph))
+				} else {
+					WriteMorph(writer, morph, curMorph, i)
+				}
 				// log.Println("\t", "At morph", j, morph.Form)
 				curMorph++
 			}
@@ -156,6 +202,18 @@ func UDWriteFile(filename string, mappedSents []interface{}, conllul []conllul.C
 	return nil
 }
 
+// UDWriteConfidenceFile writes the mappings with morpheme confidences to a
+// CoNLL-U file
+func UDWriteConfidenceFile(filename string, mappedSents []interface{}, conllul []conllul.ConlluLattice, agreements []*nlp.BeamAgreement) error {
+	file, err := os.Create(filename)
+	defer file.Close()
+	if err != nil {
+		return err
+	}
+	UDWriteConfidence(file, mappedSents, conllul, agreements)
+	return nil
+}
+
 func WriteFile(filename string, mappedSents []interface{}) error {
 	file, err := os.Create(filename)
 	defer file.Close()
@@ -166,6 +224,17 @@ func WriteFile(filename string, mappedSents []interface{}) error {
 	return nil
 }
 
+// WriteConfidenceFile writes the mappings with morpheme confidences to a file
+func WriteConfidenceFile(filename string, mappedSents []interface{}, agreements []*nlp.BeamAgreement) error {
+	file, err := os.Create(filename)
+	defer file.Close()
+	if err != nil {
+		return err
+	}
+	WriteConfidence(file, mappedSents, agreements)
+	return nil
+}
+
 func WriteStreamToFile(filename string, mappedSents chan interface{}) error {
 	file, err := os.Create(filename)
 	if err != nil {
@@ -27,6 +27,10 @@ func (a *ArcEager) Transition(from Configuration, rawTransition Transition) Conf
 		panic("Got wrong configuration type")
 	}
 	transition := rawTransition.Value()
+	// only a transition pruneForced fell back to breaks a forced arc
+	if len(conf.ForcedArcs) > 0 && !a.keepsForced(from.(*SimpleConfiguration), transition) {
+		conf.unconstrained = true
+	}
 	// Transition System:
 	// LA-r	(S|wi,	wj|B,	A) => (S      ,	wj|B,	A+{(wj,r,wi)})	if: (wk,r',wi) notin A; i != 0
 	// RA-r	(S|wi,	wj|B,	A) => (S|wi|wj,	   B,	A+{(wi,r,wj)})
@@ -125,15 +129,22 @@ func (a *ArcEager) possibleTransitions(from Configuration, transitions chan int)
 	qSize := conf.Queue().Size()
 	sPeek, sExists := conf.Stack().Peek()
 
+	// with forced arcs, candidates are collected and pruned before yielding
+	var candidates []int
+	yield := func(transition int) { transitions <- transition }
+	if len(conf.ForcedArcs) > 0 {
+		yield = func(transition int) { candidates = append(candidates, transition) }
+	}
+
 	if !qExists {
 		if sSize == 1 {
-			transitions <- a.POPROOT
+			yield(a.POPROOT)
 		}
 		if sSize > 1 {
 			if ArcAllOut {
 				log.Println("REDUCE")
 			}
-			transitions <- a.REDUCE
+			yield(a.REDUCE)
 		}
 	} else {
 		if conf.GetLastTransition() == nil || conf.GetLastTransition().Value() != a.REDUCE {
@@ -141,7 +152,7 @@ func (a *ArcEager) possibleTransitions(from Configuration, transitions chan int)
 				if ArcAllOut {
 					log.Println("SHIFT")
 				}
-				transitions <- a.SHIFT
+				yield(a.SHIFT)
 			}
 		}
 
@@ -163,14 +174,14 @@ func (a *ArcEager) possibleTransitions(from Configuration, transitions chan int)
 				}
 				for rel, _ := range a.Relations.Index {
 					// transitions <- Transition("RA-" + rel)
-					transitions <- a.RIGHT + rel
+					yield(a.RIGHT + rel)
 				}
 			}
 			if (sPeekHasHead || !qExists) && sSize > 1 {
 				if ArcAllOut {
 					log.Println("REDUCE")
 				}
-				transitions <- a.REDUCE
+				yield(a.REDUCE)
 			}
 			if qExists && !sPeekHasHead {
 				if ArcAllOut {
@@ -178,14 +189,109 @@ func (a *ArcEager) possibleTransitions(from Configuration, transitions chan int)
 				}
 				for rel, _ := range a.Relations.Index {
 					// transitions <- Transition("LA-" + rel)
-					transitions <- a.LEFT + rel
+					yield(a.LEFT + rel)
 				}
 			}
 		}
 	}
+	if len(conf.ForcedArcs) > 0 {
+		for _, transition := range a.pruneForced(conf, candidates) {
+			transitions <- transition
+		}
+	}
 	close(transitions)
 }
 
+// pruneForced drops the candidate transitions that make a forced arc of the
+// configuration unreachable; if every candidate does, none is dropped and the
+// transition taken marks the configuration unconstrained
+func (a *ArcEager) pruneForced(conf *SimpleConfiguration, candidates []int) []int {
+	allowed := make([]int, 0, len(candidates))
+	for _, transition := range candidates {
+		if a.keepsForced(conf, transition) {
+			allowed = append(allowed, transition)
+		}
+	}
+	if len(allowed) == 0 {
+		return candidates
+	}
+	return allowed
+}
+
+// keepsForced reports whether every forced arc still reachable before the
+// transition remains reachable after it
+func (a *ArcEager) keepsForced(conf *SimpleConfiguration, transition int) bool {
+	s0, sExists := conf.Stack().Peek()
+	b0, bExists := conf.Queue().Peek()
+	// an empty stack or buffer matches no forced arc end
+	if !sExists {
+		s0 = FORCED_FUTURE - 1
+	}
+	if !bExists {
+		b0 = FORCED_FUTURE - 1
+	}
+	inBuffer := func(node int) bool {
+		return node == FORCED_FUTURE || (bExists && node >= b0)
+	}
+	onStack := func(node int) bool {
+		for i := 0; i < conf.Stack().Size(); i++ {
+			if stackNode, _ := conf.Stack().Index(i); stackNode == node {
+				return true
+			}
+		}
+		return false
+	}
+	// a headless node below the root on the stack can't get a head
+	headlessOnStack := func() bool {
+		for i := 0; i < conf.Stack().Size(); i++ {
+			if stackNode, _ := conf.Stack().Index(i); !conf.Arcs().HasHead(stackNode) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, arc := range conf.ForcedArcs {
+		if arc.Modifier >= 0 && conf.Arcs().HasHead(arc.Modifier) {
+			continue
+		}
+		switch {
+		case transition >= a.LEFT && transition < a.RIGHT:
+			relation := a.Relations.ValueOf(transition - a.LEFT).(DepRel)
+			if arc.Modifier == s0 && (arc.Head == FORCED_ROOT || inBuffer(arc.Head)) &&
+				!(arc.Head == b0 && arc.allows(relation)) {
+				return false
+			}
+			if arc.Head == s0 && inBuffer(arc.Modifier) {
+				return false
+			}
+		case transition >= a.RIGHT:
+			relation := a.Relations.ValueOf(transition - a.RIGHT).(DepRel)
+			if arc.Modifier == b0 && (arc.Head == FORCED_ROOT || inBuffer(arc.Head) || onStack(arc.Head)) &&
+				!(arc.Head == s0 && arc.allows(relation)) {
+				return false
+			}
+			if arc.Head == b0 && onStack(arc.Modifier) {
+				return false
+			}
+		case transition == a.REDUCE:
+			if arc.Head == s0 && inBuffer(arc.Modifier) {
+				return false
+			}
+			if arc.Modifier == s0 && (arc.Head == FORCED_ROOT || inBuffer(arc.Head)) {
+				return false
+			}
+		case transition == a.SHIFT:
+			if arc.Modifier == b0 && (onStack(arc.Head) || (arc.Head == FORCED_ROOT && headlessOnStack())) {
+				return false
+			}
+			if arc.Head == b0 && onStack(arc.Modifier) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (a *ArcEager) GetTransitions(from Configuration) (byte, []int) {
 	retval := make([]int, 0, 10)
 	tType, transitions := a.YieldTransitions(from)
@@ -28,6 +28,10 @@ type SimpleConfiguration struct {
 	NumHeadStack  int
 	TerminalQueue int
 	TerminalStack int
+	// arcs to be kept reachable by the transition system
+	ForcedArcs []ForcedArc
+	// a transition broke a forced arc
+	unconstrained bool
 }
 
 func (c *SimpleConfiguration) State() byte {
@@ -40,6 +44,7 @@ func (c *SimpleConfiguration) Graph() nlp.LabeledDependencyGraph {
 // Verify that SimpleConfiguration is a Configuration
 var _ DependencyConfiguration = &SimpleConfiguration{}
 var _ nlp.DependencyGraph = &SimpleConfiguration{}
+var _ nlp.Constrained = &SimpleConfiguration{}
 
 func (c *SimpleConfiguration) ID() int {
 	return 0
@@ -86,6 +91,8 @@ func (c *SimpleConfiguration) Init(abstractSentence interface{}) {
 	// in case of reuse
 	c.Last = ConstTransition(0)
 	c.InternalPrevious = nil
+	c.ForcedArcs = nil
+	c.unconstrained = false
 	c.NumHeadStack = 0
 	// c.Pointers = 0
 }
@@ -151,6 +158,8 @@ func (c *SimpleConfiguration) CopyTo(target Configuration) {
 	newConf.NumHeadStack = c.NumHeadStack
 	newConf.TerminalQueue = c.TerminalQueue
 	newConf.TerminalStack = c.TerminalStack
+	newConf.ForcedArcs = c.ForcedArcs
+	newConf.unconstrained = c.unconstrained
 	// store a pointer to the previous configuration
 	newConf.InternalPrevious = c
 
@@ -425,6 +434,11 @@ func (c *SimpleConfiguration) Assign(to uint16) {
 	c.lastOpAssignment = to
 }
 
+// Unconstrained reports whether a transition broke a forced arc
+func (c *SimpleConfiguration) Unconstrained() bool {
+	return c.unconstrained
+}
+
 func NewSimpleConfiguration() Configuration {
 	return Configuration(new(SimpleConfiguration))
 }
@@ -2,6 +2,7 @@ package transition
 
 import (
 	. "yap/alg"
+	. "yap/alg/transition"
 	// "log"
 	// nlp "yap/nlp/types"
 	// "yap/util"
@@ -33,11 +34,8 @@ func (c *SimpleConfiguration) Address(location []byte, sourceOffset int) (int, b
 		return 0, false, false
 	}
 	// test if feature address is a generator of feature (e.g. for each child..)
-	locationLen := len(location)
-	if locationLen >= 4 {
-		if string(location[2:4]) == "Ci" {
-			return atAddress, true, true
-		}
+	if IsGeneratorAddress(location) {
+		return atAddress, true, true
 	}
 
 	location = location[2:]
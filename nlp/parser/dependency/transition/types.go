@@ -68,6 +68,24 @@ type BasicDepArc struct {
 
 var _ nlp.LabeledDepArc = &BasicDepArc{}
 
+const (
+	// FORCED_ROOT is the head of a forced arc to the root
+	FORCED_ROOT = -1
+	// FORCED_FUTURE marks a forced arc end whose node wasn't created yet
+	FORCED_FUTURE = -2
+)
+
+// ForcedArc is an arc the parser must create; an empty relation allows any
+// label
+type ForcedArc struct {
+	Head, Modifier int
+	Relation       nlp.DepRel
+}
+
+func (arc ForcedArc) allows(relation nlp.DepRel) bool {
+	return len(arc.Relation) == 0 || arc.Relation == relation
+}
+
 func (arc *BasicDepArc) ID() int {
 	// a stand in for now
 	return 0
@@ -11,7 +11,6 @@ type VarBeam struct {
 	search.Beam
 }
 
-var _ search.Interface = &VarBeam{}
 var _ perceptron.EarlyUpdateInstanceDecoder = &VarBeam{}
 
 // var _ dependency.DependencyParser = &VarBeam{}
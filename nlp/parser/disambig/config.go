@@ -22,6 +22,14 @@ var (
 	AFFIX_SIZE       int  = 10
 )
 
+// Settings holds the disambiguation settings of a configuration, in place of
+// the package level UsePOP, SwitchFormLemma and LEMMAS
+type Settings struct {
+	UsePOP          bool
+	SwitchFormLemma bool
+	Lemmas          bool
+}
+
 type MDConfig struct {
 	LatticeQueue Queue
 	Lattices     nlp.LatticeSentence
@@ -40,9 +48,36 @@ type MDConfig struct {
 	Transitions *util.EnumSet
 	ParamFunc   nlp.MDParam
 	popped      int
+	// a transition broke a constraint of the lattices
+	unconstrained bool
+
+	// Settings, when set, are used instead of the package level settings
+	Settings *Settings
 }
 
 var _ Configuration = &MDConfig{}
+var _ nlp.Constrained = &MDConfig{}
+
+func (c *MDConfig) usePOP() bool {
+	if c.Settings != nil {
+		return c.Settings.UsePOP
+	}
+	return UsePOP
+}
+
+func (c *MDConfig) switchFormLemma() bool {
+	if c.Settings != nil {
+		return c.Settings.SwitchFormLemma
+	}
+	return SwitchFormLemma
+}
+
+func (c *MDConfig) lemmas() bool {
+	if c.Settings != nil {
+		return c.Settings.Lemmas
+	}
+	return LEMMAS
+}
 
 func (c *MDConfig) Init(abstractLattice interface{}) {
 	latticeSent := abstractLattice.(nlp.LatticeSentence)
@@ -72,11 +107,12 @@ func (c *MDConfig) Init(abstractLattice interface{}) {
 	// in case of reuse
 	c.Last = ConstTransition(0)
 	c.popped = 0
+	c.unconstrained = false
 }
 
 func (c *MDConfig) Terminal() bool {
 	// return c.Last == Transition(0) && c.Alignment() == 1
-	if UsePOP {
+	if c.usePOP() {
 		return c.LatticeQueue.Size() == 0 && c.popped == len(c.Mappings)
 	} else {
 		return c.LatticeQueue.Size() == 0
@@ -127,9 +163,11 @@ func (c *MDConfig) CopyTo(target Configuration) {
 	newConf.InternalPrevious = c
 	newConf.CurrentLatNode = c.CurrentLatNode
 	newConf.popped = c.popped
+	newConf.unconstrained = c.unconstrained
 	newConf.POP = c.POP
 	newConf.Transitions = c.Transitions
 	newConf.ParamFunc = c.ParamFunc
+	newConf.Settings = c.Settings
 }
 
 func (c *MDConfig) GetSequence() ConfigurationSequence {
@@ -163,7 +201,7 @@ func (c *MDConfig) State() byte {
 		return 'L'
 	}
 	qTop, qExists := c.LatticeQueue.Peek()
-	if UsePOP && ((!qExists && len(c.Mappings) != c.popped) ||
+	if c.usePOP() && ((!qExists && len(c.Mappings) != c.popped) ||
 		(qExists && qTop != c.popped)) {
 		// can pop
 		return 'P'
@@ -300,11 +338,15 @@ func (c *MDConfig) Clear() {
 	c.InternalPrevious = nil
 }
 
+func (c *MDConfig) GetMappings() nlp.Mappings {
+	return c.Mappings
+}
+
 func (c *MDConfig) AddSpellout(spellout string, paramFunc nlp.MDParam) bool {
 	// log.Println("\tAdding spellout")
 	if curLatticeId, exists := c.LatticeQueue.Pop(); exists {
 		curLattice := c.Lattices[curLatticeId]
-		if UsePOP && POP_ONLY_VAR_LEN {
+		if c.usePOP() && POP_ONLY_VAR_LEN {
 			poppedLat := c.Lattices[curLatticeId]
 			// only need to pop variable length
 			if !poppedLat.IsVarLen() {
@@ -381,7 +423,7 @@ func (c *MDConfig) AddMapping(m *nlp.EMorpheme) {
 	if currentLat := c.Lattices[currentLatIdx]; c.CurrentLatNode == currentLat.Top() {
 		// log.Println("\tPopping lattice queue")
 		poppedIndex, _ := c.LatticeQueue.Pop()
-		if UsePOP && POP_ONLY_VAR_LEN {
+		if c.usePOP() && POP_ONLY_VAR_LEN {
 			poppedLat := c.Lattices[poppedIndex]
 			// only need to pop variable length
 			if !poppedLat.IsVarLen() {
@@ -398,6 +440,36 @@ func (c *MDConfig) AddMapping(m *nlp.EMorpheme) {
 	c.Morphemes = append(c.Morphemes, m)
 }
 
+// allowedNexts returns the edges leaving the current node of the lattice at
+// the top of the queue that keep the token's constraint satisfiable; if none
+// does, every edge is allowed and kept is false
+func (c *MDConfig) allowedNexts(lat *nlp.Lattice) (nexts []int, kept bool) {
+	nexts = lat.Next[c.CurrentLatNode]
+	if len(lat.Constraint) == 0 {
+		return nexts, true
+	}
+	var pos int
+	if currentLatIdx, _ := c.LatticeQueue.Peek(); currentLatIdx < len(c.Mappings) {
+		pos = len(c.Mappings[currentLatIdx].Spellout)
+	}
+	allowed := make([]int, 0, len(nexts))
+	for _, next := range nexts {
+		if lat.Constraint.Allows(lat, pos, lat.Morphemes[next]) {
+			allowed = append(allowed, next)
+		}
+	}
+	if len(allowed) == 0 {
+		return nexts, false
+	}
+	return allowed, true
+}
+
+// Unconstrained reports whether a transition broke a constraint of the
+// lattices
+func (c *MDConfig) Unconstrained() bool {
+	return c.unconstrained
+}
+
 func (c *MDConfig) Address(location []byte, sourceOffset int) (int, bool, bool) {
 	source := c.GetSource(location[0])
 	if source == nil {
@@ -408,11 +480,8 @@ func (c *MDConfig) Address(location []byte, sourceOffset int) (int, bool, bool)
 		exists    bool
 	)
 	// test if feature address is a generator of feature (e.g. for each child..)
-	locationLen := len(location)
-	if location[0] == 'L' && locationLen >= 4 {
-		if string(location[2:4]) == "Ci" {
-			return atAddress, true, true
-		}
+	if location[0] == 'L' && IsGeneratorAddress(location) {
+		return atAddress, true, true
 	}
 	sourceOffsetInt := int(sourceOffset)
 	// log.Println("\tUsing sourceOffset", sourceOffset, "computed as", sourceOffsetInt, "for", location)
@@ -469,7 +538,7 @@ func (c *MDConfig) Attribute(source byte, nodeID int, attribute []byte, transiti
 				att = morpheme.EFCPOS
 				return
 			} else {
-				if SwitchFormLemma {
+				if c.switchFormLemma() {
 					att = morpheme.Lemma
 				} else {
 					att = morpheme.EForm
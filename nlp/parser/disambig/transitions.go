@@ -70,7 +70,10 @@ func (t *MDTrans) Transition(from Configuration, transition Transition) Configur
 		log.Println("\tAt lattice", qTop, "-", lattice.Token)
 		log.Println("\tCurrent lat node", c.CurrentLatNode)
 	}
-	nexts, _ := lattice.Next[c.CurrentLatNode]
+	nexts, kept := c.allowedNexts(&lattice)
+	if !kept {
+		c.unconstrained = true
+	}
 	if TSAllOut || t.Log {
 		log.Println("\tNexts are", nexts)
 		log.Println("\tMorphemes are", lattice.Morphemes)
@@ -102,7 +105,7 @@ func (t *MDTrans) Transition(from Configuration, transition Transition) Configur
 		}
 	}
 	if foundMorph != nil {
-		if LEMMAS && ambLemmas != nil && len(ambLemmas) > 1 {
+		if c.lemmas() && ambLemmas != nil && len(ambLemmas) > 1 {
 			if TSAllOut || t.Log {
 				log.Println("Add lemma ambiguity", ambLemmas)
 			}
@@ -151,7 +154,7 @@ func (t *MDTrans) possibleTransitions(conf *MDConfig, transitions chan int) {
 		if qExists {
 			lat := conf.Lattices[qTop]
 			if conf.CurrentLatNode < lat.Top() {
-				nextList, _ := lat.Next[conf.CurrentLatNode]
+				nextList, _ := conf.allowedNexts(&lat)
 				if t.Log {
 					log.Println("\t\tpossible transitions", nextList)
 				}
@@ -30,6 +30,7 @@ var (
 	_ dep.DependencyConfiguration = &JointConfig{}
 	_ nlp.DependencyGraph         = &JointConfig{}
 	_ nlp.MorphDependencyGraph    = &JointConfig{}
+	_ nlp.Constrained             = &JointConfig{}
 )
 
 func (c *JointConfig) Init(abstractLattice interface{}) {
@@ -51,6 +52,47 @@ func (c *JointConfig) Init(abstractLattice interface{}) {
 	c.InternalPrevious = nil
 }
 
+// nodeOf returns the node ID of a morpheme of the sentence, or
+// dep.FORCED_FUTURE if it wasn't disambiguated yet
+func (c *JointConfig) nodeOf(ref nlp.MorphRef) int {
+	if ref.IsRoot() {
+		return dep.FORCED_ROOT
+	}
+	var offset int
+	for i := 0; i < ref.Token && i < len(c.MDConfig.Mappings); i++ {
+		offset += len(c.MDConfig.Mappings[i].Spellout)
+	}
+	if ref.Token >= len(c.MDConfig.Mappings) || ref.Morph >= len(c.MDConfig.Mappings[ref.Token].Spellout) {
+		return dep.FORCED_FUTURE
+	}
+	return offset + ref.Morph
+}
+
+// resolveForcedArcs translates the arcs of the lattice constraints to the
+// nodes disambiguated so far
+func (c *JointConfig) resolveForcedArcs() []dep.ForcedArc {
+	var arcs []dep.ForcedArc
+	for token, lat := range c.MDConfig.Lattices {
+		for morph, constraint := range lat.Constraint {
+			if constraint.Head == nil {
+				continue
+			}
+			arcs = append(arcs, dep.ForcedArc{
+				Head:     c.nodeOf(*constraint.Head),
+				Modifier: c.nodeOf(nlp.MorphRef{Token: token, Morph: morph}),
+				Relation: constraint.Relation,
+			})
+		}
+	}
+	return arcs
+}
+
+// Unconstrained reports whether a transition broke a constraint of the
+// segmentation or a forced arc
+func (c *JointConfig) Unconstrained() bool {
+	return c.MDConfig.Unconstrained() || c.SimpleConfiguration.Unconstrained()
+}
+
 func (c *JointConfig) State() byte {
 	return 'J'
 }
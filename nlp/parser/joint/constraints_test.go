@@ -0,0 +1,257 @@
+package joint
+
+import (
+	"testing"
+	"yap/alg/graph"
+	"yap/alg/search"
+	"yap/alg/transition"
+	"yap/alg/transition/model"
+	dep "yap/nlp/parser/dependency/transition"
+	"yap/nlp/parser/disambig"
+	nlp "yap/nlp/types"
+	"yap/util"
+)
+
+var testRelations = []nlp.DepRel{nlp.DepRel(nlp.ROOT_LABEL), "obj", "subj"}
+
+func testMorph(id, from, to int, form, pos string) *nlp.EMorpheme {
+	return &nlp.EMorpheme{Morpheme: nlp.Morpheme{
+		BasicDirectedEdge: graph.BasicDirectedEdge{id, from, to},
+		Form:              form,
+		Lemma:             form,
+		CPOS:              pos,
+		POS:               pos,
+	}}
+}
+
+// testSentence is BGN, either B+GN or BGN, followed by the unambiguous XY
+// and Z
+func testSentence() nlp.LatticeSentence {
+	return nlp.LatticeSentence{
+		{
+			Token: "BGN",
+			Morphemes: nlp.Morphemes{
+				testMorph(0, 0, 1, "B", "PREPOSITION"),
+				testMorph(1, 0, 2, "BGN", "NNP"),
+				testMorph(2, 1, 2, "GN", "NN"),
+			},
+			Next:     map[int][]int{0: {0, 1}, 1: {2}},
+			BottomId: 0,
+			TopId:    2,
+		},
+		{
+			Token:     "XY",
+			Morphemes: nlp.Morphemes{testMorph(0, 2, 3, "XY", "VB")},
+			Next:      map[int][]int{2: {0}},
+			BottomId:  2,
+			TopId:     3,
+		},
+		{
+			Token:     "Z",
+			Morphemes: nlp.Morphemes{testMorph(0, 3, 4, "Z", "NN")},
+			Next:      map[int][]int{3: {0}},
+			BottomId:  3,
+			TopId:     4,
+		},
+	}
+}
+
+// testBeam returns a joint parser with a model of zero weights, which
+// leaves every choice the constraints don't make to the order of the
+// candidates
+func testBeam() *search.Beam {
+	search.AllOut = false
+	eTrans := util.NewEnumSet(100)
+	for _, name := range []string{"NO", "SH", "RE", "AL", "AR", "PR"} {
+		eTrans.Add(name)
+	}
+	eRel := util.NewEnumSet(len(testRelations))
+	for _, rel := range testRelations {
+		eRel.Add(rel)
+	}
+	eRel.Frozen = true
+	left := eTrans.Len()
+	for _, rel := range testRelations {
+		eTrans.Add("LA-" + string(rel))
+	}
+	right := eTrans.Len()
+	for _, rel := range testRelations {
+		eTrans.Add("RA-" + string(rel))
+	}
+	iPOP, _ := eTrans.Add("POP")
+	pop := &transition.TypedTransition{T: 'P', V: iPOP}
+	paramFunc := func(m *nlp.EMorpheme) string {
+		return m.Form + "_" + m.POS
+	}
+	settings := &disambig.Settings{UsePOP: true}
+	mdTrans := &disambig.MDTrans{
+		ParamFunc:   paramFunc,
+		UsePOP:      true,
+		POP:         pop,
+		Transitions: eTrans,
+	}
+	arcSystem := &dep.ArcEager{
+		ArcStandard: dep.ArcStandard{
+			SHIFT:       1,
+			LEFT:        left,
+			RIGHT:       right,
+			Relations:   eRel,
+			Transitions: eTrans,
+		},
+		REDUCE:  2,
+		POPROOT: 5,
+	}
+	jointTrans := &JointTrans{
+		MDTrans:       mdTrans,
+		ArcSys:        arcSystem,
+		Transitions:   eTrans,
+		MDTransition:  transition.ConstTransition(iPOP + 1),
+		JointStrategy: "ArcGreedy",
+	}
+	eWord, ePOS, eWPOS := util.NewEnumSet(10), util.NewEnumSet(10), util.NewEnumSet(10)
+	eMHost, eMSuffix, eMorphProp, eTokens := util.NewEnumSet(10), util.NewEnumSet(10), util.NewEnumSet(10), util.NewEnumSet(10)
+	conf := &JointConfig{
+		SimpleConfiguration: dep.SimpleConfiguration{
+			EWord:    eWord,
+			EPOS:     ePOS,
+			EWPOS:    eWPOS,
+			EMHost:   eMHost,
+			EMSuffix: eMSuffix,
+			ERel:     eRel,
+			ETrans:   eTrans,
+		},
+		MDConfig: disambig.MDConfig{
+			ETokens:     eTokens,
+			POP:         pop,
+			Transitions: eTrans,
+			ParamFunc:   paramFunc,
+			Settings:    settings,
+		},
+		MDTrans: transition.ConstTransition(iPOP + 1),
+	}
+	setup := &transition.FeatureSetup{}
+	extractor := &transition.GenericExtractor{
+		EFeatures:  util.NewEnumSet(setup.NumFeatures()),
+		EWord:      eWord,
+		EPOS:       ePOS,
+		EWPOS:      eWPOS,
+		ERel:       eRel,
+		EMHost:     eMHost,
+		EMSuffix:   eMSuffix,
+		EMorphProp: eMorphProp,
+		EToken:     eTokens,
+		POPTrans:   pop,
+	}
+	extractor.InitTypes([]byte("MPLA"))
+	extractor.LoadFeatureSetup(setup)
+	return &search.Beam{
+		TransFunc:            jointTrans,
+		FeatExtractor:        extractor,
+		Base:                 conf,
+		Model:                model.NewAvgMatrixSparse(setup.NumFeatures(), nil, false),
+		Size:                 4,
+		ConcurrentExec:       true,
+		Transitions:          eTrans,
+		EstimatedTransitions: 100,
+		ShortTempAgenda:      true,
+	}
+}
+
+func parseConstrained(t *testing.T, constraints map[int]nlp.TokenConstraint) *JointConfig {
+	sent := testSentence()
+	if err := sent.Constrain(constraints); err != nil {
+		t.Fatal(err)
+	}
+	result, _ := testBeam().Parse(sent)
+	parsed := result.(*JointConfig)
+	if parsed.Unconstrained() {
+		t.Errorf("Expected the parse to keep the constraints %v", constraints)
+	}
+	return parsed
+}
+
+func spelloutForms(spellout nlp.Spellout) []string {
+	forms := make([]string, len(spellout))
+	for i, m := range spellout {
+		forms[i] = m.Form
+	}
+	return forms
+}
+
+func TestForcedSegmentation(t *testing.T) {
+	for _, expected := range [][]string{{"B", "GN"}, {"BGN"}} {
+		constraint := make(nlp.TokenConstraint, len(expected))
+		for i, form := range expected {
+			constraint[i].Form = form
+		}
+		parsed := parseConstrained(t, map[int]nlp.TokenConstraint{0: constraint})
+		forms := spelloutForms(parsed.Mappings[0].Spellout)
+		if len(forms) != len(expected) {
+			t.Errorf("Expected segmentation %v, got %v", expected, forms)
+			continue
+		}
+		for i := range forms {
+			if forms[i] != expected[i] {
+				t.Errorf("Expected segmentation %v, got %v", expected, forms)
+				break
+			}
+		}
+	}
+}
+
+func TestForcedArc(t *testing.T) {
+	// with BGN unsegmented the morphemes are BGN (0), XY (1) and Z (2)
+	refs := []nlp.MorphRef{{Token: 0}, {Token: 1}, {Token: 2}}
+	for modifier := range refs {
+		for head := -1; head < len(refs); head++ {
+			if head == modifier {
+				continue
+			}
+			headRef := nlp.MorphRef{Token: nlp.ROOT_REF}
+			if head >= 0 {
+				headRef = refs[head]
+			}
+			constraints := map[int]nlp.TokenConstraint{0: {{Form: "BGN"}}}
+			relation := nlp.DepRel("obj")
+			if head < 0 {
+				relation = nlp.DepRel(nlp.ROOT_LABEL)
+			}
+			constraint := constraints[refs[modifier].Token]
+			if constraint == nil {
+				constraint = nlp.TokenConstraint{{}}
+			}
+			constraint[0].Head, constraint[0].Relation = &headRef, relation
+			constraints[refs[modifier].Token] = constraint
+
+			parsed := parseConstrained(t, constraints)
+			arcs := parsed.SimpleConfiguration.Arcs().Get(&dep.BasicDepArc{Head: -1, Relation: -1, Modifier: modifier})
+			if len(arcs) != 1 {
+				t.Errorf("Expected a head of %d forced to %d, got %v", modifier, head, arcs)
+				continue
+			}
+			arc := arcs[0]
+			expectedHead := head
+			if head < 0 {
+				expectedHead = 0
+			}
+			if arc.GetHead() != expectedHead || arc.GetRelation() != relation {
+				t.Errorf("Expected forced arc %d -%s-> %d, got %d -%s-> %d", head, relation, modifier, arc.GetHead(), arc.GetRelation(), arc.GetModifier())
+			}
+		}
+	}
+}
+
+func TestUnkeptConstraints(t *testing.T) {
+	// XY and Z can't head each other
+	sent := testSentence()
+	if err := sent.Constrain(map[int]nlp.TokenConstraint{
+		1: {{Head: &nlp.MorphRef{Token: 2}}},
+		2: {{Head: &nlp.MorphRef{Token: 1}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	result, _ := testBeam().Parse(sent)
+	if !result.(*JointConfig).Unconstrained() {
+		t.Error("Expected the parse to break a constraint")
+	}
+}
@@ -43,7 +43,11 @@ func (t *JointTrans) Transition(from Configuration, transition Transition) Confi
 	// transition systems
 	c := from.Copy().(*JointConfig)
 	if transition.Type() == 'M' || transition.Type() == 'P' || transition.Type() == 'L' {
-		t.MDTrans.(*disambig.MDTrans).Log = t.Log
+		// concurrent searches share the transition system, only write
+		// when the setting changed
+		if md := t.MDTrans.(*disambig.MDTrans); md.Log != t.Log {
+			md.Log = t.Log
+		}
 		// log.Println("Applying transition", t.Transitions.ValueOf(transition.Value()), "to\n", c.MDConfig)
 		c.MDConfig = *t.MDTrans.Transition(&c.MDConfig, transition).(*disambig.MDConfig)
 		// log.Println("MD Config is now:\n", c.MDConfig)
@@ -77,7 +81,7 @@ func (t *JointTrans) Transition(from Configuration, transition Transition) Confi
 			c.SimpleConfiguration.Nodes = append(c.SimpleConfiguration.Nodes,
 				dep.NewArcCachedDepNode(DepNode(newNode)))
 			c.Assign(c.MDConfig.Assignment())
-
+			c.SimpleConfiguration.ForcedArcs = c.resolveForcedArcs()
 		}
 	} else {
 		c.SimpleConfiguration = *t.ArcSys.Transition(&c.SimpleConfiguration, transition).(*dep.SimpleConfiguration)
@@ -0,0 +1,114 @@
+package ma
+
+import (
+	"yap/alg/graph"
+	. "yap/nlp/types"
+	"yap/util"
+
+	"fmt"
+	"strings"
+)
+
+// ANY_PREFIX allows an entry after every prefix of the prefix lexicon
+const ANY_PREFIX = "*"
+
+// Entry is an extra lexical entry of a single morpheme host
+type Entry struct {
+	Form     string `json:"form"`
+	Lemma    string `json:"lemma,omitempty"`
+	POS      string `json:"pos"`
+	Features string `json:"features,omitempty"`
+	// prefixes the host may follow; without any only the bare form matches
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+type entryAnalysis struct {
+	host     BasicMorphemes
+	prefixes map[string]bool
+}
+
+func (e *entryAnalysis) allows(prefix string) bool {
+	return len(prefix) == 0 || e.prefixes[ANY_PREFIX] || e.prefixes[prefix]
+}
+
+func (l *BGULex) newEntryAnalysis(e Entry) (*entryAnalysis, error) {
+	if len(e.Form) == 0 || strings.ContainsAny(e.Form, " \t\r\n") {
+		return nil, fmt.Errorf("invalid form %q", e.Form)
+	}
+	if len(e.POS) == 0 {
+		return nil, fmt.Errorf("entry %q has no POS", e.Form)
+	}
+	if len(e.Features) > 0 {
+		for _, feature := range strings.Split(e.Features, "|") {
+			if pair := strings.Split(feature, "="); len(pair) != 2 || len(pair[0]) == 0 || len(pair[1]) == 0 {
+				return nil, fmt.Errorf("entry %q has malformed features %q", e.Form, e.Features)
+			}
+		}
+	}
+	analysis := &entryAnalysis{prefixes: make(map[string]bool, len(e.Prefixes))}
+	for _, prefix := range e.Prefixes {
+		if _, exists := l.Prefixes[prefix]; prefix != ANY_PREFIX && !exists {
+			return nil, fmt.Errorf("entry %q has unknown prefix %q", e.Form, prefix)
+		}
+		analysis.prefixes[prefix] = true
+	}
+	lemma := e.Lemma
+	if len(lemma) == 0 {
+		lemma = e.Form
+	}
+	featureStr, features := util.MergeFeatureStrs(e.Features, "")
+	analysis.host = BasicMorphemes{&Morpheme{
+		BasicDirectedEdge: graph.BasicDirectedEdge{0, 0, 1},
+		Form:              e.Form,
+		Lemma:             lemma,
+		CPOS:              e.POS,
+		POS:               e.POS,
+		Features:          features,
+		FeatureStr:        featureStr,
+	}}
+	return analysis, nil
+}
+
+// SetEntries adds extra entries to the lexicon looked up by this analyzer;
+// the entries are merged with the analyses of the same form in Lex, which is
+// left untouched
+func (l *BGULex) SetEntries(entries []Entry) error {
+	byForm := make(map[string][]*entryAnalysis, len(entries))
+	for _, e := range entries {
+		analysis, err := l.newEntryAnalysis(e)
+		if err != nil {
+			return err
+		}
+		byForm[e.Form] = append(byForm[e.Form], analysis)
+	}
+	l.entries = byForm
+	return nil
+}
+
+// lookup returns the analyses of a host following a prefix (empty for a bare
+// host): those of the user lexicon, or of Lex if it has none, and of the extra
+// entries allowing the prefix
+func (l *BGULex) lookup(prefix, host string) ([]BasicMorphemes, bool) {
+	var (
+		hostLat []BasicMorphemes
+		exists  bool
+	)
+	if l.User != nil {
+		hostLat, exists = l.User.Lookup(host)
+	}
+	if !exists {
+		hostLat, exists = l.Lex[host]
+	}
+	entries := l.entries[host]
+	if len(entries) == 0 {
+		return hostLat, exists
+	}
+	merged := make([]BasicMorphemes, len(hostLat), len(hostLat)+len(entries))
+	copy(merged, hostLat)
+	for _, e := range entries {
+		if e.allows(prefix) {
+			merged = append(merged, e.host)
+		}
+	}
+	return merged, len(merged) > 0
+}
@@ -19,13 +19,19 @@ type BGULex struct {
 	Prefixes     map[string][]BasicMorphemes
 
 	Lex map[string][]BasicMorphemes
+	// consulted before Lex, shared by all analyzers; may be nil
+	User *UserLex
+	// extra entries of this analyzer, see SetEntries
+	entries map[string][]*entryAnalysis
 
 	Files []string
 	Stats *AnalyzeStats
 
 	AlwaysNNP bool
-	LogOOV    bool
-	MAType    string
+	// add an NNP without features next to every NNP of the lexicon
+	NNPNoFeats bool
+	LogOOV     bool
+	MAType     string
 }
 
 var (
@@ -64,7 +70,7 @@ var (
 )
 
 func (l *BGULex) loadTokens(file, format string) {
-	tokens, err := lex.ReadFile(file, format, l.MAType)
+	tokens, err := lex.ReadLexFile(file, format, l.MAType, l.NNPNoFeats)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to load %v: %v", file, err))
 	}
@@ -99,6 +105,12 @@ func (l *BGULex) LoadPrefixes(file string) {
 
 func (l *BGULex) LoadLex(file string, nnpnofeats bool) {
 	lex.ADD_NNP_NO_FEATS = nnpnofeats
+	l.NNPNoFeats = nnpnofeats
+	l.LoadLexFile(file)
+}
+
+// LoadLexFile loads the lexicon, adding NNPs without features if NNPNoFeats
+func (l *BGULex) LoadLexFile(file string) {
 	l.loadTokens(file, "lexicon")
 	log.Println("Loaded", len(l.Lex), "tokens from lexicon")
 }
@@ -200,7 +212,7 @@ func (l *BGULex) analyzeTokenForLen(lat *Lattice, input string, startingNode, nu
 				}
 			}
 		}
-		hostLat, hostExists = l.Lex[hostStr]
+		hostLat, hostExists = l.lookup(input[0:prefixLen*2], hostStr)
 		if !hostExists {
 			hostLat, hostExists = checkRegexes(hostStr)
 		}
@@ -254,7 +266,7 @@ func (l *BGULex) AnalyzeToken(input string, startingNode, indexToken int) (*Latt
 		// oovLat := l.OOVAnalysis(input)
 		// lat.AddAnalysis(nil, oovLat, numToken)
 	}
-	hostLat, hostExists = l.Lex[input]
+	hostLat, hostExists = l.lookup("", input)
 	if !hostExists {
 		hostLat, hostExists = checkRegexes(input)
 	}
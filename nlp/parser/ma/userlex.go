@@ -0,0 +1,213 @@
+package ma
+
+import (
+	"yap/nlp/format/lex"
+	. "yap/nlp/types"
+
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// UserLex is a lexicon overlay whose analyses take precedence over the BGU
+// lexicon and the OOV heuristics. It can be edited while in use: every edit
+// builds a new snapshot that replaces the previous one atomically, so
+// lookups never see a partial update.
+type UserLex struct {
+	// File persists the lexicon, in the lexicon file format; empty for an
+	// in-memory lexicon
+	File   string
+	MAType string
+
+	// serializes edits
+	mutex    sync.Mutex
+	snapshot atomic.Value
+}
+
+type userLexSnapshot struct {
+	// lexicon file lines of every token, kept for persistence
+	lines map[string][]string
+	lex   map[string][]BasicMorphemes
+}
+
+// NewUserLex returns a user lexicon loaded from file, if it exists
+func NewUserLex(file, maType string) (*UserLex, error) {
+	u := &UserLex{File: file, MAType: maType}
+	snapshot := &userLexSnapshot{
+		lines: make(map[string][]string),
+		lex:   make(map[string][]BasicMorphemes),
+	}
+	if len(file) > 0 {
+		content, err := ioutil.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for i, line := range strings.Split(string(content), "\n") {
+			if len(strings.TrimSpace(line)) == 0 {
+				continue
+			}
+			token, err := u.parse(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %v", file, i+1, err)
+			}
+			snapshot.lines[token.Token] = append(snapshot.lines[token.Token], line)
+			snapshot.lex[token.Token] = append(snapshot.lex[token.Token], token.Morphemes...)
+		}
+	}
+	u.snapshot.Store(snapshot)
+	return u, nil
+}
+
+// parse reads a single lexicon file line
+func (u *UserLex) parse(line string) (token *lex.AnalyzedToken, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			token, err = nil, fmt.Errorf("failed parsing %q: %v", line, r)
+		}
+	}()
+	if strings.ContainsAny(line, "\r\n") {
+		return nil, fmt.Errorf("more than one line in %q", line)
+	}
+	var reader lex.LexReader = lex.ProcessAnalyzedToken
+	if u.MAType == "ud" {
+		reader = lex.ProcessUDAnalyzedToken
+	}
+	token, err = reader(line)
+	if err == nil && token == nil {
+		err = fmt.Errorf("no analyses in %q", line)
+	}
+	return token, err
+}
+
+func (u *UserLex) current() *userLexSnapshot {
+	return u.snapshot.Load().(*userLexSnapshot)
+}
+
+// Lookup returns the analyses of a token
+func (u *UserLex) Lookup(token string) ([]BasicMorphemes, bool) {
+	morphs, exists := u.current().lex[token]
+	return morphs, exists
+}
+
+func (u *UserLex) Len() int {
+	return len(u.current().lex)
+}
+
+// Lines returns the lexicon file lines of all tokens, sorted
+func (u *UserLex) Lines() []string {
+	snapshot := u.current()
+	lines := make([]string, 0, len(snapshot.lines))
+	for _, tokenLines := range snapshot.lines {
+		lines = append(lines, tokenLines...)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// Validate returns the first error parsing lexicon file lines
+func (u *UserLex) Validate(lines []string) error {
+	for _, line := range lines {
+		if _, err := u.parse(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add adds lexicon file lines, replacing the analyses of their tokens
+func (u *UserLex) Add(lines []string) error {
+	parsed := make(map[string][]*lex.AnalyzedToken, len(lines))
+	added := make(map[string][]string, len(lines))
+	for _, line := range lines {
+		token, err := u.parse(line)
+		if err != nil {
+			return err
+		}
+		parsed[token.Token] = append(parsed[token.Token], token)
+		added[token.Token] = append(added[token.Token], line)
+	}
+	return u.edit(func(snapshot *userLexSnapshot) {
+		for token, tokenLines := range added {
+			snapshot.lines[token] = tokenLines
+			var morphs []BasicMorphemes
+			for _, analyzed := range parsed[token] {
+				morphs = append(morphs, analyzed.Morphemes...)
+			}
+			snapshot.lex[token] = morphs
+		}
+	})
+}
+
+// Remove removes tokens and returns how many existed
+func (u *UserLex) Remove(tokens []string) (int, error) {
+	var removed int
+	err := u.edit(func(snapshot *userLexSnapshot) {
+		for _, token := range tokens {
+			if _, exists := snapshot.lex[token]; exists {
+				delete(snapshot.lines, token)
+				delete(snapshot.lex, token)
+				removed++
+			}
+		}
+	})
+	return removed, err
+}
+
+// edit applies a change to a copy of the current snapshot, persists it and
+// swaps it in; a failure to persist leaves the lexicon unchanged
+func (u *UserLex) edit(change func(*userLexSnapshot)) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	current := u.current()
+	next := &userLexSnapshot{
+		lines: make(map[string][]string, len(current.lines)),
+		lex:   make(map[string][]BasicMorphemes, len(current.lex)),
+	}
+	for token, lines := range current.lines {
+		next.lines[token] = lines
+	}
+	for token, morphs := range current.lex {
+		next.lex[token] = morphs
+	}
+	change(next)
+	if err := next.write(u.File); err != nil {
+		return err
+	}
+	u.snapshot.Store(next)
+	return nil
+}
+
+// write replaces the file through a rename so a crash never leaves it
+// truncated
+func (s *userLexSnapshot) write(file string) error {
+	if len(file) == 0 {
+		return nil
+	}
+	tokens := make([]string, 0, len(s.lines))
+	for token := range s.lines {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	for _, token := range tokens {
+		for _, line := range s.lines[token] {
+			if _, err := fmt.Fprintln(tmp, line); err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
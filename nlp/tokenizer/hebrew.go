@@ -0,0 +1,239 @@
+// Package tokenizer splits running Hebrew text into sentences and tokens
+// in the form expected by the morphological analyzer, keeping track of the
+// position of every token in the original text
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+
+	nlp "yap/nlp/types"
+)
+
+const (
+	MAQAF      = '־'
+	GERESH     = '׳'
+	GERSHAYIM  = '״'
+	ELLIPSIS   = '…'
+	DOTS       = "..."
+	QUOTE      = "\""
+	APOSTROPHE = "'"
+	DASH       = "-"
+)
+
+var (
+	// sentence final tokens
+	TERMINALS = map[string]bool{
+		".":  true,
+		"!":  true,
+		"?":  true,
+		DOTS: true,
+	}
+	// tokens that close a sentence following a terminal, e.g. a closing quote
+	CLOSERS = map[string]bool{
+		QUOTE:      true,
+		APOSTROPHE: true,
+		")":        true,
+		"]":        true,
+	}
+)
+
+// Token is a normalized token and its span in the original text.
+// Start and End are offsets in characters (unicode code points), End exclusive.
+type Token struct {
+	Text       string
+	Start, End int
+}
+
+type Sentence []Token
+
+func (s Sentence) BasicSentence() nlp.BasicSentence {
+	retval := make(nlp.BasicSentence, len(s))
+	for i, token := range s {
+		retval[i] = nlp.Token(token.Text)
+	}
+	return retval
+}
+
+func isHebrewLetter(r rune) bool {
+	return r >= 'א' && r <= 'ײ'
+}
+
+// niqqud and cantillation marks are dropped from token text
+func isMark(r rune) bool {
+	return unicode.Is(unicode.Mn, r)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || isMark(r)
+}
+
+func isDoubleQuote(r rune) bool {
+	switch r {
+	case '"', GERSHAYIM, '“', '”', '„', '«', '»':
+		return true
+	}
+	return false
+}
+
+func isSingleQuote(r rune) bool {
+	switch r {
+	case '\'', GERESH, '‘', '’', '`':
+		return true
+	}
+	return false
+}
+
+func isDash(r rune) bool {
+	switch r {
+	case '-', MAQAF, '‐', '‑', '‒', '–', '—', '―':
+		return true
+	}
+	return false
+}
+
+// normalize maps geresh/gershayim variants to their ASCII forms and drops
+// diacritics
+func normalize(word []rune) string {
+	var b strings.Builder
+	for _, r := range word {
+		switch {
+		case isMark(r):
+			continue
+		case isDoubleQuote(r):
+			b.WriteRune('"')
+		case isSingleQuote(r):
+			b.WriteRune('\'')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+type tokenizer struct {
+	text   []rune
+	tokens []Token
+	// paragraph breaks (blank lines) preceding each token
+	breaks      []bool
+	openSingle  bool
+	pendingPara bool
+}
+
+func (t *tokenizer) emit(text string, start, end int) {
+	t.tokens = append(t.tokens, Token{text, start, end})
+	t.breaks = append(t.breaks, t.pendingPara)
+	t.pendingPara = false
+}
+
+// wordEnd returns the end of the word starting at i, keeping gershayim
+// acronyms (צה"ל), geresh (ג'ירפה, פרופ') and number separators (1,000.5)
+// inside the word
+func (t *tokenizer) wordEnd(i int) int {
+	r, n := t.text, len(t.text)
+	j := i + 1
+	for j < n {
+		cur := r[j]
+		prev := r[j-1]
+		hasNext := j+1 < n
+		switch {
+		case isWordRune(cur):
+		case isDoubleQuote(cur) && unicode.IsLetter(prev) && hasNext && unicode.IsLetter(r[j+1]):
+		case isSingleQuote(cur) && isHebrewLetter(prev) && hasNext && unicode.IsLetter(r[j+1]):
+		case isSingleQuote(cur) && isHebrewLetter(prev) && !t.openSingle:
+		case (cur == '.' || cur == ',') && unicode.IsDigit(prev) && hasNext && unicode.IsDigit(r[j+1]):
+		default:
+			return j
+		}
+		j++
+	}
+	return j
+}
+
+func (t *tokenizer) run() {
+	r, n := t.text, len(t.text)
+	newlines := 0
+	for i := 0; i < n; {
+		c := r[i]
+		if unicode.IsSpace(c) {
+			if c == '\n' {
+				newlines++
+				if newlines > 1 {
+					t.pendingPara = true
+				}
+			}
+			i++
+			continue
+		}
+		newlines = 0
+		switch {
+		case isWordRune(c):
+			j := t.wordEnd(i)
+			t.emit(normalize(r[i:j]), i, j)
+			i = j
+		case c == ELLIPSIS:
+			t.emit(DOTS, i, i+1)
+			i++
+		case c == '.' && i+2 < n && r[i+1] == '.' && r[i+2] == '.':
+			j := i + 3
+			for j < n && r[j] == '.' {
+				j++
+			}
+			t.emit(DOTS, i, j)
+			i = j
+		case isDash(c):
+			t.emit(DASH, i, i+1)
+			i++
+		case isDoubleQuote(c):
+			t.emit(QUOTE, i, i+1)
+			i++
+		case isSingleQuote(c):
+			// an apostrophe directly followed by a letter opens a quotation
+			t.openSingle = i+1 < n && unicode.IsLetter(r[i+1])
+			t.emit(APOSTROPHE, i, i+1)
+			i++
+		default:
+			t.emit(string(c), i, i+1)
+			i++
+		}
+	}
+}
+
+func (t *tokenizer) sentences() []Sentence {
+	var (
+		sents   []Sentence
+		current Sentence
+	)
+	flush := func() {
+		if len(current) > 0 {
+			sents = append(sents, current)
+			current = nil
+		}
+	}
+	for i := 0; i < len(t.tokens); i++ {
+		if t.breaks[i] {
+			flush()
+		}
+		current = append(current, t.tokens[i])
+		if !TERMINALS[t.tokens[i].Text] {
+			continue
+		}
+		// attach adjacent terminals and closing quotes/brackets
+		for i+1 < len(t.tokens) && t.tokens[i+1].Start == t.tokens[i].End &&
+			(TERMINALS[t.tokens[i+1].Text] || CLOSERS[t.tokens[i+1].Text]) {
+			i++
+			current = append(current, t.tokens[i])
+		}
+		flush()
+	}
+	flush()
+	return sents
+}
+
+// Tokenize splits text into sentences of tokens. Sentences end at
+// sentence final punctuation or at a blank line.
+func Tokenize(text string) []Sentence {
+	t := &tokenizer{text: []rune(text)}
+	t.run()
+	return t.sentences()
+}
@@ -0,0 +1,95 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func texts(sents []Sentence) [][]string {
+	retval := make([][]string, len(sents))
+	for i, sent := range sents {
+		for _, token := range sent {
+			retval[i] = append(retval[i], token.Text)
+		}
+	}
+	return retval
+}
+
+func checkTokens(t *testing.T, input string, expected [][]string) {
+	got := texts(Tokenize(input))
+	if len(got) != len(expected) {
+		t.Errorf("%q: expected %d sentences got %d: %v", input, len(expected), len(got), got)
+		return
+	}
+	for i := range expected {
+		if strings.Join(got[i], " ") != strings.Join(expected[i], " ") {
+			t.Errorf("%q: sentence %d: expected %v got %v", input, i, expected[i], got[i])
+		}
+	}
+}
+
+func TestTokenizePunctuation(t *testing.T) {
+	checkTokens(t, "שלום, עולם! מה נשמע?", [][]string{
+		{"שלום", ",", "עולם", "!"},
+		{"מה", "נשמע", "?"},
+	})
+}
+
+func TestTokenizeGershayim(t *testing.T) {
+	checkTokens(t, "חיילי צה\"ל ודו״ח המבקר.", [][]string{
+		{"חיילי", "צה\"ל", "ודו\"ח", "המבקר", "."},
+	})
+}
+
+func TestTokenizeGeresh(t *testing.T) {
+	checkTokens(t, "ג'ירפה ופרופ׳ כהן", [][]string{
+		{"ג'ירפה", "ופרופ'", "כהן"},
+	})
+}
+
+func TestTokenizeMaqaf(t *testing.T) {
+	checkTokens(t, "בית־ספר תל-אביב", [][]string{
+		{"בית", "-", "ספר", "תל", "-", "אביב"},
+	})
+}
+
+func TestTokenizeQuotes(t *testing.T) {
+	checkTokens(t, "הוא אמר: \"שלום.\" ואז הלך", [][]string{
+		{"הוא", "אמר", ":", "\"", "שלום", ".", "\""},
+		{"ואז", "הלך"},
+	})
+	checkTokens(t, "המילה 'שלום' נפוצה", [][]string{
+		{"המילה", "'", "שלום", "'", "נפוצה"},
+	})
+}
+
+func TestTokenizeNumbers(t *testing.T) {
+	checkTokens(t, "עלה 1,000.5 שקלים...", [][]string{
+		{"עלה", "1,000.5", "שקלים", "..."},
+	})
+}
+
+func TestTokenizeParagraphs(t *testing.T) {
+	checkTokens(t, "כותרת\n\nגוף הטקסט", [][]string{
+		{"כותרת"},
+		{"גוף", "הטקסט"},
+	})
+}
+
+func TestTokenizeOffsets(t *testing.T) {
+	input := "אָבִי, צה״ל."
+	runes := []rune(input)
+	sents := Tokenize(input)
+	if len(sents) != 1 || len(sents[0]) != 4 {
+		t.Fatalf("unexpected tokenization %v", texts(sents))
+	}
+	expected := []string{"אָבִי", ",", "צה״ל", "."}
+	for i, token := range sents[0] {
+		if span := string(runes[token.Start:token.End]); span != expected[i] {
+			t.Errorf("token %d: expected span %q got %q", i, expected[i], span)
+		}
+	}
+	if sents[0][0].Text != "אבי" {
+		t.Errorf("expected niqqud to be stripped, got %q", sents[0][0].Text)
+	}
+}
@@ -0,0 +1,102 @@
+package types
+
+import (
+	"fmt"
+)
+
+// BeamAgreement counts the morpheme and arc choices of the analyses of a
+// final beam. The confidence of a choice is the share of the analyses that
+// made the same choice; a choice made by the whole beam has confidence 1.
+type BeamAgreement struct {
+	Analyses  int
+	morphemes map[string]int
+	arcs      map[string]int
+}
+
+func NewBeamAgreement() *BeamAgreement {
+	return &BeamAgreement{
+		morphemes: make(map[string]int),
+		arcs:      make(map[string]int),
+	}
+}
+
+// MorphemeKey identifies a morpheme choice across analyses of the same
+// lattice: the lattice edge with its form, lemma, tags and features
+func MorphemeKey(m *EMorpheme) string {
+	return fmt.Sprintf("%d:%d:%d\t%s\t%s\t%s\t%s\t%s", m.TokenID, m.From(), m.To(), m.Form, m.Lemma, m.CPOS, m.POS, m.FeatureStr)
+}
+
+func arcKey(g MorphDependencyGraph, arc LabeledDepArc) string {
+	head := ROOT_TOKEN
+	if string(arc.GetRelation()) != ROOT_LABEL && arc.GetHead() >= 0 && arc.GetHead() < g.NumberOfNodes() {
+		head = MorphemeKey(g.GetMorpheme(arc.GetHead()))
+	}
+	return fmt.Sprintf("%s\n%s\n%s", MorphemeKey(g.GetMorpheme(arc.GetModifier())), head, arc.GetRelation())
+}
+
+// depArcKey identifies an arc across analyses of the same tagged sentence,
+// whose nodes are the same in all analyses
+func depArcKey(arc LabeledDepArc) string {
+	return fmt.Sprintf("%d\n%d\n%s", arc.GetModifier(), arc.GetHead(), arc.GetRelation())
+}
+
+// Add counts the choices of a single analysis, either a morphological
+// dependency graph, a disambiguated sentence with mappings or a dependency
+// graph of a tagged sentence
+func (a *BeamAgreement) Add(analysis interface{}) {
+	switch t := analysis.(type) {
+	case MorphDependencyGraph:
+		for _, nodeID := range t.GetVertices() {
+			a.morphemes[MorphemeKey(t.GetMorpheme(nodeID))]++
+			if arc := t.GetLabeledArc(nodeID); arc != nil {
+				a.arcs[arcKey(t, arc)]++
+			}
+		}
+	case interface{ GetMappings() Mappings }:
+		for _, mapping := range t.GetMappings() {
+			if mapping.Token == ROOT_TOKEN {
+				continue
+			}
+			for _, morph := range mapping.Spellout {
+				if morph != nil {
+					a.morphemes[MorphemeKey(morph)]++
+				}
+			}
+		}
+	case LabeledDependencyGraph:
+		for _, nodeID := range t.GetVertices() {
+			if arc := t.GetLabeledArc(nodeID); arc != nil {
+				a.arcs[depArcKey(arc)]++
+			}
+		}
+	default:
+		panic(fmt.Sprintf("Can't compute agreement of analysis type %T", analysis))
+	}
+	a.Analyses++
+}
+
+// Morpheme returns the share of the analyses that chose the morpheme
+func (a *BeamAgreement) Morpheme(m *EMorpheme) float64 {
+	if a.Analyses == 0 {
+		return 0
+	}
+	return float64(a.morphemes[MorphemeKey(m)]) / float64(a.Analyses)
+}
+
+// Arc returns the share of the analyses that attached the arc's modifier
+// morpheme to the same head morpheme with the same label
+func (a *BeamAgreement) Arc(g MorphDependencyGraph, arc LabeledDepArc) float64 {
+	if a.Analyses == 0 || arc == nil {
+		return 0
+	}
+	return float64(a.arcs[arcKey(g, arc)]) / float64(a.Analyses)
+}
+
+// DepArc returns the share of the analyses of a tagged sentence that
+// attached the arc's modifier to the same head with the same label
+func (a *BeamAgreement) DepArc(arc LabeledDepArc) float64 {
+	if a.Analyses == 0 || arc == nil {
+		return 0
+	}
+	return float64(a.arcs[depArcKey(arc)]) / float64(a.Analyses)
+}
@@ -0,0 +1,117 @@
+package types
+
+import (
+	"fmt"
+)
+
+// ROOT_REF is the token index of a morpheme reference to the root
+const ROOT_REF = -1
+
+// MorphRef addresses the Morph-th morpheme (zero-based) of the analysis of
+// the Token-th token (zero-based) of a sentence
+type MorphRef struct {
+	Token int `json:"token"`
+	Morph int `json:"morpheme"`
+}
+
+func (r MorphRef) IsRoot() bool {
+	return r.Token == ROOT_REF
+}
+
+// MorphConstraint fixes parts of the analysis of a single morpheme; empty
+// fields are left for the parser to fill in
+type MorphConstraint struct {
+	Form     string            `json:"form,omitempty"`
+	Lemma    string            `json:"lemma,omitempty"`
+	CPOS     string            `json:"cpos,omitempty"`
+	POS      string            `json:"pos,omitempty"`
+	Features map[string]string `json:"features,omitempty"`
+	Head     *MorphRef         `json:"head,omitempty"`
+	Relation DepRel            `json:"dep,omitempty"`
+}
+
+// Matches reports whether a lattice morpheme agrees with the constraint
+func (c *MorphConstraint) Matches(m *EMorpheme) bool {
+	if (len(c.Form) > 0 && c.Form != m.Form) ||
+		(len(c.Lemma) > 0 && c.Lemma != m.Lemma) ||
+		(len(c.CPOS) > 0 && c.CPOS != m.CPOS) ||
+		(len(c.POS) > 0 && c.POS != m.POS) {
+		return false
+	}
+	for name, value := range c.Features {
+		if m.Features[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenConstraint fixes the segmentation of a token to exactly its morphemes,
+// each optionally constrained further; a nil constraint allows any analysis
+type TokenConstraint []MorphConstraint
+
+// Allows reports whether choosing morph as the pos-th morpheme of the token
+// leaves a path through the lattice that satisfies the constraint
+func (c TokenConstraint) Allows(lat *Lattice, pos int, morph *EMorpheme) bool {
+	if pos >= len(c) || !c[pos].Matches(morph) {
+		return false
+	}
+	return c.completes(lat, morph.To(), pos+1)
+}
+
+func (c TokenConstraint) completes(lat *Lattice, node int, pos int) bool {
+	if node == lat.Top() {
+		return pos == len(c)
+	}
+	for _, next := range lat.Next[node] {
+		if c.Allows(lat, pos, lat.Morphemes[next]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Satisfiable reports whether any path through the lattice satisfies the
+// constraint
+func (c TokenConstraint) Satisfiable(lat *Lattice) bool {
+	return len(c) == 0 || c.completes(lat, lat.Bottom(), 0)
+}
+
+// Constrain sets the constraints of the lattices of a sentence, keyed by
+// token index, after checking every constraint can be satisfied
+func (s LatticeSentence) Constrain(constraints map[int]TokenConstraint) error {
+	for token, constraint := range constraints {
+		if token < 0 || token >= len(s) {
+			return fmt.Errorf("constraint for token %d out of range (sentence has %d tokens)", token, len(s))
+		}
+		if !constraint.Satisfiable(&s[token]) {
+			return fmt.Errorf("no analysis of token %d (%s) satisfies its constraint", token, s[token].Token)
+		}
+		for i, morph := range constraint {
+			if morph.Head == nil || morph.Head.IsRoot() {
+				continue
+			}
+			head := *morph.Head
+			if head.Token < 0 || head.Token >= len(s) || head.Morph < 0 {
+				return fmt.Errorf("head of morpheme %d of token %d out of range", i, token)
+			}
+			if headConstraint, exists := constraints[head.Token]; exists && head.Morph >= len(headConstraint) {
+				return fmt.Errorf("head of morpheme %d of token %d is past the segmentation of token %d", i, token, head.Token)
+			}
+			if head.Token == token && head.Morph == i {
+				return fmt.Errorf("morpheme %d of token %d can't be its own head", i, token)
+			}
+		}
+	}
+	for token, constraint := range constraints {
+		s[token].Constraint = constraint
+	}
+	return nil
+}
+
+// Constrained is a configuration parsed from constrained input; a
+// configuration is unconstrained once the parser had to break a constraint
+// no transition could keep
+type Constrained interface {
+	Unconstrained() bool
+}
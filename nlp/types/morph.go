@@ -383,6 +383,8 @@ type Lattice struct {
 	Spellouts       Spellouts
 	Next            map[int][]int
 	BottomId, TopId int
+	// Constraint, when set, restricts the analyses of the token
+	Constraint TokenConstraint
 }
 
 func (l *Lattice) Signature() string {
@@ -822,6 +824,7 @@ func NewRootLattice() Lattice {
 		make(map[int][]int),
 		0,
 		0,
+		nil,
 	}
 	return *lat
 }
@@ -31,19 +31,50 @@ var (
 )
 
 func InitOpenParamFamily(pType string) {
-	var Main_POS_Types []string
+	Main_POS_Types := OpenParamFamilyTypes(pType)
+	log.Println("Using Family", pType, "of Main_POS_Types [", Main_POS_Types, "]")
+	InitOpenParamTypes(Main_POS_Types)
+}
+
+// OpenParamFamilyTypes returns the open class POS types of a family
+func OpenParamFamilyTypes(pType string) []string {
 	switch pType {
 	case "HEBTB":
-		Main_POS_Types = []string{"ADVERB", "BN", "BNT", "CD", "CDT", "JJ", "JJT", "NN", "NNP", "NNT", "RB", "VB"}
-		break
+		return []string{"ADVERB", "BN", "BNT", "CD", "CDT", "JJ", "JJT", "NN", "NNP", "NNT", "RB", "VB"}
 	case "UD":
-		Main_POS_Types = []string{"ADJ", "AUX", "ADV", "PUNCT", "NUM", "INTJ", "NOUN", "PROPN", "VERB"}
-		break
+		return []string{"ADJ", "AUX", "ADV", "PUNCT", "NUM", "INTJ", "NOUN", "PROPN", "VERB"}
 	default:
 		panic(fmt.Sprintf("Unknown open class family %s", pType))
 	}
-	log.Println("Using Family", pType, "of Main_POS_Types [", Main_POS_Types, "]")
-	InitOpenParamTypes(Main_POS_Types)
+}
+
+// mainPOSParams are the MD param funcs that depend on the open class POS
+// types
+var mainPOSParams = map[string]func(map[string]bool, *EMorpheme) string{
+	"Funcs_Main_POS_Both_Prop":        mainPOSBothProp,
+	"Funcs_Main_POS_Both_Prop_Clitic": mainPOSBothPropClitic,
+	"Funcs_Main_POS":                  mainPOSForm,
+	"Funcs_Main_POS_Prop":             mainPOSProp,
+}
+
+// ParamFuncWithTypes returns the named MD param func, reading the given open
+// class POS types instead of Main_POS
+func ParamFuncWithTypes(name string, Main_POS_Types []string) (MDParam, bool) {
+	param, exists := MDParams[name]
+	if !exists {
+		return nil, false
+	}
+	paramWithTypes, dependsOnTypes := mainPOSParams[name]
+	if !dependsOnTypes {
+		return param, true
+	}
+	types := make(map[string]bool, len(Main_POS_Types))
+	for _, pos := range Main_POS_Types {
+		types[pos] = true
+	}
+	return func(m *EMorpheme) string {
+		return paramWithTypes(types, m)
+	}, true
 }
 
 func InitOpenParamTypes(Main_POS_Types []string) {
@@ -122,7 +153,11 @@ func Funcs_Main_POS_No_Prop(m *EMorpheme) string {
 }
 
 func Funcs_Main_POS_Both_Prop(m *EMorpheme) string {
-	if _, exists := Main_POS[m.CPOS]; exists {
+	return mainPOSBothProp(Main_POS, m)
+}
+
+func mainPOSBothProp(mainPOS map[string]bool, m *EMorpheme) string {
+	if _, exists := mainPOS[m.CPOS]; exists {
 		return fmt.Sprintf("%s_%s", m.CPOS, m.FeatureStr)
 	} else {
 		return fmt.Sprintf("%s_%s_%s", m.Form, m.CPOS, m.FeatureStr)
@@ -130,7 +165,11 @@ func Funcs_Main_POS_Both_Prop(m *EMorpheme) string {
 }
 
 func Funcs_Main_POS_Both_Prop_Clitic(m *EMorpheme) string {
-	if _, exists := Main_POS[m.CPOS]; exists {
+	return mainPOSBothPropClitic(Main_POS, m)
+}
+
+func mainPOSBothPropClitic(mainPOS map[string]bool, m *EMorpheme) string {
+	if _, exists := mainPOS[m.CPOS]; exists {
 		if len(m.Form) > 1 && strings.HasSuffix(m.Form, "_") {
 			return fmt.Sprintf("s_%s_%s", m.CPOS, m.FeatureStr)
 		} else {
@@ -163,7 +202,11 @@ func Funcs_Lemma_Main_POS(m *EMorpheme) string {
 }
 
 func Funcs_Main_POS(m *EMorpheme) string {
-	if _, exists := Main_POS[m.CPOS]; exists {
+	return mainPOSForm(Main_POS, m)
+}
+
+func mainPOSForm(mainPOS map[string]bool, m *EMorpheme) string {
+	if _, exists := mainPOS[m.CPOS]; exists {
 		return fmt.Sprintf("%s", m.CPOS)
 	} else {
 		return fmt.Sprintf("%s_%s", m.Form, m.CPOS)
@@ -171,7 +214,11 @@ func Funcs_Main_POS(m *EMorpheme) string {
 }
 
 func Funcs_Main_POS_Prop(m *EMorpheme) string {
-	if _, exists := Main_POS[m.CPOS]; exists {
+	return mainPOSProp(Main_POS, m)
+}
+
+func mainPOSProp(mainPOS map[string]bool, m *EMorpheme) string {
+	if _, exists := mainPOS[m.CPOS]; exists {
 		return fmt.Sprintf("%s_%s", m.CPOS, m.FeatureStr)
 	} else {
 		return fmt.Sprintf("%s_%s_%s", m.Form, m.CPOS, m.FeatureStr)
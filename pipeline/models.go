@@ -0,0 +1,248 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"yap/alg/search"
+	"yap/alg/transition"
+	transitionmodel "yap/alg/transition/model"
+	"yap/app"
+	. "yap/nlp/parser/dependency/transition"
+	"yap/nlp/parser/disambig"
+	"yap/nlp/parser/joint"
+	nlp "yap/nlp/types"
+	"yap/util"
+	"yap/util/conf"
+)
+
+// enums are the enumerations a model was trained with; lattices are read
+// into instances of the model with its own enumerations
+type enums struct {
+	EWord, EPOS, EWPOS *util.EnumSet
+	EMHost, EMSuffix   *util.EnumSet
+	EMorphProp         *util.EnumSet
+	ETrans, ETokens    *util.EnumSet
+	ERel               *util.EnumSet
+}
+
+// model is a loaded model and the beam parsing with it; workers bounds the
+// number of concurrent searches
+type model struct {
+	enums
+	weights transitionmodel.Interface
+	workers chan *search.Beam
+}
+
+// readModel reads a model file written by app.WriteModel or compiled by
+// app.WriteCompiledModel and checks that it was trained with the given
+// settings
+func readModel(file string, settings app.ModelSettings) (transitionmodel.Interface, enums, error) {
+	weights, serialization, header, err := app.LoadModel(file)
+	if err != nil {
+		return nil, enums{}, err
+	}
+	if err := header.Check(settings); err != nil {
+		return nil, enums{}, fmt.Errorf("model %v: %v", file, err)
+	}
+	return weights, enums{
+		EWord:      serialization.EWord,
+		EPOS:       serialization.EPOS,
+		EWPOS:      serialization.EWPOS,
+		EMHost:     serialization.EMHost,
+		EMSuffix:   serialization.EMSuffix,
+		EMorphProp: serialization.EMorphProp,
+		ETrans:     serialization.ETrans,
+		ETokens:    serialization.ETokens,
+	}, nil
+}
+
+// transitionIndex returns the index of a transition in the model's
+// transition enumeration
+func (e enums) transitionIndex(name string) (int, error) {
+	index, exists := e.ETrans.IndexOf(name)
+	if !exists {
+		return 0, fmt.Errorf("model has no %s transition", name)
+	}
+	return index, nil
+}
+
+// extractor returns a feature extractor reading the enumerations of e
+func (e enums) extractor(setup *transition.FeatureSetup, transTypes []byte, pop transition.Transition) *transition.GenericExtractor {
+	extractor := &transition.GenericExtractor{
+		EFeatures:  util.NewEnumSet(setup.NumFeatures()),
+		EWord:      e.EWord,
+		EPOS:       e.EPOS,
+		EWPOS:      e.EWPOS,
+		ERel:       e.ERel,
+		EMHost:     e.EMHost,
+		EMSuffix:   e.EMSuffix,
+		EMorphProp: e.EMorphProp,
+		EToken:     e.ETokens,
+		POPTrans:   pop,
+	}
+	extractor.InitTypes(transTypes)
+	extractor.LoadFeatureSetup(setup)
+	return extractor
+}
+
+// close releases the weights of a compiled model
+func (m *model) close() error {
+	if closer, ok := m.weights.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func newModel(size int, beam *search.Beam) *model {
+	m := &model{workers: make(chan *search.Beam, size)}
+	for i := 0; i < size; i++ {
+		m.workers <- beam
+	}
+	return m
+}
+
+// loadMD loads the morphological disambiguator
+func loadMD(opts Options, settings *disambig.Settings, paramFunc nlp.MDParam) (*model, error) {
+	features, err := transition.LoadFeatureConfFile(opts.MDFeaturesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading MD features %v: %v", opts.MDFeaturesFile, err)
+	}
+	weights, e, err := readModel(opts.MDModelFile, app.ModelSettings{
+		Kind:         app.MODEL_KIND_MD,
+		FeaturesFile: opts.MDFeaturesFile,
+		MdParamFunc:  opts.ParamFunc,
+		UsePOP:       settings.UsePOP,
+	})
+	if err != nil {
+		return nil, err
+	}
+	iPOP, err := e.transitionIndex("POP")
+	if err != nil {
+		return nil, err
+	}
+	pop := &transition.TypedTransition{T: 'P', V: iPOP}
+	mdTrans := &disambig.MDTrans{
+		ParamFunc:   paramFunc,
+		UsePOP:      settings.UsePOP,
+		POP:         pop,
+		Transitions: e.ETrans,
+	}
+	conf := &disambig.MDConfig{
+		ETokens:     e.ETokens,
+		POP:         pop,
+		Transitions: e.ETrans,
+		ParamFunc:   paramFunc,
+		Settings:    settings,
+	}
+	m := newModel(opts.Workers, &search.Beam{
+		TransFunc:            mdTrans,
+		FeatExtractor:        e.extractor(features, []byte("MPL"), pop),
+		Base:                 conf,
+		Model:                weights,
+		Size:                 opts.BeamSize,
+		ConcurrentExec:       true,
+		Transitions:          e.ETrans,
+		EstimatedTransitions: 1000,
+		ShortTempAgenda:      true,
+	})
+	m.enums = e
+	m.weights = weights
+	return m, nil
+}
+
+// loadJoint loads the joint morpho-syntactic parser
+func loadJoint(opts Options, settings *disambig.Settings, paramFunc nlp.MDParam) (*model, error) {
+	features, err := transition.LoadFeatureConfFile(opts.JointFeaturesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading joint features %v: %v", opts.JointFeaturesFile, err)
+	}
+	labels, err := conf.ReadFile(opts.LabelsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading labels %v: %v", opts.LabelsFile, err)
+	}
+	weights, e, err := readModel(opts.JointModelFile, app.ModelSettings{
+		Kind:          app.MODEL_KIND_JOINT,
+		FeaturesFile:  opts.JointFeaturesFile,
+		LabelsFile:    opts.LabelsFile,
+		MdParamFunc:   opts.ParamFunc,
+		JointStrategy: opts.JointStrategy,
+		UsePOP:        settings.UsePOP,
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.ERel = util.NewEnumSet(len(labels.Values) + 1)
+	e.ERel.Add(nlp.DepRel(nlp.ROOT_LABEL))
+	for _, label := range labels.Values {
+		e.ERel.Add(nlp.DepRel(label))
+	}
+	e.ERel.Frozen = true
+	// the arc transitions lead the enumeration, as set up for training
+	indices := make(map[string]int, 6)
+	for _, name := range []string{"SH", "RE", "PR", "LA-" + string(nlp.ROOT_LABEL), "RA-" + string(nlp.ROOT_LABEL), "POP"} {
+		if indices[name], err = e.transitionIndex(name); err != nil {
+			return nil, err
+		}
+	}
+	pop := &transition.TypedTransition{T: 'P', V: indices["POP"]}
+	md := transition.ConstTransition(indices["POP"] + 1)
+	mdTrans := &disambig.MDTrans{
+		ParamFunc:   paramFunc,
+		UsePOP:      settings.UsePOP,
+		POP:         pop,
+		Transitions: e.ETrans,
+	}
+	mdTrans.AddDefaultOracle()
+	arcSystem := &ArcEager{
+		ArcStandard: ArcStandard{
+			SHIFT:       indices["SH"],
+			LEFT:        indices["LA-"+string(nlp.ROOT_LABEL)],
+			RIGHT:       indices["RA-"+string(nlp.ROOT_LABEL)],
+			Relations:   e.ERel,
+			Transitions: e.ETrans,
+		},
+		REDUCE:  indices["RE"],
+		POPROOT: indices["PR"],
+	}
+	arcSystem.AddDefaultOracle()
+	jointTrans := &joint.JointTrans{
+		MDTrans:       mdTrans,
+		ArcSys:        arcSystem,
+		Transitions:   e.ETrans,
+		MDTransition:  md,
+		JointStrategy: opts.JointStrategy,
+	}
+	conf := &joint.JointConfig{
+		SimpleConfiguration: SimpleConfiguration{
+			EWord:    e.EWord,
+			EPOS:     e.EPOS,
+			EWPOS:    e.EWPOS,
+			EMHost:   e.EMHost,
+			EMSuffix: e.EMSuffix,
+			ERel:     e.ERel,
+			ETrans:   e.ETrans,
+		},
+		MDConfig: disambig.MDConfig{
+			ETokens:     e.ETokens,
+			POP:         pop,
+			Transitions: e.ETrans,
+			ParamFunc:   paramFunc,
+			Settings:    settings,
+		},
+		MDTrans: md,
+	}
+	m := newModel(opts.Workers, &search.Beam{
+		TransFunc:            jointTrans,
+		FeatExtractor:        e.extractor(features, []byte("MPLA"), pop),
+		Base:                 conf,
+		Model:                weights,
+		Size:                 opts.BeamSize,
+		ConcurrentExec:       true,
+		Transitions:          e.ETrans,
+		EstimatedTransitions: 1000,
+		ShortTempAgenda:      true,
+	})
+	m.enums = e
+	m.weights = weights
+	return m, nil
+}
@@ -0,0 +1,124 @@
+package pipeline
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"yap/nlp/parser/joint"
+	nlp "yap/nlp/types"
+)
+
+// Options configures a Pipeline. File names are used as given, they are not
+// looked up next to the executable.
+type Options struct {
+	// BGU prefix and lexicon files of the Hebrew morphological analyzer
+	PrefixFile  string
+	LexiconFile string
+	// add an NNP analysis to every token and prefixed subtoken
+	AlwaysNNP bool
+	// add an NNP without features next to every NNP of the lexicon, as
+	// hebma -addnnpnofeats does
+	NNPNoFeats bool
+	// strip all NNPs of features before disambiguation and parsing, as
+	// -stripnnpfeats does
+	StripNNPFeats bool
+
+	// morphological disambiguator model and feature configuration
+	MDModelFile    string
+	MDFeaturesFile string
+
+	// joint morpho-syntactic model, its feature configuration and the
+	// dependency labels it was trained with; Parse requires them
+	JointModelFile    string
+	JointFeaturesFile string
+	LabelsFile        string
+
+	// MD param func, defaults to Funcs_Main_POS_Both_Prop
+	ParamFunc string
+	// open class POS family of the param func, HEBTB (default) or UD
+	ParamFamily string
+	// joint transition strategy, defaults to ArcGreedy
+	JointStrategy string
+
+	// beam size, defaults to 64
+	BeamSize int
+	// number of sentences parsed concurrently per model, defaults to the
+	// number of CPUs
+	Workers int
+	// disable the end of sentence (POP) transition
+	NoPOP bool
+	// disambiguate lemmas, not only forms
+	Lemmas bool
+}
+
+const (
+	DEFAULT_PARAM_FUNC   = "Funcs_Main_POS_Both_Prop"
+	DEFAULT_PARAM_FAMILY = "HEBTB"
+	DEFAULT_STRATEGY     = "ArcGreedy"
+	DEFAULT_BEAM_SIZE    = 64
+)
+
+// withDefaults returns the options with unset fields set to their defaults
+func (o Options) withDefaults() Options {
+	if len(o.ParamFunc) == 0 {
+		o.ParamFunc = DEFAULT_PARAM_FUNC
+	}
+	if len(o.ParamFamily) == 0 {
+		o.ParamFamily = DEFAULT_PARAM_FAMILY
+	}
+	if len(o.JointStrategy) == 0 {
+		o.JointStrategy = DEFAULT_STRATEGY
+	}
+	if o.BeamSize <= 0 {
+		o.BeamSize = DEFAULT_BEAM_SIZE
+	}
+	if o.Workers <= 0 {
+		o.Workers = runtime.NumCPU()
+	}
+	return o
+}
+
+func (o Options) validate() error {
+	required := []struct{ name, value string }{
+		{"PrefixFile", o.PrefixFile},
+		{"LexiconFile", o.LexiconFile},
+		{"MDModelFile", o.MDModelFile},
+		{"MDFeaturesFile", o.MDFeaturesFile},
+	}
+	if o.parses() {
+		required = append(required,
+			struct{ name, value string }{"JointFeaturesFile", o.JointFeaturesFile},
+			struct{ name, value string }{"LabelsFile", o.LabelsFile},
+		)
+	}
+	for _, option := range required {
+		if len(option.value) == 0 {
+			return fmt.Errorf("pipeline: %s is required", option.name)
+		}
+	}
+	if _, exists := nlp.MDParams[o.ParamFunc]; !exists {
+		return fmt.Errorf("pipeline: unknown param func %q, expected one of %s", o.ParamFunc, nlp.AllParamFuncNames)
+	}
+	if o.ParamFamily != "HEBTB" && o.ParamFamily != "UD" {
+		return fmt.Errorf("pipeline: unknown param family %q, expected HEBTB or UD", o.ParamFamily)
+	}
+	if o.parses() && !oneOf(o.JointStrategy, joint.JointStrategies) {
+		return fmt.Errorf("pipeline: unknown joint strategy %q, expected one of %s", o.JointStrategy, joint.JointStrategies)
+	}
+	return nil
+}
+
+// oneOf reports whether value is in a comma separated list
+func oneOf(value, list string) bool {
+	for _, item := range strings.Split(list, ", ") {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
+
+// parses reports whether a joint model is configured
+func (o Options) parses() bool {
+	return len(o.JointModelFile) > 0
+}
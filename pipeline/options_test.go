@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+)
+
+func testOptions() Options {
+	return Options{
+		PrefixFile:     "prefix.hr",
+		LexiconFile:    "lexicon.hr",
+		MDModelFile:    "md.b64",
+		MDFeaturesFile: "md.yaml",
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	opts := testOptions().withDefaults()
+	if opts.ParamFunc != DEFAULT_PARAM_FUNC || opts.ParamFamily != DEFAULT_PARAM_FAMILY || opts.JointStrategy != DEFAULT_STRATEGY {
+		t.Errorf("Expected default param func, family and strategy, got %v %v %v", opts.ParamFunc, opts.ParamFamily, opts.JointStrategy)
+	}
+	if opts.BeamSize != DEFAULT_BEAM_SIZE || opts.Workers < 1 {
+		t.Errorf("Expected default beam size and workers, got %v %v", opts.BeamSize, opts.Workers)
+	}
+	if err := opts.validate(); err != nil {
+		t.Errorf("Expected valid options, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Options)
+		err    string
+	}{
+		{"missing lexicon", func(o *Options) { o.LexiconFile = "" }, "LexiconFile is required"},
+		{"missing labels", func(o *Options) { o.JointModelFile, o.JointFeaturesFile = "joint.b64", "joint.yaml" }, "LabelsFile is required"},
+		{"param func", func(o *Options) { o.ParamFunc = "Funcs_None" }, "unknown param func"},
+		{"param family", func(o *Options) { o.ParamFamily = "PTB" }, "unknown param family"},
+		{"strategy", func(o *Options) {
+			o.JointModelFile, o.JointFeaturesFile, o.LabelsFile = "joint.b64", "joint.yaml", "labels.yaml"
+			o.JointStrategy = "Arc"
+		}, "unknown joint strategy"},
+	}
+	for _, test := range tests {
+		opts := testOptions()
+		test.modify(&opts)
+		err := opts.withDefaults().validate()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestNewMissingFile(t *testing.T) {
+	if _, err := New(testOptions()); err == nil {
+		t.Error("Expected an error for missing files")
+	}
+}
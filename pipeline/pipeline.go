@@ -0,0 +1,320 @@
+// Package pipeline runs the Hebrew morphological analyzer, the
+// morphological disambiguator and the joint morpho-syntactic parser from Go.
+//
+// A Pipeline holds its own models, enumerations and settings, the NNP
+// options of the lex and lattice packages included; it writes no package
+// level state, so several pipelines with different options can be used side
+// by side, and every method may be called concurrently. Settings the
+// pipeline has no option for, like the lattice word type, are read from
+// their packages and are meant to be left at their defaults.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"yap/alg/search"
+	"yap/nlp/format/lattice"
+	"yap/nlp/parser/disambig"
+	"yap/nlp/parser/ma"
+	nlp "yap/nlp/types"
+)
+
+// ErrNoJointModel is returned by Parse when no joint model is configured
+var ErrNoJointModel = errors.New("pipeline: no joint model configured")
+
+// Morpheme is a morpheme of a sentence. From and To are the lattice nodes
+// it spans and Token is the index of the token it belongs to.
+type Morpheme struct {
+	From, To int
+	Token    int
+	Form     string
+	Lemma    string
+	CPOS     string
+	POS      string
+	Features map[string]string
+}
+
+// Lattice is a morphological analysis of a sentence: every morpheme of
+// every analysis of its tokens
+type Lattice []Morpheme
+
+// Node is a morpheme of a parsed sentence; Head is the index of its head
+// in the sentence, -1 for the root
+type Node struct {
+	Morpheme
+	Head     int
+	Relation string
+}
+
+// Pipeline analyzes, disambiguates and parses tokenized sentences
+type Pipeline struct {
+	opts     Options
+	analyzer *ma.BGULex
+	md       *model
+	joint    *model
+}
+
+// New loads the models of opts
+func New(opts Options) (p *Pipeline, err error) {
+	opts = opts.withDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			p, err = nil, fmt.Errorf("pipeline: %v", r)
+		}
+	}()
+	p = &Pipeline{opts: opts}
+	p.analyzer = &ma.BGULex{MAType: "spmrl", AlwaysNNP: opts.AlwaysNNP, NNPNoFeats: opts.NNPNoFeats}
+	p.analyzer.LoadPrefixes(opts.PrefixFile)
+	p.analyzer.LoadLexFile(opts.LexiconFile)
+
+	settings := &disambig.Settings{
+		UsePOP:          !opts.NoPOP,
+		SwitchFormLemma: opts.Lemmas,
+		Lemmas:          opts.Lemmas,
+	}
+	paramFunc, _ := nlp.ParamFuncWithTypes(opts.ParamFunc, nlp.OpenParamFamilyTypes(opts.ParamFamily))
+	if p.md, err = loadMD(opts, settings, paramFunc); err != nil {
+		return nil, fmt.Errorf("pipeline: %v", err)
+	}
+	if opts.parses() {
+		if p.joint, err = loadJoint(opts, settings, paramFunc); err != nil {
+			return nil, fmt.Errorf("pipeline: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// Close releases the memory mapped weights of compiled models; the pipeline
+// can't be used after it
+func (p *Pipeline) Close() error {
+	for _, m := range []*model{p.md, p.joint} {
+		if m == nil {
+			continue
+		}
+		if err := m.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Analyze returns the morphological analyses of every sentence
+func (p *Pipeline) Analyze(ctx context.Context, sents [][]string) ([]Lattice, error) {
+	lattices, err := p.analyze(ctx, sents)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Lattice, len(lattices))
+	for i, lat := range lattices {
+		for _, tokenLattice := range lat {
+			for _, morph := range tokenLattice.Morphemes {
+				result[i] = append(result[i], newMorpheme(morph))
+			}
+		}
+	}
+	return result, nil
+}
+
+// Disambiguate returns the most likely analysis of every sentence
+func (p *Pipeline) Disambiguate(ctx context.Context, sents [][]string) ([][]Morpheme, error) {
+	results, err := p.run(ctx, p.md, sents)
+	if err != nil {
+		return nil, err
+	}
+	disambiguated := make([][]Morpheme, len(results))
+	for i, result := range results {
+		for _, mapping := range result.(*disambig.MDConfig).Mappings {
+			if mapping.Token == nlp.ROOT_TOKEN {
+				continue
+			}
+			for _, morph := range mapping.Spellout {
+				disambiguated[i] = append(disambiguated[i], newMorpheme(morph))
+			}
+		}
+	}
+	return disambiguated, nil
+}
+
+// Parse returns the most likely analysis of every sentence and its
+// dependency tree
+func (p *Pipeline) Parse(ctx context.Context, sents [][]string) ([][]Node, error) {
+	if p.joint == nil {
+		return nil, ErrNoJointModel
+	}
+	results, err := p.run(ctx, p.joint, sents)
+	if err != nil {
+		return nil, err
+	}
+	parsed := make([][]Node, len(results))
+	for i, result := range results {
+		parsed[i] = graphNodes(result.(nlp.MorphDependencyGraph))
+	}
+	return parsed, nil
+}
+
+// analyze runs the analyzer on every sentence
+func (p *Pipeline) analyze(ctx context.Context, sents [][]string) (lattices []nlp.LatticeSentence, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			lattices, err = nil, fmt.Errorf("pipeline: failed analyzing: %v", r)
+		}
+	}()
+	// the prefix and lexicon maps are read-only, the statistics are not
+	analyzer := *p.analyzer
+	analyzer.Stats = new(ma.AnalyzeStats)
+	analyzer.Stats.Init()
+	lattices = make([]nlp.LatticeSentence, len(sents))
+	for i, sent := range sents {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := validateSentence(sent); err != nil {
+			return nil, fmt.Errorf("pipeline: sentence %d: %v", i, err)
+		}
+		lattices[i], _ = analyzer.Analyze(sent)
+	}
+	return lattices, nil
+}
+
+// run analyzes the sentences and parses them with the beams of m, one
+// sentence per free beam, on up to Workers goroutines
+func (p *Pipeline) run(ctx context.Context, m *model, sents [][]string) ([]interface{}, error) {
+	lattices, err := p.analyze(ctx, sents)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		wg      sync.WaitGroup
+		results = make([]interface{}, len(lattices))
+		errs    = make([]error, len(lattices))
+		indices = make(chan int)
+		workers = p.opts.Workers
+	)
+	if workers > len(lattices) {
+		workers = len(lattices)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				var l lattice.Lattice
+				if l, errs[i] = p.lattice(lattices[i]); errs[i] == nil {
+					results[i], errs[i] = m.parse(ctx, l)
+				}
+			}
+		}()
+	}
+	for i := range lattices {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	for i, err := range errs {
+		if err == ctx.Err() && err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pipeline: sentence %d: %v", i, err)
+		}
+	}
+	return results, nil
+}
+
+// lattice converts an analyzed sentence to a lattice as the lattice format
+// reads it, which is how the models were trained: the features of every
+// edge are parsed from their string, and dropped for NNPs with
+// StripNNPFeats, and the token strings, which the format doesn't carry, are
+// left out
+func (p *Pipeline) lattice(sent nlp.LatticeSentence) (lattice.Lattice, error) {
+	lat := lattice.Sentence2Lattice(sent, nil)
+	for _, edges := range lat {
+		for i := range edges {
+			edge := &edges[i]
+			if p.opts.StripNNPFeats && edge.CPosTag == "NNP" {
+				edge.FeatStr = "_"
+			}
+			feats, err := lattice.ParseFeatures(edge.FeatStr)
+			if err != nil {
+				return nil, fmt.Errorf("features of %v: %v", edge.Word, err)
+			}
+			edge.Feats, edge.FeatStr = feats, lattice.ParseString(edge.FeatStr)
+			edge.TokenStr = ""
+		}
+	}
+	return lat, nil
+}
+
+// parse reads a lattice with the enumerations of the model and parses it
+// on the next free beam
+func (m *model) parse(ctx context.Context, lat lattice.Lattice) (result interface{}, err error) {
+	var b *search.Beam
+	select {
+	case b = <-m.workers:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() {
+		m.workers <- b
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("failed parsing: %v", r)
+		}
+	}()
+	instance := lattice.Lattice2Sentence(lat, m.EWord, m.EPOS, m.EWPOS, m.EMorphProp, m.EMHost, m.EMSuffix)
+	result, _, _, err = b.ParseContext(ctx, instance)
+	return result, err
+}
+
+func validateSentence(sent []string) error {
+	if len(sent) == 0 {
+		return errors.New("empty sentence")
+	}
+	for j, token := range sent {
+		if len(token) == 0 {
+			return fmt.Errorf("token %d is empty", j)
+		}
+	}
+	return nil
+}
+
+func newMorpheme(m *nlp.EMorpheme) Morpheme {
+	return Morpheme{
+		From:     m.From(),
+		To:       m.To(),
+		Token:    m.TokenID - 1,
+		Form:     m.Form,
+		Lemma:    m.Lemma,
+		CPOS:     m.CPOS,
+		POS:      m.POS,
+		Features: m.Features,
+	}
+}
+
+// graphNodes returns the morphemes of a parsed sentence with their heads
+func graphNodes(graph nlp.MorphDependencyGraph) []Node {
+	arcs := make(map[int]nlp.LabeledDepArc, graph.NumberOfNodes())
+	for _, arcID := range graph.GetEdges() {
+		if arc := graph.GetLabeledArc(arcID); arc != nil {
+			arcs[arc.GetModifier()] = arc
+		}
+	}
+	nodes := make([]Node, 0, graph.NumberOfNodes())
+	for i, nodeID := range graph.GetVertices() {
+		node := Node{Morpheme: newMorpheme(graph.GetMorpheme(nodeID)), Head: -1}
+		if arc, exists := arcs[i]; exists && arc.GetRelation() != nlp.ROOT_LABEL {
+			node.Head = arc.GetHead()
+			node.Relation = string(arc.GetRelation())
+		} else if exists {
+			node.Relation = string(arc.GetRelation())
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
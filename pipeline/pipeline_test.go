@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"testing"
+	"yap/alg/graph"
+	"yap/nlp/format/lattice"
+	nlp "yap/nlp/types"
+)
+
+func testSentence() nlp.LatticeSentence {
+	morph := func(id, from, to int, form, pos, feats string) *nlp.EMorpheme {
+		return &nlp.EMorpheme{Morpheme: nlp.Morpheme{
+			BasicDirectedEdge: graph.BasicDirectedEdge{id, from, to},
+			Form:              form,
+			Lemma:             form,
+			CPOS:              pos,
+			POS:               pos,
+			TokenID:           1,
+			FeatureStr:        feats,
+		}}
+	}
+	return nlp.LatticeSentence{{
+		Token: "ילד",
+		Morphemes: nlp.Morphemes{
+			morph(0, 0, 1, "ילד", "NN", "gen=M|num=S"),
+			morph(1, 0, 1, "ילד", "NNP", "gen=F|gen=M|num=S"),
+			morph(2, 0, 1, "ילד", "NNP", ""),
+		},
+	}}
+}
+
+func TestLattice(t *testing.T) {
+	for _, strip := range []bool{false, true} {
+		p := &Pipeline{opts: Options{StripNNPFeats: strip}}
+		lat, err := p.lattice(testSentence())
+		if err != nil {
+			t.Fatalf("Failed converting sentence: %v", err)
+		}
+		if len(lat[0]) != 3 {
+			t.Fatalf("Expected 3 edges, got %d", len(lat[0]))
+		}
+		edges := make(map[int]lattice.Edge, len(lat[0]))
+		for _, edge := range lat[0] {
+			if len(edge.TokenStr) > 0 {
+				t.Errorf("Expected no token string, got %q", edge.TokenStr)
+			}
+			edges[edge.Id] = edge
+		}
+		if edges[0].Feats["gen"] != "M" || edges[0].Feats["num"] != "S" || edges[0].FeatStr != "gen=M|num=S" {
+			t.Errorf("Expected NN features gen=M|num=S, got %v %q", edges[0].Feats, edges[0].FeatStr)
+		}
+		if strip {
+			if len(edges[1].Feats) > 0 || len(edges[1].FeatStr) > 0 {
+				t.Errorf("Expected stripped NNP features, got %v %q", edges[1].Feats, edges[1].FeatStr)
+			}
+		} else if edges[1].Feats["gen"] != "F,M" || edges[1].FeatStr != "gen=F|gen=M|num=S" {
+			t.Errorf("Expected NNP features gen=F,M, got %v %q", edges[1].Feats, edges[1].FeatStr)
+		}
+		if len(edges[2].Feats) > 0 || len(edges[2].FeatStr) > 0 {
+			t.Errorf("Expected no features, got %v %q", edges[2].Feats, edges[2].FeatStr)
+		}
+	}
+}
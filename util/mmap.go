@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"os"
+	"syscall"
+)
+
+// MapFile maps a file read only into memory; unmap releases it
+func MapFile(file string) (data []byte, unmap func() error, err error) {
+	fObj, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fObj.Close()
+	info, err := fObj.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Size() == 0 {
+		return []byte{}, func() error { return nil }, nil
+	}
+	data, err = syscall.Mmap(int(fObj.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,12 @@
+package util
+
+import "io/ioutil"
+
+// MapFile reads a file into memory; files aren't mapped on windows
+func MapFile(file string) (data []byte, unmap func() error, err error) {
+	data, err = ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -125,37 +125,49 @@ var (
 )
 
 func Heb2UDFeature(feature string) string {
+	udFeature, exists := LookupHeb2UDFeature(feature)
+	if !exists {
+		panic(fmt.Sprintf("Failed transforming feature %s", feature))
+	}
+	return udFeature
+}
+
+// LookupHeb2UDFeature returns the UD feature of a treebank attribute=value
+// feature, empty for features UD drops; exists is false for features with
+// no UD counterpart
+func LookupHeb2UDFeature(feature string) (udFeature string, exists bool) {
 	if len(feature) == 0 {
-		return feature
+		return feature, true
 	}
 	switch feature {
 	case "tense=BEINONI":
-		return "Tense=Part"
+		return "Tense=Part", true
 	case "type=TOINFINITIVE":
-		return "VerbForm=Inf"
+		return "VerbForm=Inf", true
 	case "tense=IMPERATIVE":
-		return "Mood=Imp"
+		return "Mood=Imp", true
 	}
-	pair := strings.Split(feature, "=")
+	pair := strings.SplitN(feature, "=", 2)
 	if len(pair) == 1 {
-		panic(fmt.Sprintf("Can't transform non-attribute feature %s", feature))
+		return "", false
 	}
 	if pair[0] == "binyan" {
 		if pair[1] == "HITPAEL" {
-			return ""
+			return "", true
 		}
-		return fmt.Sprintf("HebBinyan=%s", pair[1])
+		return fmt.Sprintf("HebBinyan=%s", pair[1]), true
 	}
-	if propMap, exists := HEB2UDFeatureNameLookup[pair[0]]; exists {
-		if propValue, valExists := propMap.ValueMap[pair[1]]; valExists {
-			return fmt.Sprintf("%s=%s", propMap.UDName, propValue)
-		} else {
-			panic(fmt.Sprintf("Morphological feature value does not exist in Heb2UD transform %s", feature))
-		}
-	} else {
-		panic(fmt.Sprintf("Failed transforming feature %s", feature))
+	propMap, exists := HEB2UDFeatureNameLookup[pair[0]]
+	if !exists {
+		return "", false
 	}
+	propValue, exists := propMap.ValueMap[pair[1]]
+	if !exists {
+		return "", false
+	}
+	return fmt.Sprintf("%s=%s", propMap.UDName, propValue), true
 }
+
 func Heb2UDFeaturesString(features string) string {
 	if features == "_" {
 		return features
@@ -0,0 +1,118 @@
+package webapi
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strings"
+	"yap/nlp/parser/ma"
+)
+
+var (
+	// AdminToken authorizes the /admin endpoints; empty disables them
+	AdminToken string
+	// UserLexiconFile persists the user lexicon; empty keeps it in memory
+	UserLexiconFile string
+
+	userLex *ma.UserLex
+)
+
+// LexiconRequest carries user lexicon lines, in the lexicon file format
+type LexiconRequest struct {
+	Entries []string `json:"entries"`
+}
+
+type LexiconResponse struct {
+	Entries []string `json:"entries,omitempty"`
+	Size    int      `json:"size"`
+	Removed int      `json:"removed,omitempty"`
+}
+
+// adminMiddleware requires the admin token as a bearer token
+func adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondWithError(w, NewAPIError(http.StatusUnauthorized, ERR_UNAUTHORIZED, "missing or invalid admin token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UserLexiconInitialize loads the user lexicon shared by the analyzers of
+// all model sets; it must run before the models are loaded
+func UserLexiconInitialize() {
+	var err error
+	userLex, err = ma.NewUserLex(UserLexiconFile, "spmrl")
+	if err != nil {
+		panic(fmt.Sprintf("Failed reading user lexicon - %v", err))
+	}
+	if len(UserLexiconFile) > 0 {
+		log.Println("Read", userLex.Len(), "user lexicon tokens from", UserLexiconFile)
+	}
+}
+
+func respondWithLexicon(resp http.ResponseWriter, lexResp LexiconResponse) {
+	lexResp.Size = userLex.Len()
+	respondWithJSON(resp, http.StatusOK, lexResp)
+}
+
+func ListLexiconHandler(resp http.ResponseWriter, req *http.Request) {
+	respondWithLexicon(resp, LexiconResponse{Entries: userLex.Lines()})
+}
+
+// AddLexiconHandler adds lexicon lines, replacing the user analyses of
+// their tokens
+func AddLexiconHandler(resp http.ResponseWriter, req *http.Request) {
+	request := LexiconRequest{}
+	if err := decodeRequest(req, &request); err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	if len(request.Entries) == 0 {
+		respondWithError(resp, NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "no entries"))
+		return
+	}
+	if err := userLex.Validate(request.Entries); err != nil {
+		respondWithError(resp, NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "invalid lexicon: %v", err))
+		return
+	}
+	if err := userLex.Add(request.Entries); err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	respondWithLexicon(resp, LexiconResponse{})
+}
+
+func RemoveLexiconHandler(resp http.ResponseWriter, req *http.Request) {
+	removed, err := userLex.Remove([]string{mux.Vars(req)["token"]})
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	if removed == 0 {
+		respondWithError(resp, NewAPIError(http.StatusNotFound, ERR_NOT_FOUND, "no such token"))
+		return
+	}
+	respondWithLexicon(resp, LexiconResponse{Removed: removed})
+}
+
+// registerAdmin adds the admin endpoints when an admin token is set
+func registerAdmin(router *mux.Router) {
+	if len(AdminToken) == 0 {
+		return
+	}
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/lexicon", ListLexiconHandler).Methods("GET")
+	admin.HandleFunc("/lexicon", AddLexiconHandler).Methods("POST")
+	admin.HandleFunc("/lexicon/{token}", RemoveLexiconHandler).Methods("DELETE")
+	admin.HandleFunc("/reload", ReloadHandler).Methods("POST")
+	admin.HandleFunc("/reload", ReloadStatusHandler).Methods("GET")
+	admin.Use(adminMiddleware)
+	admin.Use(readinessMiddleware)
+}
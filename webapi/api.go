@@ -14,6 +14,10 @@ type Node struct {
 	Features conll.Features `json:"features"`
 	Head     int            `json:"head,omitempty"`
 	DepRel   string         `json:"dep,omitempty"`
+	// share of the final beam's analyses with the same morpheme, and with
+	// the same head and label; only set when requested
+	Confidence    float64 `json:"confidence,omitempty"`
+	ArcConfidence float64 `json:"arc_confidence,omitempty"`
 }
 
 func GraphToNodes(graph types.MorphDependencyGraph) []Node {
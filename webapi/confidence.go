@@ -0,0 +1,124 @@
+package webapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"yap/app"
+	"yap/nlp/format/conllu"
+	nlp "yap/nlp/types"
+)
+
+// confidenceParam reports whether the confidence of every morpheme and arc
+// is requested
+func confidenceParam(req *http.Request) (bool, error) {
+	value := req.URL.Query().Get("confidence")
+	if len(value) == 0 {
+		return false, nil
+	}
+	confidence, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, NewAPIError(http.StatusBadRequest, ERR_BAD_REQUEST, "invalid confidence %q", value)
+	}
+	return confidence, nil
+}
+
+// beamAgreements parses the lattice sentences keeping every analysis of
+// the final beam, and returns the best analysis of every sentence with the
+// agreement of its beam
+func beamAgreements(ctx context.Context, pool *ParserPool, instances []interface{}) ([]interface{}, []*nlp.BeamAgreement, error) {
+	beams, err := pool.ParseAllKBest(ctx, instances, app.BeamSize, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed := make([]interface{}, len(beams))
+	for i, results := range beams {
+		parsed[i] = results[0].C
+	}
+	return parsed, app.BeamAgreements(beams), nil
+}
+
+// jointParse parses the lattice sentences, with the agreement of every
+// sentence's final beam if confidence is set
+func (m *Models) jointParse(ctx context.Context, instances []interface{}, confidence bool) ([]nlp.MorphDependencyGraph, []*nlp.BeamAgreement, error) {
+	if !confidence {
+		parsed, err := m.jointParseInstances(ctx, instances)
+		return parsed, nil, err
+	}
+	results, agreements, err := beamAgreements(ctx, m.joint, instances)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed := make([]nlp.MorphDependencyGraph, len(results))
+	for i, result := range results {
+		parsed[i] = result.(nlp.MorphDependencyGraph)
+	}
+	return parsed, agreements, nil
+}
+
+// mdParse disambiguates the lattice sentences, with the agreement of every
+// sentence's final beam if confidence is set
+func (m *Models) mdParse(ctx context.Context, instances []interface{}, confidence bool) ([]nlp.Mappings, []*nlp.BeamAgreement, error) {
+	if !confidence {
+		parsed, err := m.mdParseInstances(ctx, instances)
+		return parsed, nil, err
+	}
+	results, agreements, err := beamAgreements(ctx, m.md, instances)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed := make([]nlp.Mappings, len(results))
+	for i, result := range results {
+		parsed[i] = resultMappings(result)
+	}
+	return parsed, agreements, nil
+}
+
+func agreementAt(agreements []*nlp.BeamAgreement, i int) *nlp.BeamAgreement {
+	if agreements == nil {
+		return nil
+	}
+	return agreements[i]
+}
+
+// withGraphConfidence sets the morpheme and arc confidences of the nodes of
+// a parsed graph; without an agreement the nodes are left as they are
+func withGraphConfidence(nodes []Node, graph nlp.MorphDependencyGraph, agreement *nlp.BeamAgreement) []Node {
+	if agreement == nil {
+		return nodes
+	}
+	for i, nodeID := range graph.GetVertices() {
+		nodes[i].Confidence = agreement.Morpheme(graph.GetMorpheme(nodeID))
+		nodes[i].ArcConfidence = agreement.Arc(graph, graph.GetLabeledArc(nodeID))
+	}
+	return nodes
+}
+
+// withMappingsConfidence sets the morpheme confidences of the nodes of a
+// disambiguated sentence
+func withMappingsConfidence(nodes []Node, mappings nlp.Mappings, agreement *nlp.BeamAgreement) []Node {
+	if agreement == nil {
+		return nodes
+	}
+	for i, morph := range MappingsToMorphemes(mappings) {
+		nodes[i].Confidence = agreement.Morpheme(&morph)
+	}
+	return nodes
+}
+
+// setConfidence records the confidences of the nodes a CoNLL-U sentence was
+// built from in the MISC column
+func setConfidence(sent conllu.Sentence, nodes []Node) {
+	for i, node := range nodes {
+		row, exists := sent.Deps[i+1]
+		if !exists || node.Confidence == 0 {
+			continue
+		}
+		row.AppendMisc(fmt.Sprintf("Confidence=%.3f", node.Confidence))
+		if node.ArcConfidence > 0 {
+			row.AppendMisc(fmt.Sprintf("ArcConfidence=%.3f", node.ArcConfidence))
+		}
+		sent.Deps[i+1] = row
+	}
+}
@@ -0,0 +1,190 @@
+package webapi
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"yap/nlp/format/conllu"
+	"yap/nlp/tokenizer"
+	nlp "yap/nlp/types"
+	"yap/util"
+)
+
+// response formats of /parse and /tag, selected by the format query
+// parameter or the Accept header
+const (
+	FORMAT_JSON   = "json"
+	FORMAT_CONLLU = "conllu"
+
+	CONLLU_CONTENT_TYPE = "text/x-conllu"
+)
+
+// responseFormat returns the requested output format; an explicit format
+// parameter takes precedence over the Accept header
+func responseFormat(req *http.Request) (string, error) {
+	if format := req.URL.Query().Get("format"); len(format) > 0 {
+		switch strings.ToLower(format) {
+		case FORMAT_JSON:
+			return FORMAT_JSON, nil
+		case FORMAT_CONLLU:
+			return FORMAT_CONLLU, nil
+		}
+		return "", NewAPIError(http.StatusBadRequest, ERR_BAD_REQUEST, "unknown format %q, expected %s or %s", format, FORMAT_JSON, FORMAT_CONLLU)
+	}
+	if strings.Contains(req.Header.Get("Accept"), CONLLU_CONTENT_TYPE) {
+		return FORMAT_CONLLU, nil
+	}
+	return FORMAT_JSON, nil
+}
+
+func respondWithConllU(resp http.ResponseWriter, sents []interface{}) {
+	buf := new(bytes.Buffer)
+	conllu.Write(buf, sents)
+	resp.Header().Set("Content-Type", CONLLU_CONTENT_TYPE+"; charset=utf-8")
+	resp.WriteHeader(http.StatusOK)
+	resp.Write(buf.Bytes())
+}
+
+// udPOS converts a treebank POS tag to a UD tag, returning any features
+// implied by the original tag
+func udPOS(pos string) (string, string) {
+	udpos, exists := util.HEB2UDPOS[pos]
+	if !exists {
+		udpos, exists = util.HEB2UDPrefixPOS[pos]
+	}
+	if !exists {
+		return pos, ""
+	}
+	if split := strings.SplitN(udpos, "-", 2); len(split) == 2 {
+		return split[0], split[1]
+	}
+	return udpos, ""
+}
+
+// udFeature converts a single treebank feature, keeping features that have
+// no UD counterpart as they are
+func udFeature(name, value string) string {
+	hebName := name
+	suffix := strings.HasPrefix(hebName, "suf_")
+	if suffix {
+		hebName = hebName[4:]
+	}
+	var udName string
+	udValues := make([]string, 0, 1)
+	// concatenated values, e.g. gen=F,M
+	for _, v := range strings.Split(value, conllu.FEATURE_CONCAT_DELIM) {
+		converted, exists := util.LookupHeb2UDFeature(fmt.Sprintf("%s=%s", hebName, v))
+		if !exists {
+			return fmt.Sprintf("%s=%s", name, value)
+		}
+		if split := strings.SplitN(converted, "=", 2); len(split) == 2 {
+			udName = split[0]
+			udValues = append(udValues, split[1])
+		}
+	}
+	if len(udValues) == 0 {
+		return ""
+	}
+	if suffix {
+		// possessive and pronominal suffixes
+		udName += "[psor]"
+	}
+	return fmt.Sprintf("%s=%s", udName, strings.Join(udValues, conllu.FEATURE_CONCAT_DELIM))
+}
+
+func udFeatures(features map[string]string, implied string) string {
+	strs := make([]string, 0, len(features)+1)
+	if len(implied) > 0 {
+		strs = append(strs, strings.Split(implied, "|")...)
+	}
+	for name, value := range features {
+		if feature := udFeature(name, value); len(feature) > 0 {
+			strs = append(strs, feature)
+		}
+	}
+	if len(strs) == 0 {
+		return "_"
+	}
+	sort.Strings(strs)
+	unique := strs[:1]
+	for _, feature := range strs[1:] {
+		if feature != unique[len(unique)-1] {
+			unique = append(unique, feature)
+		}
+	}
+	return strings.Join(unique, conllu.FEATURES_SEPARATOR)
+}
+
+// setUDMorphology fills the lemma, tags and features of a row from the
+// morpheme it was built from
+func setUDMorphology(row *conllu.Row, morph *nlp.EMorpheme) {
+	upos, implied := udPOS(morph.CPOS)
+	row.Lemma = morph.Lemma
+	row.UPosTag = upos
+	row.XPosTag = morph.POS
+	row.FeatStr = udFeatures(morph.Features, implied)
+}
+
+// setTokenRanges records the character offsets of every row's source token
+// in the MISC column
+func setTokenRanges(sent conllu.Sentence, tokens tokenizer.Sentence) {
+	for id, row := range sent.Deps {
+		if row.TokenID > 0 && row.TokenID <= len(tokens) {
+			token := tokens[row.TokenID-1]
+			row.AppendMisc(fmt.Sprintf("TokenRange=%d:%d", token.Start, token.End))
+			sent.Deps[id] = row
+		}
+	}
+}
+
+// withTokens returns a copy of the mappings carrying the surface form of
+// every input token; lattices read back from text have no token forms, at
+// best a concatenation of their morphemes
+func withTokens(mappings nlp.Mappings, tokens nlp.BasicSentence) nlp.Mappings {
+	retval := make(nlp.Mappings, len(mappings))
+	for i, mapping := range mappings {
+		if i < len(tokens) && mapping.Token != tokens[i] {
+			mapping = &nlp.Mapping{Token: tokens[i], Spellout: mapping.Spellout}
+		}
+		retval[i] = mapping
+	}
+	return retval
+}
+
+// GraphToConllU converts a parsed graph to a CoNLL-U sentence, with
+// multi-word token ranges taken from the graph's mappings
+func GraphToConllU(graph nlp.MorphDependencyGraph, tokens nlp.BasicSentence) conllu.Sentence {
+	sent := conllu.MorphGraph2ConllU(graph)
+	sent.Mappings = withTokens(sent.Mappings, tokens)
+	for i, nodeID := range graph.GetVertices() {
+		row := sent.Deps[i+1]
+		setUDMorphology(&row, graph.GetMorpheme(nodeID))
+		sent.Deps[i+1] = row
+	}
+	return sent
+}
+
+// MappingsToConllU converts a disambiguated sentence to a CoNLL-U sentence
+// without dependency annotation
+func MappingsToConllU(mappings nlp.Mappings, tokens nlp.BasicSentence) conllu.Sentence {
+	sent := conllu.NewSentence()
+	sent.Mappings = withTokens(mappings, tokens)
+	id := 1
+	for i, mapping := range sent.Mappings {
+		sent.Tokens = append(sent.Tokens, string(mapping.Token))
+		for _, morph := range mapping.Spellout {
+			row := conllu.Row{
+				ID:      id,
+				Form:    morph.Form,
+				Head:    -1,
+				TokenID: i + 1,
+			}
+			setUDMorphology(&row, morph)
+			sent.Deps[id] = row
+			id++
+		}
+	}
+	return *sent
+}
@@ -1,142 +1,104 @@
 package webapi
 
 import (
+	"context"
 	"log"
 	"yap/nlp/format/conll"
 	"yap/alg/search"
 	"yap/alg/transition"
-	"github.com/gonuts/commander"
 	"yap/util"
 	"fmt"
 	"yap/util/conf"
-	"yap/nlp/format/lattice"
-	"strings"
 	"yap/app"
-	transitionmodel "yap/alg/transition/model"
 	. "yap/nlp/parser/dependency/transition"
 	nlp "yap/nlp/types"
 	"bytes"
-	"sync"
 )
 
-var (
-	depBeam *search.Beam
-	depLock sync.Mutex
-)
-
-func DepParserInitialize(cmd *commander.Command, args []string) {
-	var (
-		arcSystem transition.TransitionSystem
-		terminalStack int
-	)
-	arcSystem = &ArcEager{}
-	terminalStack = 0
-	arcSystem.AddDefaultOracle()
-	transitionSystem := transition.TransitionSystem(arcSystem)
-	featuresLocation, found := util.LocateFile(app.DepFeaturesFile, app.DEFAULT_CONF_DIRS)
-	if !found {
-		panic(fmt.Sprintf("Dep features not found"))
-	}
-	app.DepFeaturesFile = featuresLocation
-	labelsLocation, found := util.LocateFile(app.DepLabelsFile, app.DEFAULT_CONF_DIRS)
-	if !found {
-		panic(fmt.Sprintf("Dep labels not found"))
-	}
-	app.DepLabelsFile = labelsLocation
-	var (
-		model *transitionmodel.AvgMatrixSparse = &transitionmodel.AvgMatrixSparse{}
-	)
-	modelLocation, found := util.LocateFile(app.DepModelName, app.DEFAULT_MODEL_DIRS)
-	if !found {
-		panic(fmt.Sprintf("Dep model not found"))
-	}
-	app.DepModelName = modelLocation
-	app.DepConfigOut(modelLocation, &search.Beam{}, transitionSystem)
-	relations, err := conf.ReadFile(labelsLocation)
+// DepParserInitialize loads the dependency model of a model set and starts
+// its parser pool
+func DepParserInitialize(m *Models) {
+	relations, err := conf.ReadFile(m.spec.DepLabels)
 	if err != nil {
-		panic(fmt.Sprintf("Failed reading Dep labels from file: %v", labelsLocation))
+		panic(fmt.Sprintf("Failed reading Dep labels from file: %v", m.spec.DepLabels))
 	}
-	app.SetupDepEnum(relations.Values)
-	arcSystem = &ArcEager{
-		ArcStandard: ArcStandard{
-			SHIFT: app.SH.Value(),
-			LEFT: app.LA.Value(),
-			RIGHT: app.RA.Value(),
-			Relations: app.ERel,
-			Transitions: app.ETrans,
-		},
-		REDUCE: app.RE.Value(),
-		POPROOT: app.PR.Value(),
-	}
-	arcSystem.AddDefaultOracle()
-	transitionSystem = transition.TransitionSystem(arcSystem)
 	log.Println()
 	log.Println("Loading features")
 
-	featureSetup, err := transition.LoadFeatureConfFile(featuresLocation)
+	featureSetup, err := transition.LoadFeatureConfFile(m.spec.DepFeatures)
 	if err != nil {
-		panic(fmt.Sprintf("Failed reading Dep features from file: %v", featuresLocation))
-	}
-	extractor := app.SetupExtractor(featureSetup, []byte("A"))
-	group, _ := extractor.TransTypeGroups['A']
-	formatters := make([]util.Format, len(group.FeatureTemplates))
-	for i, formatter := range group.FeatureTemplates {
-		formatters[i] = formatter
+		panic(fmt.Sprintf("Failed reading Dep features from file: %v", m.spec.DepFeatures))
 	}
 
-	log.Println("Found model file", modelLocation, " ... loading model")
-	serialization := app.ReadModel(modelLocation)
-	model.Deserialize(serialization.WeightModel)
-	app.EWord = serialization.EWord
-	app.EPOS = serialization.EPOS
-	app.EWPOS = serialization.EWPOS
-	app.EMHost = serialization.EMHost
-	app.EMSuffix = serialization.EMSuffix
+	log.Println("Found model file", m.spec.DepModelName, " ... loading model")
+	model, e, err := readModel(m.spec.DepModelName, m.spec.modelSettings(app.MODEL_KIND_DEP))
+	if err != nil {
+		panic(err.Error())
+	}
+	// the parser transitions are laid out from the labels, as set up for
+	// training
+	e.ERel = app.NewRelationEnum(relations.Values)
+	e.ETrans = app.NewTransEnum(relations.Values)
+	if e.EMorphProp == nil {
+		e.EMorphProp = util.NewEnumSet(130)
+	}
 	log.Println("Loaded model")
 
+	arcSystem := &ArcEager{
+		ArcStandard: ArcStandard{
+			SHIFT: e.transitionIndex("SH"),
+			LEFT: e.transitionIndex("LA-" + string(nlp.ROOT_LABEL)),
+			RIGHT: e.transitionIndex("RA-" + string(nlp.ROOT_LABEL)),
+			Relations: e.ERel,
+			Transitions: e.ETrans,
+		},
+		REDUCE: e.transitionIndex("RE"),
+		POPROOT: e.transitionIndex("PR"),
+	}
+	arcSystem.AddDefaultOracle()
+
 	conf := &SimpleConfiguration{
-		EWord: app.EWord,
-		EPOS: app.EPOS,
-		EWPOS: app.EWPOS,
-		EMHost: app.EMHost,
-		EMSuffix: app.EMSuffix,
-		ERel: app.ERel,
-		ETrans: app.ETrans,
-		TerminalStack: terminalStack,
+		EWord: e.EWord,
+		EPOS: e.EPOS,
+		EWPOS: e.EWPOS,
+		EMHost: e.EMHost,
+		EMSuffix: e.EMSuffix,
+		ERel: e.ERel,
+		ETrans: e.ETrans,
+		TerminalStack: 0,
 		TerminalQueue: 0,
 	}
 
-	depBeam = &search.Beam{
-		TransFunc: transitionSystem,
-		FeatExtractor: extractor,
-		Base: conf,
+	m.dep = NewParserPool(m.poolName("dep"), Workers, &search.Beam{
+		TransFunc: transition.TransitionSystem(arcSystem),
+		FeatExtractor: e.extractor(featureSetup, []byte("A"), nil),
+		Base: conf.Copy(),
 		Model: model,
 		Size: app.BeamSize,
 		ConcurrentExec: app.ConcurrentBeam,
 		ShortTempAgenda: true,
-		EstimatedTransitions: app.EstimatedBeamTransitions(),
+		EstimatedTransitions: e.ERel.Len()*2 + 2,
 		ScoredStoreDense: true,
-	}
+	}, e)
 }
 
-func DepParseDisambiguatedLattice(input string) string {
-	depLock.Lock()
+func (m *Models) DepParseDisambiguatedLattice(ctx context.Context, input string) (string, error) {
 	log.Println("Reading disambiguated lattice")
 	log.Println("input:\n",input)
-	reader := strings.NewReader(input)
-	lDisamb, lDisambE := lattice.Read(reader, 0)
-	if lDisambE != nil {
-		panic(fmt.Sprintf("Failed reading raw input - %v", lDisamb))
+	internalSents, err := m.dep.readLattices(input)
+	if err != nil {
+		return "", err
 	}
-	internalSents := lattice.Lattice2SentenceCorpus(lDisamb, app.EWord, app.EPOS, app.EWPOS, app.EMorphProp, app.EMHost, app.EMSuffix)
 	sents := make([]interface{}, len(internalSents))
 	for i, instance := range internalSents {
 		sents[i] = instance.(nlp.LatticeSentence).TaggedSentence()
 	}
-	parsedGraphs := app.Parse(sents, depBeam)
-	graphAsConll := conll.Graph2ConllCorpus(parsedGraphs, app.EMHost, app.EMSuffix)
+	parsedGraphs, err := m.dep.ParseAll(ctx, sents)
+	if err != nil {
+		return "", err
+	}
+	graphAsConll := conll.Graph2ConllCorpus(parsedGraphs, m.dep.EMHost, m.dep.EMSuffix)
 	buf := new(bytes.Buffer)
 	conll.Write(buf, graphAsConll)
-	depLock.Unlock()
-	return buf.String()
+	return buf.String(), nil
 }
@@ -0,0 +1,105 @@
+package webapi
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// error codes returned in APIError.Code
+const (
+	ERR_BAD_REQUEST   = "bad_request"
+	ERR_INVALID_INPUT = "invalid_input"
+	ERR_NOT_FOUND     = "not_found"
+	ERR_UNAUTHORIZED  = "unauthorized"
+	ERR_CONFLICT      = "conflict"
+	ERR_ANALYZE       = "analyze_failed"
+	ERR_PARSE         = "parse_failed"
+	ERR_TIMEOUT       = "parse_timeout"
+	ERR_CANCELED      = "canceled"
+	ERR_UNAVAILABLE   = "unavailable"
+	ERR_INTERNAL      = "internal_error"
+)
+
+// APIError is the JSON error object returned by all handlers.
+// Sentence and Token are zero-based and only set when the failure
+// can be attributed to a specific input position.
+type APIError struct {
+	Status   int    `json:"-"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Sentence *int   `json:"sentence,omitempty"`
+	Token    *int   `json:"token,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error *APIError `json:"error"`
+}
+
+func (e *APIError) Error() string {
+	if e.Sentence != nil && e.Token != nil {
+		return fmt.Sprintf("%s: %s (sentence %d, token %d)", e.Code, e.Message, *e.Sentence, *e.Token)
+	}
+	if e.Sentence != nil {
+		return fmt.Sprintf("%s: %s (sentence %d)", e.Code, e.Message, *e.Sentence)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// AtSentence sets the index of the failing sentence
+func (e *APIError) AtSentence(sentence int) *APIError {
+	e.Sentence = &sentence
+	return e
+}
+
+// AtToken sets the index of the failing sentence and token
+func (e *APIError) AtToken(sentence, token int) *APIError {
+	e.Sentence = &sentence
+	e.Token = &token
+	return e
+}
+
+func NewAPIError(status int, code string, format string, args ...interface{}) *APIError {
+	return &APIError{
+		Status:  status,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// AsAPIError wraps any error not already an APIError as an internal error
+func AsAPIError(err error) *APIError {
+	if apiErr, ok := err.(*APIError); ok {
+		if apiErr.Status == 0 {
+			apiErr.Status = http.StatusInternalServerError
+		}
+		return apiErr
+	}
+	return NewAPIError(http.StatusInternalServerError, ERR_INTERNAL, "%v", err)
+}
+
+// recoveredError converts a recovered panic value into an APIError,
+// logging the stack trace of the failure
+func recoveredError(code string, r interface{}) *APIError {
+	log.Printf("Recovered from %s: %v\n%s", code, r, debug.Stack())
+	return NewAPIError(http.StatusInternalServerError, code, "%v", r)
+}
+
+func respondWithError(resp http.ResponseWriter, err error) {
+	apiErr := AsAPIError(err)
+	respondWithJSON(resp, apiErr.Status, ErrorResponse{apiErr})
+}
+
+// recoveryMiddleware turns any panic escaping a handler into an
+// internal_error response instead of dropping the connection
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				respondWithError(w, recoveredError(ERR_INTERNAL, rec))
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
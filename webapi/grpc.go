@@ -0,0 +1,280 @@
+package webapi
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	nlp "yap/nlp/types"
+	"yap/webapi/yappb"
+)
+
+var (
+	// gRPC listener port; 0 = no gRPC service
+	GRPCPort int
+)
+
+// grpcService implements yappb.YapServer on top of the same parser pools
+// as the REST handlers
+type grpcService struct{}
+
+// grpcError converts an error to a gRPC status, keeping the API error code
+// in the message
+func grpcError(err error) error {
+	apiErr := AsAPIError(err)
+	code := codes.Internal
+	switch apiErr.Status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		code = codes.InvalidArgument
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	}
+	switch apiErr.Code {
+	case ERR_TIMEOUT:
+		code = codes.DeadlineExceeded
+	case ERR_CANCELED:
+		code = codes.Canceled
+	}
+	return status.Error(code, apiErr.Error())
+}
+
+// grpcModels holds the model set of the pipeline named by the pipeline
+// metadata key of a call, of the default pipeline if it is not set; the
+// caller releases it when done
+func grpcModels(ctx context.Context, parses bool) (*Models, error) {
+	var name string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("pipeline"); len(values) > 0 {
+			name = values[0]
+		}
+	}
+	m, err := selectModels(name)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if parses {
+		if err := m.parses(); err != nil {
+			m.release()
+			return nil, status.Error(codes.Unimplemented, err.Error())
+		}
+	}
+	return m, nil
+}
+
+func requestSentences(req *yappb.Request) ([]nlp.BasicSentence, error) {
+	sents := make([]nlp.BasicSentence, len(req.Sentences))
+	for i, sent := range req.Sentences {
+		sents[i] = make(nlp.BasicSentence, len(sent.Tokens))
+		for j, token := range sent.Tokens {
+			sents[i][j] = nlp.Token(token)
+		}
+	}
+	if err := ValidateSentences(sents); err != nil {
+		return nil, err
+	}
+	return sents, nil
+}
+
+// NodesToResult converts the nodes of a sentence to its gRPC result; arcs
+// are only added for parsed sentences
+func NodesToResult(sentence int, nodes []Node, arcs bool) *yappb.Result {
+	result := &yappb.Result{
+		Sentence:  int32(sentence),
+		Morphemes: make([]*yappb.Morpheme, len(nodes)),
+	}
+	for i, node := range nodes {
+		names := make([]string, 0, len(node.Features))
+		for name := range node.Features {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		features := make([]*yappb.Feature, len(names))
+		for j, name := range names {
+			features[j] = &yappb.Feature{Name: name, Value: node.Features[name]}
+		}
+		result.Morphemes[i] = &yappb.Morpheme{
+			Token:    int32(node.Token),
+			Form:     node.Form,
+			Lemma:    node.Lemma,
+			Cpos:     node.CPOS,
+			Pos:      node.POS,
+			Features: features,
+		}
+		if arcs {
+			result.Arcs = append(result.Arcs, &yappb.Arc{
+				Head:      int32(node.Head),
+				Dependent: int32(i),
+				Label:     node.DepRel,
+			})
+		}
+	}
+	return result
+}
+
+func (s *grpcService) Tag(ctx context.Context, req *yappb.Request) (*yappb.Response, error) {
+	sents, err := requestSentences(req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	m, err := grpcModels(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer m.release()
+	maLattice, err := m.HebrewMorphAnalyzeBasicSentences(sents)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	parsed, err := m.RawMorphDisambiguateMappings(ctx, maLattice)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	response := &yappb.Response{Results: make([]*yappb.Result, len(parsed))}
+	for i, mappings := range parsed {
+		response.Results[i] = NodesToResult(i, TokensToNodes(MappingsToMorphemes(mappings)), false)
+	}
+	return response, nil
+}
+
+func (s *grpcService) Parse(ctx context.Context, req *yappb.Request) (*yappb.Response, error) {
+	sents, err := requestSentences(req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	m, err := grpcModels(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer m.release()
+	maLattice, err := m.HebrewMorphAnalyzeBasicSentences(sents)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	depGraph, err := m.JointRawParseAmbiguousLattices(ctx, maLattice)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	response := &yappb.Response{Results: make([]*yappb.Result, len(depGraph))}
+	for i, graph := range depGraph {
+		response.Results[i] = NodesToResult(i, GraphToNodes(graph), true)
+	}
+	return response, nil
+}
+
+// stream sends the result of every sentence in input order as soon as it
+// is ready. Once the client is gone the pipeline is drained without
+// sending.
+func (s *grpcService) stream(req *yappb.Request, out yappb.Yap_TagStreamServer, parse streamParser, arcs bool) error {
+	sents, err := requestSentences(req)
+	if err != nil {
+		return grpcError(err)
+	}
+	m, err := grpcModels(out.Context(), arcs)
+	if err != nil {
+		return err
+	}
+	defer m.release()
+	input := make(chan nlp.BasicSentence, 2)
+	go func() {
+		defer close(input)
+		for _, sent := range sents {
+			select {
+			case input <- sent:
+			case <-out.Context().Done():
+				return
+			}
+		}
+	}()
+
+	var sendErr error
+	for result := range m.pipelineStream(out.Context(), input, parse) {
+		line := <-result
+		if sendErr != nil {
+			continue
+		}
+		msg := NodesToResult(line.Sentence, line.Nodes, arcs)
+		if line.Error != nil {
+			msg.Error = &yappb.Error{Code: line.Error.Code, Message: line.Error.Message}
+		}
+		if sendErr = out.Send(msg); sendErr != nil {
+			log.Println("Failed sending stream result:", sendErr)
+		}
+	}
+	if sendErr == nil && out.Context().Err() != nil {
+		sendErr = status.Error(codes.Canceled, out.Context().Err().Error())
+	}
+	return sendErr
+}
+
+func (s *grpcService) TagStream(req *yappb.Request, out yappb.Yap_TagStreamServer) error {
+	return s.stream(req, out, mdStreamParser, false)
+}
+
+func (s *grpcService) ParseStream(req *yappb.Request, out yappb.Yap_ParseStreamServer) error {
+	return s.stream(req, out, jointStreamParser, true)
+}
+
+// grpcCall applies the readiness check, panic recovery and request metrics
+// of the REST middlewares to a gRPC call
+func grpcCall(method string, call func() error) (err error) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			err = grpcError(recoveredError(ERR_INTERNAL, r))
+		}
+		requestsTotal.Add(1, method, "GRPC", status.Code(err).String())
+		requestDuration.ObserveDuration(time.Since(start), method)
+	}()
+	log.Println("GRPC", method)
+	if !Ready() {
+		return status.Error(codes.Unavailable, ERR_UNAVAILABLE+": models are loading")
+	}
+	return call()
+}
+
+func unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	err = grpcCall(info.FullMethod, func() error {
+		resp, err = handler(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return grpcCall(info.FullMethod, func() error {
+		return handler(srv, stream)
+	})
+}
+
+// NewGRPCServer builds the gRPC server, using the TLS certificate of the
+// REST server when one is set
+func NewGRPCServer() (*grpc.Server, error) {
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(unaryInterceptor),
+		grpc.StreamInterceptor(streamInterceptor),
+	}
+	if TLSCertFile != "" && TLSKeyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(TLSCertFile, TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, grpc.Creds(creds))
+	}
+	server := grpc.NewServer(options...)
+	yappb.RegisterYapServer(server, &grpcService{})
+	return server, nil
+}
+
+func grpcAddr() string {
+	return net.JoinHostPort(ListenAddr, strconv.Itoa(GRPCPort))
+}
@@ -0,0 +1,151 @@
+package webapi
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"yap/app"
+	"yap/util"
+)
+
+// ModelFile is a loaded model or configuration file
+type ModelFile struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	MD5  string `json:"md5"`
+}
+
+// Info describes the models being served
+type Info struct {
+	Ready          bool        `json:"ready"`
+	Pipeline       string      `json:"pipeline"`
+	Pipelines      []string    `json:"pipelines,omitempty"`
+	Analyzer       string      `json:"analyzer"`
+	TagOnly        bool        `json:"tagonly"`
+	BeamSize       int         `json:"beam_size"`
+	Workers        int         `json:"workers"`
+	MdParamFunc    string      `json:"md_param_func"`
+	JointStrategy  string      `json:"joint_strategy,omitempty"`
+	OracleStrategy string      `json:"joint_oracle_strategy,omitempty"`
+	Labels         []string    `json:"labels,omitempty"`
+	Models         []ModelFile `json:"models"`
+	Loaded         *time.Time  `json:"loaded,omitempty"`
+}
+
+// Ready reports whether the model sets of all pipelines are loaded and
+// their parser pools are running
+func Ready() bool {
+	if len(pipelines) == 0 {
+		return false
+	}
+	for _, p := range pipelines {
+		if p.Models() == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func newModelFile(name, file string) ModelFile {
+	sum, err := util.MD5File(file)
+	if err != nil {
+		panic(fmt.Sprintf("Failed computing MD5 of %v: %v", file, err))
+	}
+	return ModelFile{name, file, sum}
+}
+
+// InfoInitialize records the files and settings of the loaded models of a
+// model set; it must run after the models are initialized
+func InfoInitialize(m *Models) {
+	spec := m.spec
+	info := &Info{
+		Pipeline:    spec.Name,
+		Analyzer:    spec.Analyzer,
+		TagOnly:     spec.TagOnly,
+		BeamSize:    app.BeamSize,
+		Workers:     Workers,
+		MdParamFunc: spec.MdParamFunc,
+	}
+	loaded := time.Now()
+	info.Loaded = &loaded
+	log.Println("Computing model checksums")
+	if spec.Analyzer == ANALYZER_MADICT {
+		info.Models = append(info.Models, newModelFile("ma_dict", spec.MaDict))
+		if len(spec.MaUDLex) > 0 {
+			info.Models = append(info.Models, newModelFile("ma_udlex", spec.MaUDLex))
+		}
+	} else {
+		info.Models = append(info.Models,
+			newModelFile("ma_prefix", spec.MaPrefix),
+			newModelFile("ma_lexicon", spec.MaLexicon),
+		)
+	}
+	info.Models = append(info.Models,
+		newModelFile("md_model", spec.MdModelName),
+		newModelFile("md_features", spec.MdFeatures),
+	)
+	if !spec.TagOnly {
+		info.JointStrategy = app.JointStrategy
+		info.OracleStrategy = app.OracleStrategy
+		info.Models = append(info.Models,
+			newModelFile("dep_model", spec.DepModelName),
+			newModelFile("dep_features", spec.DepFeatures),
+			newModelFile("dep_labels", spec.DepLabels),
+			newModelFile("joint_model", spec.JointModelName),
+			newModelFile("joint_features", spec.JointFeatures),
+		)
+		if m.joint != nil {
+			info.Labels = make([]string, m.joint.ERel.Len())
+			for i := range info.Labels {
+				info.Labels[i] = fmt.Sprint(m.joint.ERel.ValueOf(i))
+			}
+		}
+	}
+	m.info = info
+}
+
+// readinessMiddleware rejects requests that need the models while they
+// are still loading
+func readinessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Ready() {
+			respondWithError(w, NewAPIError(http.StatusServiceUnavailable, ERR_UNAVAILABLE, "models are loading"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HealthHandler reports that the process is up, whether or not the models
+// are loaded
+func HealthHandler(resp http.ResponseWriter, req *http.Request) {
+	respondWithJSON(resp, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func ReadyHandler(resp http.ResponseWriter, req *http.Request) {
+	if !Ready() {
+		respondWithJSON(resp, http.StatusServiceUnavailable, map[string]string{"status": "loading"})
+		return
+	}
+	respondWithJSON(resp, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// InfoHandler describes the default pipeline, or the one named by the
+// pipeline query parameter
+func InfoHandler(resp http.ResponseWriter, req *http.Request) {
+	if !Ready() {
+		respondWithJSON(resp, http.StatusOK, Info{Pipeline: PipelineName, Pipelines: pipelineNames, TagOnly: TagOnly, Models: []ModelFile{}})
+		return
+	}
+	m, err := requestModels(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	defer m.release()
+	info := *m.info
+	info.Ready = true
+	info.Pipelines = pipelineNames
+	respondWithJSON(resp, http.StatusOK, info)
+}
@@ -2,100 +2,139 @@ package webapi
 
 import (
 	"bytes"
-	"fmt"
-	"github.com/gonuts/commander"
 	"io"
 	"log"
+	"net/http"
 	"strings"
-	"sync"
 	"yap/app"
 	"yap/nlp/format/lattice"
 	"yap/nlp/format/raw"
 	"yap/nlp/parser/ma"
 	"yap/nlp/parser/xliter8"
 	nlp "yap/nlp/types"
-	"yap/util"
 )
 
 var (
-	maLock   sync.Mutex
 	maHebrew xliter8.Interface
-	maData   *ma.BGULex
 )
 
-func HebrewMorphAnalyazerInitialize(cmd *commander.Command, args []string) {
-	prefixLocation, found := util.LocateFile(app.HebMaPrefixFile, app.HEB_MA_DEFAULT_DATA_DIRS)
-	if !found {
-		panic(fmt.Sprintf("Lexicon prefix file not found: %v", app.HebMaPrefixFile))
-	}
-	lexiconLocation, found := util.LocateFile(app.HebMaLexiconFile, app.HEB_MA_DEFAULT_DATA_DIRS)
-	if !found {
-		panic(fmt.Sprintf("Lexicon file not found: %v", app.HebMaLexiconFile))
-	}
-	app.HebMaPrefixFile = prefixLocation
-	app.HebMaLexiconFile = lexiconLocation
-	app.HebMAConfigOut()
-	maData = new(ma.BGULex)
+// HebrewMorphAnalyazerInitialize loads the analyzer of a model set
+func HebrewMorphAnalyazerInitialize(m *Models) {
+	maData := new(ma.BGULex)
 	maData.MAType = "spmrl"
 	log.Println("Reading Morphological Analyzer BGU Prefixes")
-	maData.LoadPrefixes(app.HebMaPrefixFile)
+	maData.LoadPrefixes(m.spec.MaPrefix)
 	log.Println("Reading Morphological Analyzer BGU Lexicon")
-	maData.LoadLex(app.HebMaLexiconFile, app.HebMaNnpnofeats)
+	maData.LoadLex(m.spec.MaLexicon, app.HebMaNnpnofeats)
 	log.Println()
 	maData.AlwaysNNP = app.HebMaAlwaysnnp
 	maData.LogOOV = app.HebMaShowoov
-
+	maData.User = userLex
+	m.lexicon = maData
 }
 
-func HebrewMorphAnalyzeRawSentences(input string) string {
-	maLock.Lock()
-	var (
-		reader io.Reader
-		sents  []nlp.BasicSentence
-		err    error
-	)
-	reader = strings.NewReader(input)
-	sents, err = raw.Read(reader, 0)
-	if err != nil {
-		panic(fmt.Sprintf("Failed reading raw input - %v", err))
-	}
-	log.Println("Running Hebrew Morphological Analysis")
-	log.Println("input:\n", input)
+// newAnalyzer returns a per-request view of the shared analyzer with its own
+// analysis statistics; the dictionaries of the analyzers are read-only
+func (m *Models) newAnalyzer() (ma.MorphologicalAnalyzer, *ma.AnalyzeStats) {
 	stats := new(ma.AnalyzeStats)
 	stats.Init()
-	maData.Stats = stats
-	//prefix := log.Prefix()
-	lattices := make([]nlp.LatticeSentence, len(sents))
-	oovInd := make([]interface{}, len(sents))
+	if m.dict != nil {
+		analyzer := *m.dict
+		analyzer.Stats = stats
+		return &analyzer, stats
+	}
+	analyzer := *m.lexicon
+	analyzer.Stats = stats
+	return &analyzer, stats
+}
+
+// ValidateSentences rejects input that cannot be represented in a lattice
+func ValidateSentences(sents []nlp.BasicSentence) error {
 	for i, sent := range sents {
-		//log.SetPrefix(fmt.Sprintf("%v graph# %v ", prefix, i))
-		lattices[i], oovInd[i] = maData.Analyze(sent.Tokens())
+		if len(sent) == 0 {
+			return NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "empty sentence").AtSentence(i)
+		}
+		for j, token := range sent {
+			if len(token) == 0 {
+				return NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "empty token").AtToken(i, j)
+			}
+			if strings.ContainsAny(string(token), " \t\r\n") {
+				return NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "token %q contains whitespace", token).AtToken(i, j)
+			}
+		}
 	}
-	log.Println()
-	output := lattice.Sentence2LatticeCorpus(lattices, maHebrew)
-	buf := new(bytes.Buffer)
-	err = lattice.Write(buf, output)
-	maLock.Unlock()
-	return buf.String()
+	return nil
 }
 
-func HebrewMorphAnalyzeBasicSentences(sents []nlp.BasicSentence) string {
-	maLock.Lock()
+// analyzeSentence runs the analyzer on a single sentence, recovering from
+// failures on malformed tokens
+func analyzeSentence(analyzer ma.MorphologicalAnalyzer, stats *ma.AnalyzeStats, sent nlp.BasicSentence) (lat nlp.LatticeSentence, oov interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoveredError(ERR_ANALYZE, r)
+		}
+	}()
+	oovBefore := stats.OOVTokens
+	lat, oov = analyzer.Analyze(sent.Tokens())
+	recordAnalysis(len(sent), stats.OOVTokens-oovBefore)
+	return lat, oov, nil
+}
 
-	stats := new(ma.AnalyzeStats)
-	stats.Init()
-	maData.Stats = stats
+func (m *Models) analyzeSentences(sents []nlp.BasicSentence, entries []ma.Entry) (string, error) {
+	analyzer, stats := m.newAnalyzer()
+	if len(entries) > 0 {
+		lexicon, ok := analyzer.(*ma.BGULex)
+		if !ok {
+			return "", NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "pipeline %s does not take lexicon entries", m.spec.Name)
+		}
+		if err := lexicon.SetEntries(entries); err != nil {
+			return "", NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "invalid lexicon: %v", err)
+		}
+	}
 
 	lattices := make([]nlp.LatticeSentence, len(sents))
 	//oovInd := make([]interface{}, len(sents))
 	for i, sent := range sents {
-		lattices[i], _ = maData.Analyze(sent.Tokens())
+		var err error
+		lattices[i], _, err = analyzeSentence(analyzer, stats, sent)
+		if err != nil {
+			return "", AsAPIError(err).AtSentence(i)
+		}
 	}
 
 	output := lattice.Sentence2LatticeCorpus(lattices, maHebrew)
 	buf := new(bytes.Buffer)
-	lattice.Write(buf, output)
+	if err := lattice.Write(buf, output); err != nil {
+		return "", NewAPIError(http.StatusInternalServerError, ERR_ANALYZE, "failed writing lattices: %v", err)
+	}
+	return buf.String(), nil
+}
 
-	maLock.Unlock()
-	return buf.String()
+func (m *Models) HebrewMorphAnalyzeRawSentences(input string) (string, error) {
+	var (
+		reader io.Reader
+		sents  []nlp.BasicSentence
+		err    error
+	)
+	reader = strings.NewReader(input)
+	sents, err = raw.Read(reader, 0)
+	if err != nil {
+		return "", NewAPIError(http.StatusBadRequest, ERR_INVALID_INPUT, "failed reading raw input: %v", err)
+	}
+	log.Println("Running Hebrew Morphological Analysis")
+	log.Println("input:\n", input)
+	return m.analyzeSentences(sents, nil)
+}
+
+func (m *Models) HebrewMorphAnalyzeBasicSentences(sents []nlp.BasicSentence) (string, error) {
+	return m.HebrewMorphAnalyzeWithEntries(sents, nil)
+}
+
+// HebrewMorphAnalyzeWithEntries analyzes the sentences with extra lexical
+// entries that apply to this call only
+func (m *Models) HebrewMorphAnalyzeWithEntries(sents []nlp.BasicSentence, entries []ma.Entry) (string, error) {
+	if err := ValidateSentences(sents); err != nil {
+		return "", err
+	}
+	return m.analyzeSentences(sents, entries)
 }
@@ -0,0 +1,497 @@
+package webapi
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	nlp "yap/nlp/types"
+)
+
+// job states
+const (
+	JOB_QUEUED  = "queued"
+	JOB_RUNNING = "running"
+	JOB_DONE    = "done"
+	JOB_FAILED  = "failed"
+)
+
+// job modes
+const (
+	JOB_PARSE = "parse"
+	JOB_TAG   = "tag"
+)
+
+var (
+	// maximum number of jobs kept; finished jobs are evicted oldest first
+	MaxJobs int
+	// number of jobs processed concurrently
+	JobRunners int
+	// directory for spilling job results to disk; empty = keep in memory
+	JobDir string
+	// default and maximum number of results per page
+	JobPageSize int
+
+	jobs *JobStore
+)
+
+// Job is a batch of sentences processed in the background. Results are
+// kept as encoded StreamResult lines, in memory or in a spill file.
+type Job struct {
+	sync.Mutex
+	ID        string
+	Pipeline  string
+	Mode      string
+	Status    string
+	Total     int
+	Processed int
+	Failed    int
+	Created   time.Time
+	Started   time.Time
+	Finished  time.Time
+	Err       *APIError
+
+	sents   []nlp.BasicSentence
+	results []json.RawMessage
+	// spill file and the offset of every result line in it
+	spill     string
+	spillFile *os.File
+	spillSize int64
+	offsets   []int64
+}
+
+// JobStatus is the JSON view of a job and a page of its results
+type JobStatus struct {
+	ID        string            `json:"id"`
+	Pipeline  string            `json:"pipeline"`
+	Mode      string            `json:"mode"`
+	Status    string            `json:"status"`
+	Total     int               `json:"total"`
+	Processed int               `json:"processed"`
+	Failed    int               `json:"failed"`
+	Created   time.Time         `json:"created"`
+	Started   *time.Time        `json:"started,omitempty"`
+	Finished  *time.Time        `json:"finished,omitempty"`
+	Error     *APIError         `json:"error,omitempty"`
+	Offset    int               `json:"offset"`
+	Results   []json.RawMessage `json:"results"`
+	Next      *int              `json:"next,omitempty"`
+}
+
+func (j *Job) finished() bool {
+	return j.Status == JOB_DONE || j.Status == JOB_FAILED
+}
+
+// errStoring is the error of a job whose results can't be spilled
+func errStoring(err error) error {
+	return NewAPIError(http.StatusInternalServerError, ERR_INTERNAL, "failed storing results: %v", err)
+}
+
+func (j *Job) addResult(result StreamResult) error {
+	line, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	j.Lock()
+	defer j.Unlock()
+	if j.spillFile != nil {
+		n, err := j.spillFile.Write(append(line, '\n'))
+		if err != nil {
+			return errStoring(err)
+		}
+		j.offsets = append(j.offsets, j.spillSize)
+		j.spillSize += int64(n)
+	} else {
+		j.results = append(j.results, line)
+	}
+	j.Processed++
+	if result.Error != nil {
+		j.Failed++
+	}
+	return nil
+}
+
+// page returns up to limit results starting at offset
+func (j *Job) page(offset, limit int) ([]json.RawMessage, error) {
+	j.Lock()
+	defer j.Unlock()
+	if offset >= j.Processed {
+		return []json.RawMessage{}, nil
+	}
+	end := offset + limit
+	if end > j.Processed {
+		end = j.Processed
+	}
+	if len(j.spill) == 0 {
+		return j.results[offset:end], nil
+	}
+	file, err := os.Open(j.spill)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err = file.Seek(j.offsets[offset], io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	page := make([]json.RawMessage, 0, end-offset)
+	for i := offset; i < end; i++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, json.RawMessage(line[:len(line)-1]))
+	}
+	return page, nil
+}
+
+func (j *Job) Report(offset, limit int) (*JobStatus, error) {
+	results, err := j.page(offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	j.Lock()
+	defer j.Unlock()
+	status := &JobStatus{
+		ID:        j.ID,
+		Pipeline:  j.Pipeline,
+		Mode:      j.Mode,
+		Status:    j.Status,
+		Total:     j.Total,
+		Processed: j.Processed,
+		Failed:    j.Failed,
+		Created:   j.Created,
+		Error:     j.Err,
+		Offset:    offset,
+		Results:   results,
+	}
+	if !j.Started.IsZero() {
+		started := j.Started
+		status.Started = &started
+	}
+	if !j.Finished.IsZero() {
+		finished := j.Finished
+		status.Finished = &finished
+	}
+	if next := offset + len(results); next < j.Total {
+		status.Next = &next
+	}
+	return status, nil
+}
+
+func (j *Job) run() {
+	j.Lock()
+	j.Status = JOB_RUNNING
+	j.Started = time.Now()
+	sents, mode := j.sents, j.Mode
+	var err error
+	if len(j.spill) > 0 {
+		if j.spillFile, err = os.Create(j.spill); err != nil {
+			err = errStoring(err)
+		}
+	}
+	j.Unlock()
+	if err != nil {
+		j.finish(err)
+		return
+	}
+	// the models current when the job starts, not when it was submitted
+	m, err := selectModels(j.Pipeline)
+	if err != nil {
+		j.finish(err)
+		return
+	}
+	defer m.release()
+	log.Println("Running job", j.ID, "with", len(sents), "sentences")
+
+	parse := jointStreamParser
+	if mode == JOB_TAG {
+		parse = mdStreamParser
+	}
+	input := make(chan nlp.BasicSentence, 2)
+	go func() {
+		for _, sent := range sents {
+			input <- sent
+		}
+		close(input)
+	}()
+
+	for result := range m.pipelineStream(context.Background(), input, parse) {
+		line := <-result
+		if err != nil {
+			// drain the pipeline after a failure
+			continue
+		}
+		err = j.addResult(line)
+	}
+	j.finish(err)
+}
+
+func (j *Job) finish(err error) {
+	j.Lock()
+	defer j.Unlock()
+	j.sents = nil
+	j.Finished = time.Now()
+	if j.spillFile != nil {
+		if closeErr := j.spillFile.Close(); err == nil && closeErr != nil {
+			err = errStoring(closeErr)
+		}
+		j.spillFile = nil
+	}
+	if err != nil {
+		log.Println("Job", j.ID, "failed:", err)
+		j.Status = JOB_FAILED
+		j.Err = AsAPIError(err)
+		return
+	}
+	j.Status = JOB_DONE
+	log.Println("Finished job", j.ID, "in", j.Finished.Sub(j.Started))
+}
+
+func (j *Job) remove() {
+	j.Lock()
+	defer j.Unlock()
+	if len(j.spill) > 0 {
+		if err := os.Remove(j.spill); err != nil && !os.IsNotExist(err) {
+			log.Println("Failed removing job spill file:", err)
+		}
+	}
+	j.results = nil
+	j.offsets = nil
+}
+
+// JobStore keeps at most size jobs and runs them on a fixed number of
+// background runners
+type JobStore struct {
+	sync.Mutex
+	size  int
+	dir   string
+	jobs  map[string]*Job
+	order []string
+	queue chan *Job
+}
+
+func NewJobStore(size, runners int, dir string) *JobStore {
+	if size < 1 {
+		size = 1
+	}
+	if runners < 1 {
+		runners = 1
+	}
+	store := &JobStore{
+		size:  size,
+		dir:   dir,
+		jobs:  make(map[string]*Job, size),
+		queue: make(chan *Job, size),
+	}
+	for i := 0; i < runners; i++ {
+		go func() {
+			for job := range store.queue {
+				job.run()
+			}
+		}()
+	}
+	return store
+}
+
+func newJobID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(fmt.Sprintf("Failed generating job id: %v", err))
+	}
+	return hex.EncodeToString(id)
+}
+
+// evict removes the oldest finished job; the store must be locked
+func (s *JobStore) evict() bool {
+	for i, id := range s.order {
+		job := s.jobs[id]
+		job.Lock()
+		done := job.finished()
+		job.Unlock()
+		if done {
+			job.remove()
+			delete(s.jobs, id)
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Submit stores a new job and queues it for processing
+func (s *JobStore) Submit(pipeline, mode string, sents []nlp.BasicSentence) (*Job, error) {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.jobs) >= s.size && !s.evict() {
+		return nil, NewAPIError(http.StatusServiceUnavailable, ERR_UNAVAILABLE, "job store is full, %d jobs pending", len(s.jobs))
+	}
+	job := &Job{
+		ID:       newJobID(),
+		Pipeline: pipeline,
+		Mode:     mode,
+		Status:   JOB_QUEUED,
+		Total:    len(sents),
+		Created:  time.Now(),
+		sents:    sents,
+	}
+	if len(s.dir) > 0 {
+		job.spill = filepath.Join(s.dir, job.ID+".ndjson")
+	}
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job.ID)
+	// never blocks, the queue holds as many jobs as the store
+	s.queue <- job
+	return job, nil
+}
+
+func (s *JobStore) Get(id string) (*Job, bool) {
+	s.Lock()
+	defer s.Unlock()
+	job, exists := s.jobs[id]
+	return job, exists
+}
+
+// JobsInitialize sets up the job store; previous spill files in JobDir
+// are not reused
+func JobsInitialize() {
+	if len(JobDir) > 0 {
+		if err := os.MkdirAll(JobDir, 0755); err != nil {
+			panic(fmt.Sprintf("Failed creating job directory %v: %v", JobDir, err))
+		}
+		log.Println("Spilling job results to", JobDir)
+	}
+	if JobPageSize < 1 {
+		JobPageSize = 100
+	}
+	jobs = NewJobStore(MaxJobs, JobRunners, JobDir)
+}
+
+// readJobSentences reads either a JSON ParseRequest or a plain text body
+// with one sentence of whitespace separated tokens per line
+func readJobSentences(req *http.Request) ([]nlp.BasicSentence, error) {
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		request := ParseRequest{}
+		if err := decodeRequest(req, &request); err != nil {
+			return nil, err
+		}
+		return request.Sentences, nil
+	}
+	var sents []nlp.BasicSentence
+	scanner := bufio.NewScanner(req.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_STREAM_LINE)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		sent := make(nlp.BasicSentence, len(fields))
+		for i, field := range fields {
+			sent[i] = nlp.Token(field)
+		}
+		sents = append(sents, sent)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, NewAPIError(http.StatusBadRequest, ERR_BAD_REQUEST, "failed reading request body: %v", err)
+	}
+	return sents, nil
+}
+
+func intParam(req *http.Request, name string, defaultValue int) (int, error) {
+	value := req.URL.Query().Get(name)
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, NewAPIError(http.StatusBadRequest, ERR_BAD_REQUEST, "invalid %s %q", name, value)
+	}
+	return i, nil
+}
+
+func SubmitJobHandler(resp http.ResponseWriter, req *http.Request) {
+	m, err := requestModels(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	defer m.release()
+	mode := req.URL.Query().Get("mode")
+	switch {
+	case len(mode) == 0 && m.spec.TagOnly:
+		mode = JOB_TAG
+	case len(mode) == 0:
+		mode = JOB_PARSE
+	case mode == JOB_PARSE && m.spec.TagOnly:
+		respondWithError(resp, m.parses())
+		return
+	case mode != JOB_PARSE && mode != JOB_TAG:
+		respondWithError(resp, NewAPIError(http.StatusBadRequest, ERR_BAD_REQUEST, "unknown mode %q, expected %s or %s", mode, JOB_PARSE, JOB_TAG))
+		return
+	}
+	sents, err := readJobSentences(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	if len(sents) == 0 {
+		respondWithError(resp, NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "no sentences"))
+		return
+	}
+	if err := ValidateSentences(sents); err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	job, err := jobs.Submit(m.spec.Name, mode, sents)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	log.Println("Queued job", job.ID, "with", job.Total, "sentences")
+	status, err := job.Report(0, 0)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	resp.Header().Set("Location", "/jobs/"+job.ID)
+	respondWithJSON(resp, http.StatusAccepted, status)
+}
+
+func JobStatusHandler(resp http.ResponseWriter, req *http.Request) {
+	job, exists := jobs.Get(mux.Vars(req)["id"])
+	if !exists {
+		respondWithError(resp, NewAPIError(http.StatusNotFound, ERR_NOT_FOUND, "no such job"))
+		return
+	}
+	offset, err := intParam(req, "offset", 0)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	limit, err := intParam(req, "limit", JobPageSize)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	if limit > JobPageSize {
+		limit = JobPageSize
+	}
+	status, err := job.Report(offset, limit)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	respondWithJSON(resp, http.StatusOK, status)
+}
@@ -0,0 +1,35 @@
+package webapi
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJobErrors(t *testing.T) {
+	servePipelines(t)
+	tests := []struct {
+		name    string
+		job     *Job
+		status  int
+		code    string
+		message string
+	}{
+		{"unknown pipeline", &Job{Pipeline: "none"}, http.StatusNotFound, ERR_NOT_FOUND, "no pipeline"},
+		{"loading pipeline", &Job{Pipeline: "loading"}, http.StatusServiceUnavailable, ERR_UNAVAILABLE, "loading"},
+		{"spill file", &Job{Pipeline: "test", spill: filepath.Join(t.TempDir(), "none", "job")}, http.StatusInternalServerError, ERR_INTERNAL, "failed storing results"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.job.run()
+			if test.job.Status != JOB_FAILED {
+				t.Fatalf("got status %s, want %s", test.job.Status, JOB_FAILED)
+			}
+			err := test.job.Err
+			if err.Status != test.status || err.Code != test.code || !strings.Contains(err.Message, test.message) {
+				t.Errorf("got error %d %v, want %d %s: %s...", err.Status, err, test.status, test.code, test.message)
+			}
+		})
+	}
+}
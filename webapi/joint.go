@@ -2,207 +2,127 @@ package webapi
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
-	"strings"
-	"sync"
 	"yap/alg/search"
 	"yap/alg/transition"
 	transitionmodel "yap/alg/transition/model"
 	"yap/app"
 	"yap/nlp/format/conll"
-	"yap/nlp/format/lattice"
 	"yap/nlp/format/mapping"
 	"yap/nlp/format/segmentation"
 	. "yap/nlp/parser/dependency/transition"
 	"yap/nlp/parser/disambig"
 	"yap/nlp/parser/joint"
 	nlp "yap/nlp/types"
-	"yap/util"
 	"yap/util/conf"
 )
 
-var (
-	extractor        *transition.GenericExtractor
-	arcSystem        transition.TransitionSystem
-	transitionSystem transition.TransitionSystem
-	model            *transitionmodel.AvgMatrixSparse
-	terminalStack    int
-	paramFunc        nlp.MDParam
-	jointLock        sync.Mutex
-	beam             *search.Beam
-)
-
-func JointParserInitialize() {
-	paramFunc, exists := nlp.MDParams[app.MdParamFuncName]
-	if !exists {
-		log.Fatalln("Param Func", app.MdParamFuncName, "does not exist")
-	}
-	mdTrans := &disambig.MDTrans{
-		ParamFunc: paramFunc,
-		UsePOP:    app.UsePOP,
-	}
-	arcSystem = &ArcEager{
-		ArcStandard: ArcStandard{},
-	}
-	terminalStack = 0
-	arcSystem.AddDefaultOracle()
-	jointTrans := &joint.JointTrans{
-		MDTrans:       mdTrans,
-		ArcSys:        arcSystem,
-		JointStrategy: app.JointStrategy,
-	}
-	jointTrans.AddDefaultOracle()
-	jointTrans.Oracle().(*joint.JointOracle).OracleStrategy = app.OracleStrategy
-	transitionSystem = transition.TransitionSystem(jointTrans)
-	if !app.VerifyExists(app.JointFeaturesFile) {
-		featuresLocation, found := util.LocateFile(app.JointFeaturesFile, app.DEFAULT_CONF_DIRS)
-		if !found {
-			panic(fmt.Sprintf("Joint features not found"))
-		}
-		app.JointFeaturesFile = featuresLocation
-	}
-	if !app.VerifyExists(app.DepLabelsFile) {
-		labelsLocation, found := util.LocateFile(app.DepLabelsFile, app.DEFAULT_CONF_DIRS)
-		if !found {
-			panic(fmt.Sprintf("Dep labels not found"))
-		}
-		app.DepLabelsFile = labelsLocation
-	}
-	if !app.VerifyExists(app.JointModelFile) {
-		modelLocation, found := util.LocateFile(app.JointModelFile, app.DEFAULT_MODEL_DIRS)
-		if !found {
-			panic(fmt.Sprintf("Joint model not found"))
-		}
-		app.JointModelFile = modelLocation
-	}
-	confBeam := &search.Beam{}
-	confBeam.Align = app.AlignBeam
-	confBeam.Averaged = app.AverageScores
-	app.JointConfigOut(app.JointModelFile, confBeam, transitionSystem)
-	relations, err := conf.ReadFile(app.DepLabelsFile)
+// JointParserInitialize loads the joint model of a model set and starts its
+// parser pool
+func JointParserInitialize(m *Models, settings *disambig.Settings, paramFunc nlp.MDParam) {
+	jointFeatures, err := transition.LoadFeatureConfFile(m.spec.JointFeatures)
 	if err != nil {
-		panic(fmt.Sprintf("Joint labels not found"))
-	}
-	app.SetupEnum(relations.Values)
-	arcSystem = &ArcEager{
-		ArcStandard: ArcStandard{
-			SHIFT:       app.SH.Value(),
-			LEFT:        app.LA.Value(),
-			RIGHT:       app.RA.Value(),
-			Relations:   app.ERel,
-			Transitions: app.ETrans,
-		},
-		REDUCE:  app.RE.Value(),
-		POPROOT: app.PR.Value(),
+		panic(fmt.Sprintf("Failed reading joint feature configuration file [%v]: %v", m.spec.JointFeatures, err))
 	}
-	arcSystem.AddDefaultOracle()
-	jointTrans.ArcSys = arcSystem
-	jointTrans.Transitions = app.ETrans
-	mdTrans.Transitions = app.ETrans
-	mdTrans.UsePOP = app.UsePOP
-	mdTrans.POP = app.POP
-	disambig.UsePOP = app.UsePOP
-	disambig.SwitchFormLemma = !lattice.IGNORE_LEMMA
-	disambig.LEMMAS = !lattice.IGNORE_LEMMA
-	mdTrans.AddDefaultOracle()
-	jointTrans.MDTransition = app.MD
-	jointTrans.JointStrategy = app.JointStrategy
-	jointTrans.AddDefaultOracle()
-	jointTrans.Oracle().(*joint.JointOracle).OracleStrategy = app.OracleStrategy
-	transitionSystem = transition.TransitionSystem(jointTrans)
-	featureSetup, err := transition.LoadFeatureConfFile(app.JointFeaturesFile)
+	labels, err := conf.ReadFile(m.spec.DepLabels)
 	if err != nil {
-		panic(fmt.Sprintf("Joint features not found"))
+		panic(fmt.Sprintf("Failed reading joint labels [%v]: %v", m.spec.DepLabels, err))
 	}
-	groups := []byte("MPLA")
-	extractor = app.SetupExtractor(featureSetup, groups)
-	log.Println()
-	nlp.InitOpenParamFamily("HEBTB")
 	log.Println()
 
-	log.Println("Found model file", app.JointModelFile, " ... loading model")
-	serialization := app.ReadModel(app.JointModelFile)
-	model = &transitionmodel.AvgMatrixSparse{}
-	model.Deserialize(serialization.WeightModel)
-	app.EWord = serialization.EWord
-	app.EPOS = serialization.EPOS
-	app.EWPOS = serialization.EWPOS
-	app.EMHost = serialization.EMHost
-	app.EMSuffix = serialization.EMSuffix
-	app.EMorphProp = serialization.EMorphProp
-	app.ETrans = serialization.ETrans
-	app.ETokens = serialization.ETokens
+	log.Println("Found model file", m.spec.JointModelName, " ... loading model")
+	model, e, err := readModel(m.spec.JointModelName, m.spec.modelSettings(app.MODEL_KIND_JOINT))
+	if err != nil {
+		panic(err.Error())
+	}
+	e.ERel = app.NewRelationEnum(labels.Values)
 	log.Println("Loaded model")
-	arcSystem = &ArcEager{
+	m.joint = NewParserPool(m.poolName("joint"), Workers, newJointBeam(model, e, jointFeatures, paramFunc, settings), e)
+}
+
+// newJointBeam builds the joint parser beam, with its transition system,
+// extractor and base configuration, on top of the loaded model weights
+func newJointBeam(model transitionmodel.Interface, e enums, jointFeatures *transition.FeatureSetup, paramFunc nlp.MDParam, settings *disambig.Settings) *search.Beam {
+	// the arc transitions lead the enumeration, as set up for training
+	rootLeft, rootRight := "LA-"+string(nlp.ROOT_LABEL), "RA-"+string(nlp.ROOT_LABEL)
+	iPOP := e.transitionIndex("POP")
+	pop := &transition.TypedTransition{T: 'P', V: iPOP}
+	md := transition.ConstTransition(iPOP + 1)
+	mdTrans := &disambig.MDTrans{
+		ParamFunc:   paramFunc,
+		UsePOP:      settings.UsePOP,
+		POP:         pop,
+		Transitions: e.ETrans,
+	}
+	mdTrans.AddDefaultOracle()
+	arcSystem := &ArcEager{
 		ArcStandard: ArcStandard{
-			SHIFT:       app.SH.Value(),
-			LEFT:        app.LA.Value(),
-			RIGHT:       app.RA.Value(),
-			Relations:   app.ERel,
-			Transitions: app.ETrans,
+			SHIFT:       e.transitionIndex("SH"),
+			LEFT:        e.transitionIndex(rootLeft),
+			RIGHT:       e.transitionIndex(rootRight),
+			Relations:   e.ERel,
+			Transitions: e.ETrans,
 		},
-		REDUCE:  app.RE.Value(),
-		POPROOT: app.PR.Value(),
+		REDUCE:  e.transitionIndex("RE"),
+		POPROOT: e.transitionIndex("PR"),
 	}
 	arcSystem.AddDefaultOracle()
-	jointTrans.ArcSys = arcSystem
-	jointTrans.Transitions = app.ETrans
-	mdTrans.Transitions = app.ETrans
-	mdTrans.UsePOP = app.UsePOP
-	mdTrans.POP = app.POP
-	disambig.UsePOP = app.UsePOP
-	disambig.SwitchFormLemma = !lattice.IGNORE_LEMMA
-	disambig.LEMMAS = !lattice.IGNORE_LEMMA
-	mdTrans.AddDefaultOracle()
-	jointTrans.MDTransition = app.MD
-	jointTrans.JointStrategy = app.JointStrategy
-	transitionSystem = transition.TransitionSystem(jointTrans)
+	jointTrans := &joint.JointTrans{
+		MDTrans:       mdTrans,
+		ArcSys:        arcSystem,
+		Transitions:   e.ETrans,
+		MDTransition:  md,
+		JointStrategy: app.JointStrategy,
+	}
 
 	joinConf := &joint.JointConfig{
 		SimpleConfiguration: SimpleConfiguration{
-			EWord:         app.EWord,
-			EPOS:          app.EPOS,
-			EWPOS:         app.EWPOS,
-			EMHost:        app.EMHost,
-			EMSuffix:      app.EMSuffix,
-			ERel:          app.ERel,
-			ETrans:        app.ETrans,
-			TerminalStack: terminalStack,
+			EWord:         e.EWord,
+			EPOS:          e.EPOS,
+			EWPOS:         e.EWPOS,
+			EMHost:        e.EMHost,
+			EMSuffix:      e.EMSuffix,
+			ERel:          e.ERel,
+			ETrans:        e.ETrans,
+			TerminalStack: 0,
 			TerminalQueue: 0,
 		},
 		MDConfig: disambig.MDConfig{
-			ETokens:     app.ETokens,
-			POP:         app.POP,
-			Transitions: app.ETrans,
+			ETokens:     e.ETokens,
+			POP:         pop,
+			Transitions: e.ETrans,
 			ParamFunc:   paramFunc,
+			Settings:    settings,
 		},
-		MDTrans: app.MD,
+		MDTrans: md,
 	}
-	beam = &search.Beam{
-		TransFunc:            transitionSystem,
-		FeatExtractor:        extractor,
+	jointBeam := &search.Beam{
+		TransFunc:            transition.TransitionSystem(jointTrans),
+		FeatExtractor:        e.extractor(jointFeatures, []byte("MPLA"), pop),
 		Base:                 joinConf,
 		Size:                 app.BeamSize,
 		ConcurrentExec:       app.ConcurrentBeam,
-		Transitions:          app.ETrans,
+		Transitions:          e.ETrans,
 		EstimatedTransitions: 1000, // chosen by random dice roll
 	}
-	beam.Model = model
-	beam.ShortTempAgenda = true
+	jointBeam.Model = model
+	jointBeam.ShortTempAgenda = true
+	return jointBeam
 }
 
-func JointParseAmbiguousLattices(input string) (string, string, string) {
-	jointLock.Lock()
+func (m *Models) JointParseAmbiguousLattices(ctx context.Context, input string) (string, string, string, error) {
 	log.Println("Reading ambiguous lattices")
 	log.Println("input:\n", input)
-	reader := strings.NewReader(input)
-	lAmb, lAmbE := lattice.Read(reader, 0)
-	if lAmbE != nil {
-		panic(fmt.Sprintf("Failed reading raw input - %v", lAmbE))
+	predAmbLat, err := m.joint.readLattices(input)
+	if err != nil {
+		return "", "", "", err
+	}
+	parsedGraphs, err := m.joint.ParseAll(ctx, predAmbLat)
+	if err != nil {
+		return "", "", "", err
 	}
-	predAmbLat := lattice.Lattice2SentenceCorpus(lAmb, app.EWord, app.EPOS, app.EWPOS, app.EMorphProp, app.EMHost, app.EMSuffix)
-	parsedGraphs := app.Parse(predAmbLat, beam)
 	graphAsConll := conll.MorphGraph2ConllCorpus(parsedGraphs)
 	buf1 := new(bytes.Buffer)
 	conll.Write(buf1, graphAsConll)
@@ -213,26 +133,27 @@ func JointParseAmbiguousLattices(input string) (string, string, string) {
 	buf3 := new(bytes.Buffer)
 	segmentation.Write(buf3, parsedGraphs)
 	segmentationMdOut := buf3.String()
-	jointLock.Unlock()
-	return conllDepOut, mappingMdOut, segmentationMdOut
+	return conllDepOut, mappingMdOut, segmentationMdOut, nil
 }
 
-func JointRawParseAmbiguousLattices(maLattice string) []nlp.MorphDependencyGraph {
-	jointLock.Lock()
-
-	reader := strings.NewReader(maLattice)
-	lAmb, lAmbE := lattice.Read(reader, 0)
-	if lAmbE != nil {
-		panic(fmt.Sprintf("Failed reading raw input - %v", lAmbE))
+func (m *Models) JointRawParseAmbiguousLattices(ctx context.Context, maLattice string) ([]nlp.MorphDependencyGraph, error) {
+	predAmbLat, err := m.joint.readLattices(maLattice)
+	if err != nil {
+		return nil, err
 	}
-	predAmbLat := lattice.Lattice2SentenceCorpus(lAmb, app.EWord, app.EPOS, app.EWPOS, app.EMorphProp, app.EMHost, app.EMSuffix)
+	return m.jointParseInstances(ctx, predAmbLat)
+}
 
-	parsed := make([]nlp.MorphDependencyGraph, len(predAmbLat))
-	for i, instance := range predAmbLat {
-		result, _ := beam.Parse(instance)
+// jointParseInstances parses lattice sentences read by readLattices
+func (m *Models) jointParseInstances(ctx context.Context, predAmbLat []interface{}) ([]nlp.MorphDependencyGraph, error) {
+	results, err := m.joint.ParseAll(ctx, predAmbLat)
+	if err != nil {
+		return nil, err
+	}
+	parsed := make([]nlp.MorphDependencyGraph, len(results))
+	for i, result := range results {
 		parsed[i] = result.(nlp.MorphDependencyGraph)
 	}
 
-	jointLock.Unlock()
-	return parsed
+	return parsed, nil
 }
@@ -0,0 +1,56 @@
+package webapi
+
+import (
+	"context"
+	"net/http"
+	"yap/alg/transition"
+	"yap/app"
+	nlp "yap/nlp/types"
+)
+
+// Analysis is one of the k best analyses of a sentence with its model score
+type Analysis struct {
+	Score float64 `json:"score"`
+	Nodes []Node  `json:"nodes"`
+}
+
+// kbestParam returns the number of analyses requested per sentence; more
+// than one is only supported with JSON output
+func kbestParam(req *http.Request, format string) (int, error) {
+	k, err := intParam(req, "kbest", 1)
+	if err != nil {
+		return 0, err
+	}
+	if k < 1 {
+		return 0, NewAPIError(http.StatusBadRequest, ERR_BAD_REQUEST, "kbest must be at least 1")
+	}
+	if k > 1 && format != FORMAT_JSON {
+		return 0, NewAPIError(http.StatusBadRequest, ERR_BAD_REQUEST, "kbest is only supported with %s output", FORMAT_JSON)
+	}
+	return k, nil
+}
+
+func graphNodes(c transition.Configuration) []Node {
+	return GraphToNodes(c.(nlp.MorphDependencyGraph))
+}
+
+func mdNodes(c transition.Configuration) []Node {
+	return TokensToNodes(MappingsToMorphemes(resultMappings(c)))
+}
+
+// kbestAnalyses parses the lattice sentences keeping up to k distinct
+// analyses of each, best first
+func kbestAnalyses(ctx context.Context, pool *ParserPool, instances []interface{}, k int, render app.Renderer, nodes func(transition.Configuration) []Node) ([][]Analysis, error) {
+	parsed, err := pool.ParseAllKBest(ctx, instances, k, render)
+	if err != nil {
+		return nil, err
+	}
+	output := make([][]Analysis, len(parsed))
+	for i, results := range parsed {
+		output[i] = make([]Analysis, len(results))
+		for j, result := range results {
+			output[i][j] = Analysis{result.Score, nodes(result.C)}
+		}
+	}
+	return output, nil
+}
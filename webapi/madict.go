@@ -0,0 +1,32 @@
+package webapi
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"yap/nlp/parser/ma"
+)
+
+// MADictInitialize loads the data-driven dictionary analyzer of a model set
+func MADictInitialize(m *Models) {
+	dictLocation := m.spec.MaDict
+	log.Println("Reading Morphological Analyzer Dictionary", dictLocation)
+	maData := new(ma.MADict)
+	if err := maData.ReadFile(dictLocation); err != nil {
+		panic(fmt.Sprintf("Failed reading MA dict file - %v", err))
+	}
+	log.Println("OOV POSs:", strings.Join(maData.TopPOS, ", "))
+	maData.ComputeOOVMSRs(m.spec.MaxMSRsPerPOS)
+	if len(m.spec.MaUDLex) > 0 {
+		udLexLocation := m.spec.MaUDLex
+		// the UD lexicon overrides the data-driven lexicon, the OOV MSRs remain
+		log.Println("Reading UD Lex file", udLexLocation)
+		if err := maData.ReadUDLexFile(udLexLocation); err != nil {
+			panic(fmt.Sprintf("Failed reading UD lex file - %v", err))
+		}
+	}
+	log.Println()
+	maData.Init()
+	maData.Dope = m.spec.Dope
+	m.dict = maData
+}
@@ -2,159 +2,185 @@ package webapi
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"github.com/gonuts/commander"
 	"log"
+	"net/http"
 	"strings"
-	"sync"
 	"yap/alg/search"
 	"yap/alg/transition"
 	transitionmodel "yap/alg/transition/model"
 	"yap/app"
+	"yap/nlp/format/constraints"
 	"yap/nlp/format/lattice"
 	"yap/nlp/format/mapping"
 	"yap/nlp/parser/disambig"
 	nlp "yap/nlp/types"
-	"yap/util"
 )
 
-var (
-	mdBeam *search.Beam
-	mdLock sync.Mutex
-)
-
-func MorphDisambiguatorInitialize(cmd *commander.Command, args []string) {
-	paramFunc, exists := nlp.MDParams[app.MdParamFuncName]
-	if !exists {
-		panic(fmt.Sprintf("MD param func %v doesn't exist", app.MdParamFuncName))
-	}
-	var (
-		mdTrans transition.TransitionSystem
-		model   *transitionmodel.AvgMatrixSparse = &transitionmodel.AvgMatrixSparse{}
-	)
-	mdTrans = &disambig.MDTrans{
-		ParamFunc: paramFunc,
-		UsePOP:    app.UsePOP,
-	}
-	disambig.UsePOP = app.UsePOP
-	transitionSystem := transition.TransitionSystem(mdTrans)
-	featuresLocation, found := util.LocateFile(app.MdFeaturesFile, app.DEFAULT_CONF_DIRS)
-	if !found {
-		panic(fmt.Sprintf("MD features not found"))
-	}
-	app.MdFeaturesFile = featuresLocation
-	modelLocation, found := util.LocateFile(app.MdModelName, app.DEFAULT_MODEL_DIRS)
-	if !found {
-		panic(fmt.Sprintf("MD model not found"))
-	}
-	app.MdModelName = modelLocation
-	confBeam := &search.Beam{}
-	app.MDConfigOut(modelLocation, confBeam, transitionSystem)
-	disambig.SwitchFormLemma = !lattice.IGNORE_LEMMA
-	app.SetupMDEnum()
-	mdTrans.(*disambig.MDTrans).POP = app.POP
-	mdTrans.(*disambig.MDTrans).Transitions = app.ETrans
-	mdTrans.AddDefaultOracle()
-	featureSetup, err := transition.LoadFeatureConfFile(featuresLocation)
+// MorphDisambiguatorInitialize loads the MD model of a model set and starts
+// its parser pool
+func MorphDisambiguatorInitialize(m *Models, settings *disambig.Settings, paramFunc nlp.MDParam) {
+	featureSetup, err := transition.LoadFeatureConfFile(m.spec.MdFeatures)
 	if err != nil {
-		panic(fmt.Sprintf("Failed reading MD feature configuration file [%v]: %v", featuresLocation, err))
+		panic(fmt.Sprintf("Failed reading MD feature configuration file [%v]: %v", m.spec.MdFeatures, err))
 	}
-	extractor := app.SetupExtractor(featureSetup, []byte("MPL"))
-	log.Println()
-	nlp.InitOpenParamFamily("HEBTB")
 	log.Println()
-	log.Println("Found MD model file", modelLocation, " ... loading model")
-
-	serialization := app.ReadModel(modelLocation)
-	model.Deserialize(serialization.WeightModel)
-	app.EWord = serialization.EWord
-	app.EPOS = serialization.EPOS
-	app.EWPOS = serialization.EWPOS
-	app.EMHost = serialization.EMHost
-	app.EMSuffix = serialization.EMSuffix
-	app.EMorphProp = serialization.EMorphProp
-	app.ETrans = serialization.ETrans
-	app.ETokens = serialization.ETokens
-
-	mdTrans = &disambig.MDTrans{
-		ParamFunc:   paramFunc,
-		UsePOP:      app.UsePOP,
-		POP:         app.POP,
-		Transitions: app.ETrans,
+	log.Println("Found MD model file", m.spec.MdModelName, " ... loading model")
+	model, e, err := readModel(m.spec.MdModelName, m.spec.modelSettings(app.MODEL_KIND_MD))
+	if err != nil {
+		panic(err.Error())
 	}
+	m.md = NewParserPool(m.poolName("md"), Workers, newMDBeam(model, e, featureSetup, paramFunc, settings), e)
+}
 
-	transitionSystem = transition.TransitionSystem(mdTrans)
-	extractor = app.SetupExtractor(featureSetup, []byte("MPL"))
+// newMDBeam builds the morphological disambiguator beam, with its
+// extractor and base configuration, on top of the loaded MD model weights
+func newMDBeam(model transitionmodel.Interface, e enums, features *transition.FeatureSetup, params nlp.MDParam, settings *disambig.Settings) *search.Beam {
+	pop := &transition.TypedTransition{T: 'P', V: e.transitionIndex("POP")}
+	mdTrans := &disambig.MDTrans{
+		ParamFunc:   params,
+		UsePOP:      settings.UsePOP,
+		POP:         pop,
+		Transitions: e.ETrans,
+	}
 
 	conf := &disambig.MDConfig{
-		ETokens:     app.ETokens,
-		POP:         app.POP,
-		Transitions: app.ETrans,
-		ParamFunc:   paramFunc,
+		ETokens:     e.ETokens,
+		POP:         pop,
+		Transitions: e.ETrans,
+		ParamFunc:   params,
+		Settings:    settings,
 	}
 
-	mdBeam = &search.Beam{
-		TransFunc:            transitionSystem,
-		FeatExtractor:        extractor,
+	mdBeam := &search.Beam{
+		TransFunc:            transition.TransitionSystem(mdTrans),
+		FeatExtractor:        e.extractor(features, []byte("MPL"), pop),
 		Base:                 conf,
 		Size:                 app.BeamSize,
 		ConcurrentExec:       app.ConcurrentBeam,
-		Transitions:          app.ETrans,
+		Transitions:          e.ETrans,
 		EstimatedTransitions: 1000, // chosen by random dice roll
 	}
 	mdBeam.ShortTempAgenda = true
 	mdBeam.Model = model
+	return mdBeam
 }
 
-func MorphDisambiguateLattices(input string) string {
-	mdLock.Lock()
-	log.Println("Reading ambiguous lattices")
-	log.Println("input:\n ", input)
+// readLattices reads lattice formatted input into instances of the pool's
+// parser
+func (p *ParserPool) readLattices(input string) (instances []interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			instances, err = nil, NewAPIError(http.StatusBadRequest, ERR_INVALID_INPUT, "failed converting lattices: %v", r)
+		}
+	}()
 	reader := strings.NewReader(input)
 	lAmb, lAmbE := lattice.Read(reader, 0)
 	if lAmbE != nil {
-		panic(fmt.Sprintf("Failed reading raw input - %v", lAmbE))
+		return nil, NewAPIError(http.StatusBadRequest, ERR_INVALID_INPUT, "failed reading lattices: %v", lAmbE)
 	}
-	predAmbLat := lattice.Lattice2SentenceCorpus(lAmb, app.EWord, app.EPOS, app.EWPOS, app.EMorphProp, app.EMHost, app.EMSuffix)
-	mappings := app.Parse(predAmbLat, mdBeam)
-	buf := new(bytes.Buffer)
-	mapping.Write(buf, mappings)
-	mdLock.Unlock()
-	return buf.String()
+	return lattice.Lattice2SentenceCorpus(lAmb, p.EWord, p.EPOS, p.EWPOS, p.EMorphProp, p.EMHost, p.EMSuffix), nil
 }
 
-func RawMorphDisambiguateLattices(input string) [][]nlp.EMorpheme {
-	mdLock.Lock()
+// readConstrainedLattices reads lattice formatted input into instances of
+// the pool's parser, constrained by the partial annotations of every
+// sentence
+func (p *ParserPool) readConstrainedLattices(input string, sents []constraints.Sentence) ([]interface{}, error) {
+	instances, err := p.readLattices(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(sents) > len(instances) {
+		return nil, NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "got constraints for %d sentences but only %d sentences", len(sents), len(instances))
+	}
+	for i, sent := range sents {
+		if len(sent) == 0 {
+			continue
+		}
+		if err := constraints.Apply(instances[i].(nlp.LatticeSentence), sent); err != nil {
+			return nil, NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "%v", err).AtSentence(i)
+		}
+	}
+	return instances, nil
+}
 
-	reader := strings.NewReader(input)
+func (m *Models) MorphDisambiguateLattices(ctx context.Context, input string) (string, error) {
+	log.Println("Reading ambiguous lattices")
+	log.Println("input:\n ", input)
+	predAmbLat, err := m.md.readLattices(input)
+	if err != nil {
+		return "", err
+	}
+	mappings, err := m.md.ParseAll(ctx, predAmbLat)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	mapping.Write(buf, mappings)
+	return buf.String(), nil
+}
 
-	lAmb, lAmbE := lattice.Read(reader, 0)
-	if lAmbE != nil {
-		panic(fmt.Sprintf("Failed reading raw input - %v", lAmbE))
+// RawMorphDisambiguateMappings returns the disambiguated token to morpheme
+// mappings of every sentence, without the root token
+func (m *Models) RawMorphDisambiguateMappings(ctx context.Context, input string) ([]nlp.Mappings, error) {
+	predAmbLat, err := m.md.readLattices(input)
+	if err != nil {
+		return nil, err
 	}
+	return m.mdParseInstances(ctx, predAmbLat)
+}
 
-	predAmbLat := lattice.Lattice2SentenceCorpus(lAmb, app.EWord, app.EPOS, app.EWPOS, app.EMorphProp, app.EMHost, app.EMSuffix)
+// mdParseInstances disambiguates lattice sentences read by readLattices
+func (m *Models) mdParseInstances(ctx context.Context, predAmbLat []interface{}) ([]nlp.Mappings, error) {
 	//mappings := app.Parse(predAmbLat, mdBeam)
 
-	parsed := make([][]nlp.EMorpheme, len(predAmbLat))
+	results, err := m.md.ParseAll(ctx, predAmbLat)
+	if err != nil {
+		return nil, err
+	}
+	parsed := make([]nlp.Mappings, len(results))
 
-	for i, instance := range predAmbLat {
-		result, _ := mdBeam.Parse(instance)
-		var row []nlp.EMorpheme
+	for i, result := range results {
+		parsed[i] = resultMappings(result)
+	}
 
-		for _, m := range result.(*disambig.MDConfig).Mappings {
-			if m.Token == nlp.ROOT_TOKEN {
-				continue
-			}
+	return parsed, nil
+}
 
-			for _, morph := range m.Spellout {
-				row = append(row, *morph)
-			}
+// resultMappings returns the mappings of a disambiguated configuration
+// without the root token
+func resultMappings(result interface{}) nlp.Mappings {
+	var row nlp.Mappings
+	for _, m := range result.(*disambig.MDConfig).Mappings {
+		if m.Token == nlp.ROOT_TOKEN {
+			continue
 		}
+		row = append(row, m)
+	}
+	return row
+}
 
-		parsed[i] = row
+func (m *Models) RawMorphDisambiguateLattices(ctx context.Context, input string) ([][]nlp.EMorpheme, error) {
+	mappings, err := m.RawMorphDisambiguateMappings(ctx, input)
+	if err != nil {
+		return nil, err
 	}
+	parsed := make([][]nlp.EMorpheme, len(mappings))
 
-	mdLock.Unlock()
-	return parsed
+	for i, sent := range mappings {
+		parsed[i] = MappingsToMorphemes(sent)
+	}
+
+	return parsed, nil
+}
+
+func MappingsToMorphemes(mappings nlp.Mappings) []nlp.EMorpheme {
+	var row []nlp.EMorpheme
+	for _, m := range mappings {
+		for _, morph := range m.Spellout {
+			row = append(row, *morph)
+		}
+	}
+	return row
 }
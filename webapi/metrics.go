@@ -0,0 +1,271 @@
+package webapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const METRICS_CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// histogram buckets in seconds
+	LATENCY_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+	WAIT_BUCKETS    = []float64{0.0001, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30}
+
+	requestsTotal   = newCounter("yap_http_requests_total", "Number of HTTP requests by endpoint, method and status code", "endpoint", "method", "code")
+	requestDuration = newHistogram("yap_http_request_duration_seconds", "HTTP request latency by endpoint", LATENCY_BUCKETS, "endpoint")
+	sentencesTotal  = newCounter("yap_sentences_total", "Number of sentences analyzed")
+	tokensTotal     = newCounter("yap_tokens_total", "Number of tokens analyzed")
+	oovTokensTotal  = newCounter("yap_oov_tokens_total", "Number of analyzed tokens not found in the lexicon")
+	beamDuration    = newHistogram("yap_beam_duration_seconds", "Beam search time per sentence by parser pool", LATENCY_BUCKETS, "pool")
+	queueWait       = newHistogram("yap_parser_queue_wait_seconds", "Time spent waiting for a free search slot by parser pool", WAIT_BUCKETS, "pool")
+	searchTimeouts  = newCounter("yap_search_timeouts_total", "Number of beam searches exceeding -parse_timeout by parser pool and outcome (greedy or aborted)", "pool", "outcome")
+
+	metrics = []metric{requestsTotal, requestDuration, sentencesTotal, tokensTotal, oovTokensTotal, beamDuration, queueWait, searchTimeouts}
+)
+
+type metric interface {
+	write(buf *bytes.Buffer)
+}
+
+// metricFamily holds the series of a metric keyed by their label values
+type metricFamily struct {
+	sync.Mutex
+	name, help, kind string
+	labels           []string
+}
+
+func labelString(names, values []string, extra ...string) string {
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, strconv.Quote(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", extra[i], strconv.Quote(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (m *metricFamily) header(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+}
+
+func (m *metricFamily) key(values []string) string {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("Metric %s expects %d labels, got %d", m.name, len(m.labels), len(values)))
+	}
+	return strings.Join(values, "\x00")
+}
+
+func sortedKeys(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
+
+type counter struct {
+	metricFamily
+	values map[string]float64
+}
+
+func newCounter(name, help string, labels ...string) *counter {
+	return &counter{metricFamily{name: name, help: help, kind: "counter", labels: labels}, make(map[string]float64)}
+}
+
+func (c *counter) Add(value float64, labels ...string) {
+	key := c.key(labels)
+	c.Lock()
+	defer c.Unlock()
+	c.values[key] += value
+}
+
+func (c *counter) Value(labels ...string) float64 {
+	key := c.key(labels)
+	c.Lock()
+	defer c.Unlock()
+	return c.values[key]
+}
+
+func (c *counter) write(buf *bytes.Buffer) {
+	c.Lock()
+	defer c.Unlock()
+	c.header(buf)
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(buf, "%s 0\n", c.name)
+	}
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	for _, key := range sortedKeys(keys) {
+		fmt.Fprintf(buf, "%s%s %v\n", c.name, labelString(c.labels, strings.Split(key, "\x00")), c.values[key])
+	}
+}
+
+type histogramSeries struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type histogram struct {
+	metricFamily
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *histogram {
+	return &histogram{metricFamily{name: name, help: help, kind: "histogram", labels: labels}, buckets, make(map[string]*histogramSeries)}
+}
+
+func (h *histogram) Observe(value float64, labels ...string) {
+	key := h.key(labels)
+	h.Lock()
+	defer h.Unlock()
+	series, exists := h.series[key]
+	if !exists {
+		series = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+func (h *histogram) ObserveDuration(d time.Duration, labels ...string) {
+	h.Observe(d.Seconds(), labels...)
+}
+
+func (h *histogram) write(buf *bytes.Buffer) {
+	h.Lock()
+	defer h.Unlock()
+	h.header(buf)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	for _, key := range sortedKeys(keys) {
+		values := strings.Split(key, "\x00")
+		if len(h.labels) == 0 {
+			values = nil
+		}
+		series := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", h.name, labelString(h.labels, values, "le", strconv.FormatFloat(bound, 'g', -1, 64)), series.counts[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", h.name, labelString(h.labels, values, "le", "+Inf"), series.count)
+		fmt.Fprintf(buf, "%s_sum%s %v\n", h.name, labelString(h.labels, values), series.sum)
+		fmt.Fprintf(buf, "%s_count%s %d\n", h.name, labelString(h.labels, values), series.count)
+	}
+}
+
+// recordAnalysis counts an analyzed sentence and its (OOV) tokens
+func recordAnalysis(tokens, oov int) {
+	sentencesTotal.Add(1)
+	tokensTotal.Add(float64(tokens))
+	oovTokensTotal.Add(float64(oov))
+}
+
+func MetricsHandler(resp http.ResponseWriter, req *http.Request) {
+	buf := new(bytes.Buffer)
+	for _, m := range metrics {
+		m.write(buf)
+	}
+	// convenience ratio of the OOV and token counters
+	var oovRate float64
+	if tokens := tokensTotal.Value(); tokens > 0 {
+		oovRate = oovTokensTotal.Value() / tokens
+	}
+	fmt.Fprintf(buf, "# HELP yap_oov_rate Fraction of analyzed tokens not found in the lexicon\n# TYPE yap_oov_rate gauge\nyap_oov_rate %v\n", oovRate)
+	resp.Header().Set("Content-Type", METRICS_CONTENT_TYPE)
+	resp.WriteHeader(http.StatusOK)
+	resp.Write(buf.Bytes())
+}
+
+var errNotSupported = errors.New("not supported by the underlying response writer")
+
+// statusRecorder captures the response status while passing through the
+// optional interfaces streaming responses rely on
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) EnableFullDuplex() error {
+	if fd, ok := r.ResponseWriter.(interface{ EnableFullDuplex() error }); ok {
+		return fd.EnableFullDuplex()
+	}
+	return errNotSupported
+}
+
+func (r *statusRecorder) SetReadDeadline(deadline time.Time) error {
+	if conn, ok := r.ResponseWriter.(duplexConn); ok {
+		return conn.SetReadDeadline(deadline)
+	}
+	return errNotSupported
+}
+
+func (r *statusRecorder) SetWriteDeadline(deadline time.Time) error {
+	if conn, ok := r.ResponseWriter.(duplexConn); ok {
+		return conn.SetWriteDeadline(deadline)
+	}
+	return errNotSupported
+}
+
+// metricsMiddleware counts requests and their latency by route template,
+// so that path parameters such as job ids do not create new series
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil {
+				endpoint = tpl
+			}
+		}
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			status := recorder.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			requestsTotal.Add(1, endpoint, r.Method, strconv.Itoa(status))
+			requestDuration.ObserveDuration(time.Since(start), endpoint)
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
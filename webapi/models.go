@@ -0,0 +1,221 @@
+package webapi
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"yap/alg/transition"
+	transitionmodel "yap/alg/transition/model"
+	"yap/app"
+	"yap/nlp/format/lattice"
+	"yap/nlp/parser/disambig"
+	"yap/nlp/parser/ma"
+	nlp "yap/nlp/types"
+	"yap/util"
+)
+
+// Models is a loaded model set: the analyzer and the parser pools. A
+// request holds the set that is current when it starts throughout, so
+// swapping in a new set never changes the models under a request in flight;
+// a replaced set is closed once the last request holding it is done.
+type Models struct {
+	spec PipelineSpec
+
+	// one of the analyzers is set, as selected by the spec
+	lexicon *ma.BGULex
+	dict    *ma.MADict
+
+	md    *ParserPool
+	dep   *ParserPool
+	joint *ParserPool
+
+	info *Info
+
+	lock     sync.Mutex
+	holders  int
+	replaced bool
+	drained  chan struct{}
+}
+
+// enums are the enumerations a model was trained with; lattices are read
+// into instances of the model with its own enumerations
+type enums struct {
+	EWord, EPOS, EWPOS *util.EnumSet
+	EMHost, EMSuffix   *util.EnumSet
+	EMorphProp         *util.EnumSet
+	ETrans, ETokens    *util.EnumSet
+	ERel               *util.EnumSet
+}
+
+// readModel reads a model file and checks that it was trained with the
+// given settings
+func readModel(file string, settings app.ModelSettings) (transitionmodel.Interface, enums, error) {
+	weights, serialization, header, err := app.LoadModel(file)
+	if err != nil {
+		return nil, enums{}, err
+	}
+	if err := header.Check(settings); err != nil {
+		return nil, enums{}, fmt.Errorf("Model %v: %v", file, err)
+	}
+	return weights, enums{
+		EWord:      serialization.EWord,
+		EPOS:       serialization.EPOS,
+		EWPOS:      serialization.EWPOS,
+		EMHost:     serialization.EMHost,
+		EMSuffix:   serialization.EMSuffix,
+		EMorphProp: serialization.EMorphProp,
+		ETrans:     serialization.ETrans,
+		ETokens:    serialization.ETokens,
+	}, nil
+}
+
+// transitionIndex returns the index of a transition in the model's
+// transition enumeration
+func (e enums) transitionIndex(name string) int {
+	index, exists := e.ETrans.IndexOf(name)
+	if !exists {
+		panic(fmt.Sprintf("Model has no %s transition", name))
+	}
+	return index
+}
+
+// extractor returns a feature extractor reading the enumerations of e
+func (e enums) extractor(setup *transition.FeatureSetup, transTypes []byte, pop transition.Transition) *transition.GenericExtractor {
+	extractor := &transition.GenericExtractor{
+		EFeatures:  util.NewEnumSet(setup.NumFeatures()),
+		EWord:      e.EWord,
+		EPOS:       e.EPOS,
+		EWPOS:      e.EWPOS,
+		ERel:       e.ERel,
+		EMHost:     e.EMHost,
+		EMSuffix:   e.EMSuffix,
+		EMorphProp: e.EMorphProp,
+		EToken:     e.ETokens,
+		POPTrans:   pop,
+	}
+	extractor.InitTypes(transTypes)
+	extractor.LoadFeatureSetup(setup)
+	return extractor
+}
+
+// CurrentModels returns the model set of the default pipeline, nil while
+// its models are loading
+func CurrentModels() *Models {
+	return PipelineModels(PipelineName)
+}
+
+// setModels swaps in the model set of its pipeline and returns the set it
+// replaced, nil on the first load
+func setModels(m *Models) *Models {
+	old := pipelines[m.spec.Name].Models()
+	pipelines[m.spec.Name].models.Store(m)
+	return old
+}
+
+// poolName names the parser pools of a pipeline; those of the default
+// pipeline keep their plain names
+func (m *Models) poolName(kind string) string {
+	if m.spec.Name == PipelineName {
+		return kind
+	}
+	return m.spec.Name + "." + kind
+}
+
+// locateFile returns name if it exists as given, otherwise looks it up in
+// dirs next to the executable
+func locateFile(name string, dirs []string) (string, bool) {
+	if app.VerifyExists(name) {
+		return name, true
+	}
+	return util.LocateFile(name, dirs)
+}
+
+// LoadModels loads the models of a pipeline and starts their parser pools.
+// Every pipeline is built from its own spec and models; loading only reads
+// the command line flags of the app package, so the models of one pipeline
+// can be loaded while others serve.
+func LoadModels(spec PipelineSpec) (m *Models, err error) {
+	log.Println("Loading pipeline", spec.Name)
+	if spec, err = spec.located(); err != nil {
+		return nil, err
+	}
+	paramFunc, exists := nlp.ParamFuncWithTypes(spec.MdParamFunc, nlp.OpenParamFamilyTypes(spec.ParamFamily))
+	if !exists {
+		return nil, fmt.Errorf("MD param func %v doesn't exist", spec.MdParamFunc)
+	}
+	settings := &disambig.Settings{
+		UsePOP:          app.UsePOP,
+		SwitchFormLemma: !lattice.IGNORE_LEMMA,
+		Lemmas:          !lattice.IGNORE_LEMMA,
+	}
+	m = &Models{spec: spec, drained: make(chan struct{})}
+	defer func() {
+		if r := recover(); r != nil {
+			m.close()
+			m, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	if spec.Analyzer == ANALYZER_MADICT {
+		MADictInitialize(m)
+	} else {
+		HebrewMorphAnalyazerInitialize(m)
+	}
+	MorphDisambiguatorInitialize(m, settings, paramFunc)
+	if !spec.TagOnly {
+		DepParserInitialize(m)
+		JointParserInitialize(m, settings, paramFunc)
+	}
+	InfoInitialize(m)
+	log.Println()
+	return m, nil
+}
+
+// hold counts a holder of the set; false once the set was replaced
+func (m *Models) hold() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.replaced {
+		return false
+	}
+	m.holders++
+	return true
+}
+
+// release lets go of a set returned by selectModels
+func (m *Models) release() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.holders--
+	if m.replaced && m.holders == 0 {
+		close(m.drained)
+	}
+}
+
+// retire marks a replaced set; the returned channel is closed once the
+// last holder of the set lets go of it
+func (m *Models) retire() <-chan struct{} {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.replaced {
+		m.replaced = true
+		if m.holders == 0 {
+			close(m.drained)
+		}
+	}
+	return m.drained
+}
+
+// close releases the weights of the compiled models of a set no request
+// holds
+func (m *Models) close() error {
+	var err error
+	for _, pool := range []*ParserPool{m.md, m.dep, m.joint} {
+		if pool == nil {
+			continue
+		}
+		if closeErr := pool.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,315 @@
+package webapi
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"yap/app"
+	nlp "yap/nlp/types"
+)
+
+// analyzers of a pipeline
+const (
+	ANALYZER_BGULEX = "bgulex"
+	ANALYZER_MADICT = "madict"
+
+	DEFAULT_MAX_MSRS_PER_POS = 10
+)
+
+var (
+	// PipelineName names the pipeline configured by the command line flags
+	PipelineName string
+	// PipelinesFile lists more pipelines to serve
+	PipelinesFile string
+
+	pipelines     map[string]*pipeline
+	pipelineNames []string
+)
+
+// PipelineSpec configures a pipeline: an analyzer and the models parsing
+// its output. Unset fields of a pipelines file entry take the values of the
+// command line flags.
+type PipelineSpec struct {
+	Name string `yaml:"name" json:"name"`
+	// bgulex (the Hebrew BGU lexicon) or madict (a data-driven dictionary)
+	Analyzer  string `yaml:"analyzer" json:"analyzer"`
+	MaPrefix  string `yaml:"ma_prefix" json:"ma_prefix,omitempty"`
+	MaLexicon string `yaml:"ma_lexicon" json:"ma_lexicon,omitempty"`
+	MaDict    string `yaml:"ma_dict" json:"ma_dict,omitempty"`
+	MaUDLex   string `yaml:"ma_udlex" json:"ma_udlex,omitempty"`
+	// OOV analyses of the madict analyzer
+	MaxMSRsPerPOS int  `yaml:"max_msrs_per_pos" json:"max_msrs_per_pos,omitempty"`
+	Dope          bool `yaml:"dope" json:"dope,omitempty"`
+	// open class POS family of the MD param func, HEBTB or UD
+	ParamFamily    string `yaml:"param_family" json:"param_family"`
+	MdParamFunc    string `yaml:"md_param_func" json:"md_param_func"`
+	MdModelName    string `yaml:"md_model_name" json:"md_model_name"`
+	MdFeatures     string `yaml:"md_features" json:"md_features"`
+	DepModelName   string `yaml:"dep_model_name" json:"dep_model_name,omitempty"`
+	DepFeatures    string `yaml:"dep_features" json:"dep_features,omitempty"`
+	DepLabels      string `yaml:"dep_labels" json:"dep_labels,omitempty"`
+	JointModelName string `yaml:"joint_model_name" json:"joint_model_name,omitempty"`
+	JointFeatures  string `yaml:"joint_features" json:"joint_features,omitempty"`
+	TagOnly        bool   `yaml:"tagonly" json:"tagonly"`
+	// tokens of a sentence a reloaded model set must parse before it's
+	// served; no check if empty
+	Validation []string `yaml:"validation" json:"validation,omitempty"`
+}
+
+// flagsSpec returns the pipeline configured by the command line flags
+func flagsSpec() PipelineSpec {
+	return PipelineSpec{
+		Name:           PipelineName,
+		Analyzer:       ANALYZER_BGULEX,
+		MaPrefix:       app.HebMaPrefixFile,
+		MaLexicon:      app.HebMaLexiconFile,
+		ParamFamily:    "HEBTB",
+		MdParamFunc:    app.MdParamFuncName,
+		MdModelName:    app.MdModelName,
+		MdFeatures:     app.MdFeaturesFile,
+		DepModelName:   app.DepModelName,
+		DepFeatures:    app.DepFeaturesFile,
+		DepLabels:      app.DepLabelsFile,
+		JointModelName: app.JointModelFile,
+		JointFeatures:  app.JointFeaturesFile,
+		TagOnly:        TagOnly,
+		Validation:     []string{"גנן", "גידל", "דגן", "בגן", "."},
+	}
+}
+
+// inherit sets the unset fields of s to those of defaults
+func (s *PipelineSpec) inherit(defaults PipelineSpec) {
+	fields := []struct{ value, defaultValue *string }{
+		{&s.Analyzer, &defaults.Analyzer},
+		{&s.MaPrefix, &defaults.MaPrefix},
+		{&s.MaLexicon, &defaults.MaLexicon},
+		{&s.ParamFamily, &defaults.ParamFamily},
+		{&s.MdParamFunc, &defaults.MdParamFunc},
+		{&s.MdModelName, &defaults.MdModelName},
+		{&s.MdFeatures, &defaults.MdFeatures},
+		{&s.DepModelName, &defaults.DepModelName},
+		{&s.DepFeatures, &defaults.DepFeatures},
+		{&s.DepLabels, &defaults.DepLabels},
+		{&s.JointModelName, &defaults.JointModelName},
+		{&s.JointFeatures, &defaults.JointFeatures},
+	}
+	for _, field := range fields {
+		if len(*field.value) == 0 {
+			*field.value = *field.defaultValue
+		}
+	}
+	// the default sentence is analyzed by the Hebrew lexicon only
+	if s.Validation == nil && s.Analyzer == ANALYZER_BGULEX && defaults.Analyzer == ANALYZER_BGULEX {
+		s.Validation = defaults.Validation
+	}
+	if s.MaxMSRsPerPOS == 0 {
+		s.MaxMSRsPerPOS = DEFAULT_MAX_MSRS_PER_POS
+	}
+}
+
+func (s PipelineSpec) validate() error {
+	if len(s.Name) == 0 || strings.ContainsAny(s.Name, " \t\r\n/?&") {
+		return fmt.Errorf("invalid pipeline name %q", s.Name)
+	}
+	switch s.Analyzer {
+	case ANALYZER_BGULEX:
+	case ANALYZER_MADICT:
+		if len(s.MaDict) == 0 {
+			return fmt.Errorf("pipeline %s: analyzer %s requires ma_dict", s.Name, s.Analyzer)
+		}
+	default:
+		return fmt.Errorf("pipeline %s: unknown analyzer %q, expected %s or %s", s.Name, s.Analyzer, ANALYZER_BGULEX, ANALYZER_MADICT)
+	}
+	if s.ParamFamily != "HEBTB" && s.ParamFamily != "UD" {
+		return fmt.Errorf("pipeline %s: unknown param family %q, expected HEBTB or UD", s.Name, s.ParamFamily)
+	}
+	if _, exists := nlp.MDParams[s.MdParamFunc]; !exists {
+		return fmt.Errorf("pipeline %s: MD param func %v doesn't exist", s.Name, s.MdParamFunc)
+	}
+	return nil
+}
+
+// located returns the spec with its files looked up in the default
+// directories
+func (s PipelineSpec) located() (PipelineSpec, error) {
+	type location struct {
+		name *string
+		dirs []string
+	}
+	var files []location
+	if s.Analyzer == ANALYZER_BGULEX {
+		files = append(files,
+			location{&s.MaPrefix, app.HEB_MA_DEFAULT_DATA_DIRS},
+			location{&s.MaLexicon, app.HEB_MA_DEFAULT_DATA_DIRS})
+	} else {
+		files = append(files, location{&s.MaDict, app.DEFAULT_MODEL_DIRS})
+		if len(s.MaUDLex) > 0 {
+			files = append(files, location{&s.MaUDLex, app.DEFAULT_MODEL_DIRS})
+		}
+	}
+	files = append(files,
+		location{&s.MdModelName, app.DEFAULT_MODEL_DIRS},
+		location{&s.MdFeatures, app.DEFAULT_CONF_DIRS})
+	if !s.TagOnly {
+		files = append(files,
+			location{&s.DepModelName, app.DEFAULT_MODEL_DIRS},
+			location{&s.DepFeatures, app.DEFAULT_CONF_DIRS},
+			location{&s.DepLabels, app.DEFAULT_CONF_DIRS},
+			location{&s.JointModelName, app.DEFAULT_MODEL_DIRS},
+			location{&s.JointFeatures, app.DEFAULT_CONF_DIRS})
+	}
+	for _, file := range files {
+		found, exists := locateFile(*file.name, file.dirs)
+		if !exists {
+			return s, fmt.Errorf("file not found: %v", *file.name)
+		}
+		*file.name = found
+	}
+	return s, nil
+}
+
+// modelSettings returns the settings a model of the spec must have been
+// trained with
+func (s PipelineSpec) modelSettings(kind string) app.ModelSettings {
+	settings := app.ModelSettings{
+		Kind:          kind,
+		MdParamFunc:   s.MdParamFunc,
+		JointStrategy: app.JointStrategy,
+		UsePOP:        app.UsePOP,
+	}
+	switch kind {
+	case app.MODEL_KIND_MD:
+		settings.FeaturesFile = s.MdFeatures
+	case app.MODEL_KIND_DEP:
+		settings.FeaturesFile = s.DepFeatures
+		settings.LabelsFile = s.DepLabels
+	case app.MODEL_KIND_JOINT:
+		settings.FeaturesFile = s.JointFeatures
+		settings.LabelsFile = s.DepLabels
+	}
+	return settings
+}
+
+// ReadPipelineSpecs returns the pipeline of the command line flags followed
+// by those of PipelinesFile, if set
+func ReadPipelineSpecs() ([]PipelineSpec, error) {
+	defaults := flagsSpec()
+	specs := []PipelineSpec{defaults}
+	if len(PipelinesFile) > 0 {
+		content, err := ioutil.ReadFile(PipelinesFile)
+		if err != nil {
+			return nil, err
+		}
+		var fileSpecs []PipelineSpec
+		if err := yaml.UnmarshalStrict(content, &fileSpecs); err != nil {
+			return nil, fmt.Errorf("failed reading %s: %v", PipelinesFile, err)
+		}
+		for _, spec := range fileSpecs {
+			spec.inherit(defaults)
+			specs = append(specs, spec)
+		}
+	}
+	names := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if err := spec.validate(); err != nil {
+			return nil, err
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("more than one pipeline named %s", spec.Name)
+		}
+		names[spec.Name] = true
+	}
+	return specs, nil
+}
+
+// pipeline serves the current model set of a spec
+type pipeline struct {
+	models atomic.Value
+}
+
+func (p *pipeline) Models() *Models {
+	m, _ := p.models.Load().(*Models)
+	return m
+}
+
+// PipelinesInitialize registers the pipelines to serve; their models are
+// loaded by LoadPipelines
+func PipelinesInitialize(specs []PipelineSpec) {
+	pipelines = make(map[string]*pipeline, len(specs))
+	pipelineNames = make([]string, len(specs))
+	for i, spec := range specs {
+		pipelines[spec.Name] = new(pipeline)
+		pipelineNames[i] = spec.Name
+	}
+}
+
+// LoadPipelines loads the models of every pipeline in turn
+func LoadPipelines(specs []PipelineSpec) error {
+	for _, spec := range specs {
+		m, err := LoadModels(spec)
+		if err != nil {
+			return fmt.Errorf("pipeline %s: %v", spec.Name, err)
+		}
+		setModels(m)
+	}
+	return nil
+}
+
+// PipelineModels returns the current model set of a pipeline; nil if the
+// pipeline doesn't exist or is still loading
+func PipelineModels(name string) *Models {
+	p, exists := pipelines[name]
+	if !exists {
+		return nil
+	}
+	return p.Models()
+}
+
+// selectModels holds the model set of the named pipeline, of the default
+// pipeline if name is empty; the caller releases it when done
+func selectModels(name string) (*Models, error) {
+	if len(name) == 0 {
+		name = PipelineName
+	}
+	if _, exists := pipelines[name]; !exists {
+		return nil, NewAPIError(http.StatusNotFound, ERR_NOT_FOUND, "no pipeline %q", name)
+	}
+	for {
+		m := PipelineModels(name)
+		if m == nil {
+			return nil, NewAPIError(http.StatusServiceUnavailable, ERR_UNAVAILABLE, "models are loading")
+		}
+		// a set replaced since it was loaded is no longer current
+		if m.hold() {
+			return m, nil
+		}
+	}
+}
+
+// requestModels holds the model set of the pipeline named by the pipeline
+// query parameter
+func requestModels(req *http.Request) (*Models, error) {
+	return selectModels(req.URL.Query().Get("pipeline"))
+}
+
+// parses returns an error unless the pipeline of a model set parses
+func (m *Models) parses() error {
+	if m.spec.TagOnly {
+		return NewAPIError(http.StatusBadRequest, ERR_BAD_REQUEST, "pipeline %s is tag only", m.spec.Name)
+	}
+	return nil
+}
+
+// anyParses reports whether any pipeline parses, so that the parse
+// endpoints are served
+func anyParses(specs []PipelineSpec) bool {
+	for _, spec := range specs {
+		if !spec.TagOnly {
+			return true
+		}
+	}
+	return false
+}
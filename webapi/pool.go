@@ -0,0 +1,252 @@
+package webapi
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+	"yap/alg/search"
+	"yap/app"
+	nlp "yap/nlp/types"
+)
+
+var (
+	// number of concurrent searches per pool; 0 = one per CPU
+	Workers int
+	// beam search time budget per sentence in milliseconds; 0 = none
+	ParseTimeout int
+	// finish a sentence exceeding ParseTimeout greedily instead of failing it
+	ParseTimeoutGreedy bool
+)
+
+// ParserPool bounds the number of concurrent searches with the beam of a
+// loaded model. The beam keeps the state of every search apart, so all
+// searches share it; slots is a semaphore holding one token per search.
+// The input of the pool is read with the enumerations of its model.
+type ParserPool struct {
+	enums
+	Name  string
+	beam  *search.Beam
+	slots chan struct{}
+	size  int
+}
+
+func NewParserPool(name string, size int, beam *search.Beam, e enums) *ParserPool {
+	if size < 1 {
+		size = 1
+	}
+	pool := &ParserPool{
+		enums: e,
+		Name:  name,
+		beam:  beam,
+		slots: make(chan struct{}, size),
+		size:  size,
+	}
+	if ParseTimeoutGreedy {
+		pool.beam.Expiry = search.EXPIRY_GREEDY
+	}
+	log.Println("Started", name, "parser pool of", size, "concurrent searches")
+	return pool
+}
+
+// acquire blocks until a search slot is free or ctx is done
+func (p *ParserPool) acquire(ctx context.Context) error {
+	start := time.Now()
+	defer func() {
+		queueWait.ObserveDuration(time.Since(start), p.Name)
+	}()
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return contextError(ctx)
+	}
+}
+
+// close releases the weights of a compiled model; the pool's model set
+// must have no holders left
+func (p *ParserPool) close() error {
+	if closer, ok := p.beam.Model.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (p *ParserPool) release() {
+	<-p.slots
+}
+
+func (p *ParserPool) Size() int {
+	return p.size
+}
+
+// Parse parses a single instance once a search slot is free. The search is
+// bounded by ctx, the context of the request, and by ParseTimeout; a panic
+// raised during the search is recovered and returned as a parse_failed
+// error, and a parse that broke a constraint of the input as an
+// invalid_input error.
+func (p *ParserPool) Parse(ctx context.Context, instance interface{}) (result interface{}, err error) {
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer p.release()
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, recoveredError(ERR_PARSE, r)
+		}
+	}()
+	searchCtx, cancel := parseContext(ctx)
+	defer cancel()
+	start := time.Now()
+	result, _, outcome, err := p.beam.ParseContext(searchCtx, instance)
+	beamDuration.ObserveDuration(time.Since(start), p.Name)
+	if err := p.timedOut(ctx, outcome, err); err != nil {
+		return nil, err
+	}
+	if unconstrained(result) {
+		return nil, errUnconstrained()
+	}
+	return result, nil
+}
+
+// ParseKBest parses a single instance as Parse does, keeping up to k
+// analyses that render differently; analyses that broke a constraint of the
+// input are dropped
+func (p *ParserPool) ParseKBest(ctx context.Context, instance interface{}, k int, render app.Renderer) (results []search.ScoredResult, err error) {
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer p.release()
+	defer func() {
+		if r := recover(); r != nil {
+			results, err = nil, recoveredError(ERR_PARSE, r)
+		}
+	}()
+	searchCtx, cancel := parseContext(ctx)
+	defer cancel()
+	start := time.Now()
+	results, outcome, err := p.beam.ParseKBestContext(searchCtx, instance, k, render)
+	beamDuration.ObserveDuration(time.Since(start), p.Name)
+	if err := p.timedOut(ctx, outcome, err); err != nil {
+		return nil, err
+	}
+	constrained := results[:0]
+	for _, result := range results {
+		if !unconstrained(result.C) {
+			constrained = append(constrained, result)
+		}
+	}
+	if len(results) > 0 && len(constrained) == 0 {
+		return nil, errUnconstrained()
+	}
+	return constrained, nil
+}
+
+// unconstrained reports whether a parse broke a constraint of its input
+func unconstrained(result interface{}) bool {
+	c, ok := result.(nlp.Constrained)
+	return ok && c.Unconstrained()
+}
+
+func errUnconstrained() error {
+	return NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "the parser can't keep the constraints of the sentence")
+}
+
+// parseContext returns the context bounding the search of a sentence of a
+// request with context ctx
+func parseContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ParseTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(ParseTimeout)*time.Millisecond)
+}
+
+// contextError is the error of a request whose context is done: its
+// deadline passed or its caller went away
+func contextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return NewAPIError(http.StatusServiceUnavailable, ERR_TIMEOUT, "parsing exceeded the deadline of the request")
+	}
+	return NewAPIError(http.StatusServiceUnavailable, ERR_CANCELED, "request canceled")
+}
+
+// timedOut counts searches that exceeded the time budget and returns the
+// error of an aborted one; ctx is the context of the request, whose own
+// deadline or cancelation isn't counted
+func (p *ParserPool) timedOut(ctx context.Context, outcome search.Outcome, err error) error {
+	if outcome == search.OUTCOME_COMPLETE {
+		return nil
+	}
+	if ctx.Err() != nil {
+		if err != nil {
+			return contextError(ctx)
+		}
+		return nil
+	}
+	searchTimeouts.Add(1, p.Name, outcome.String())
+	if err != nil {
+		return NewAPIError(http.StatusServiceUnavailable, ERR_TIMEOUT, "parsing exceeded %dms", ParseTimeout)
+	}
+	return nil
+}
+
+// parallel runs parse for every instance index on up to workers
+// goroutines; the error reports the first failing sentence
+func parallel(n, workers int, parse func(i int) error) error {
+	if workers > n {
+		workers = n
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	indices := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				errs[i] = parse(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return AsAPIError(err).AtSentence(i)
+		}
+	}
+	return nil
+}
+
+// ParseAll parses the instances concurrently, up to the pool size at a
+// time, and returns the results in input order; the error reports the first
+// failing sentence
+func (p *ParserPool) ParseAll(ctx context.Context, instances []interface{}) ([]interface{}, error) {
+	parsed := make([]interface{}, len(instances))
+	err := parallel(len(instances), p.size, func(i int) (err error) {
+		parsed[i], err = p.Parse(ctx, instances[i])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// ParseAllKBest is ParseAll keeping up to k distinct analyses per instance
+func (p *ParserPool) ParseAllKBest(ctx context.Context, instances []interface{}, k int, render app.Renderer) ([][]search.ScoredResult, error) {
+	parsed := make([][]search.ScoredResult, len(instances))
+	err := parallel(len(instances), p.size, func(i int) (err error) {
+		parsed[i], err = p.ParseKBest(ctx, instances[i], k, render)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
@@ -0,0 +1,39 @@
+package webapi
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParallel(t *testing.T) {
+	const n, workers = 50, 3
+	var running, most int32
+	err := parallel(n, workers, func(i int) error {
+		cur := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			prev := atomic.LoadInt32(&most)
+			if cur <= prev || atomic.CompareAndSwapInt32(&most, prev, cur) {
+				break
+			}
+		}
+		if i == 17 || i == 42 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if most > workers {
+		t.Errorf("ran %d sentences at once, want at most %d", most, workers)
+	}
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("got error %v, want an APIError", err)
+	}
+	if apiErr.Sentence == nil || *apiErr.Sentence != 17 {
+		t.Errorf("got error %v, want it at sentence 17", apiErr)
+	}
+	if err := parallel(2, workers, func(int) error { return nil }); err != nil {
+		t.Errorf("got error %v", err)
+	}
+}
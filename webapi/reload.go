@@ -0,0 +1,211 @@
+package webapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	nlp "yap/nlp/types"
+)
+
+// reload states
+const (
+	RELOAD_IDLE    = "idle"
+	RELOAD_LOADING = "loading"
+	RELOAD_DONE    = "done"
+	RELOAD_FAILED  = "failed"
+)
+
+// ReloadRequest replaces model files of a pipeline on reload; empty fields
+// reload the current files of the default pipeline
+type ReloadRequest struct {
+	Pipeline       string `json:"pipeline,omitempty"`
+	MdModelName    string `json:"md_model_name,omitempty"`
+	JointModelName string `json:"joint_model_name,omitempty"`
+	Lexicon        string `json:"ma_lexicon,omitempty"`
+}
+
+// ReloadStatus reports the last reload
+type ReloadStatus struct {
+	State     string     `json:"state"`
+	Pipelines []string   `json:"pipelines,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+}
+
+type reloader struct {
+	sync.Mutex
+	status ReloadStatus
+}
+
+var reloads = &reloader{status: ReloadStatus{State: RELOAD_IDLE}}
+
+func (r *reloader) Status() ReloadStatus {
+	r.Lock()
+	defer r.Unlock()
+	return r.status
+}
+
+// Start loads a new model set of the requested pipeline in the background
+func (r *reloader) Start(request ReloadRequest) (ReloadStatus, error) {
+	if len(request.Pipeline) == 0 {
+		request.Pipeline = PipelineName
+	}
+	if _, exists := pipelines[request.Pipeline]; !exists {
+		return r.Status(), NewAPIError(http.StatusNotFound, ERR_NOT_FOUND, "no pipeline %q", request.Pipeline)
+	}
+	if m := PipelineModels(request.Pipeline); m != nil && len(request.Lexicon) > 0 && m.spec.Analyzer != ANALYZER_BGULEX {
+		return r.Status(), NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "pipeline %s has no ma_lexicon", request.Pipeline)
+	}
+	return r.start([]string{request.Pipeline}, request)
+}
+
+// start loads new model sets of the named pipelines in turn, in the
+// background; only one reload runs at a time
+func (r *reloader) start(names []string, request ReloadRequest) (ReloadStatus, error) {
+	r.Lock()
+	defer r.Unlock()
+	if !Ready() {
+		return r.status, NewAPIError(http.StatusServiceUnavailable, ERR_UNAVAILABLE, "models are loading")
+	}
+	if r.status.State == RELOAD_LOADING {
+		return r.status, NewAPIError(http.StatusConflict, ERR_CONFLICT, "a reload is already running")
+	}
+	started := time.Now()
+	r.status = ReloadStatus{State: RELOAD_LOADING, Pipelines: names, Started: &started}
+	go r.run(names, request)
+	return r.status, nil
+}
+
+func (r *reloader) run(names []string, request ReloadRequest) {
+	var err error
+	for _, name := range names {
+		if err = reloadModels(name, request); err != nil {
+			err = fmt.Errorf("pipeline %s: %v", name, err)
+			break
+		}
+	}
+	r.Lock()
+	defer r.Unlock()
+	finished := time.Now()
+	r.status.Finished = &finished
+	if err != nil {
+		log.Println("Failed reloading models:", err)
+		r.status.State = RELOAD_FAILED
+		r.status.Error = err.Error()
+		return
+	}
+	r.status.State = RELOAD_DONE
+}
+
+// reloadModels loads and validates a new model set of a pipeline and swaps
+// it in; on failure the current set keeps serving
+func reloadModels(name string, request ReloadRequest) error {
+	spec := PipelineModels(name).spec
+	if len(request.MdModelName) > 0 {
+		spec.MdModelName = request.MdModelName
+	}
+	if len(request.JointModelName) > 0 {
+		spec.JointModelName = request.JointModelName
+	}
+	if len(request.Lexicon) > 0 {
+		spec.MaLexicon = request.Lexicon
+	}
+	log.Println("Reloading models of pipeline", name)
+	m, err := LoadModels(spec)
+	if err != nil {
+		return err
+	}
+	if err := m.validate(); err != nil {
+		if closeErr := m.close(); closeErr != nil {
+			log.Println("Failed closing rejected models of pipeline", name, ":", closeErr)
+		}
+		return err
+	}
+	old := setModels(m)
+	log.Println("Swapped in reloaded models of pipeline", name)
+	// requests holding the old set finish on it first
+	go func() {
+		<-old.retire()
+		if err := old.close(); err != nil {
+			log.Println("Failed closing replaced models of pipeline", name, ":", err)
+			return
+		}
+		log.Println("Closed replaced models of pipeline", name)
+	}()
+	return nil
+}
+
+// validate parses the validation sentence of the spec with every parser
+// pool of the set
+func (m *Models) validate() error {
+	if len(m.spec.Validation) == 0 {
+		log.Println("Pipeline", m.spec.Name, "has no validation sentence, not validating")
+		return nil
+	}
+	sent := make(nlp.BasicSentence, len(m.spec.Validation))
+	for i, token := range m.spec.Validation {
+		sent[i] = nlp.Token(token)
+	}
+	maLattice, err := m.HebrewMorphAnalyzeBasicSentences([]nlp.BasicSentence{sent})
+	if err != nil {
+		return fmt.Errorf("validation analysis failed: %v", err)
+	}
+	instances, err := m.md.readLattices(maLattice)
+	if err != nil {
+		return fmt.Errorf("validation lattices failed: %v", err)
+	}
+	if _, err := m.mdParseInstances(context.Background(), instances); err != nil {
+		return fmt.Errorf("validation tagging failed: %v", err)
+	}
+	if m.spec.TagOnly {
+		return nil
+	}
+	if instances, err = m.joint.readLattices(maLattice); err != nil {
+		return fmt.Errorf("validation lattices failed: %v", err)
+	}
+	if _, err := m.jointParseInstances(context.Background(), instances); err != nil {
+		return fmt.Errorf("validation parsing failed: %v", err)
+	}
+	return nil
+}
+
+// reloadOnHangup reloads the current model files of all pipelines on every
+// SIGHUP
+func reloadOnHangup() {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	for range hangups {
+		log.Println("Received SIGHUP - reloading models")
+		if _, err := reloads.start(pipelineNames, ReloadRequest{}); err != nil {
+			log.Println("Not reloading:", err)
+		}
+	}
+}
+
+func ReloadHandler(resp http.ResponseWriter, req *http.Request) {
+	request := ReloadRequest{}
+	// the body is optional
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil && err != io.EOF {
+		respondWithError(resp, NewAPIError(http.StatusBadRequest, ERR_BAD_REQUEST, "malformed request body: %v", err))
+		return
+	}
+	status, err := reloads.Start(request)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	respondWithJSON(resp, http.StatusAccepted, status)
+}
+
+func ReloadStatusHandler(resp http.ResponseWriter, req *http.Request) {
+	respondWithJSON(resp, http.StatusOK, reloads.Status())
+}
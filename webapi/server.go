@@ -0,0 +1,117 @@
+package webapi
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var (
+	// listener options
+	ListenAddr  string
+	ListenPort  int
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// timeouts in seconds; 0 = no timeout
+	ReadTimeout     int
+	WriteTimeout    int
+	IdleTimeout     int
+	ShutdownTimeout int
+)
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+func NewServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         net.JoinHostPort(ListenAddr, strconv.Itoa(ListenPort)),
+		Handler:      handler,
+		ReadTimeout:  seconds(ReadTimeout),
+		WriteTimeout: seconds(WriteTimeout),
+		IdleTimeout:  seconds(IdleTimeout),
+	}
+}
+
+// Serve runs the server, and the gRPC server if not nil, until either fails
+// or receives SIGTERM/SIGINT. On a signal the listeners are closed and
+// in-flight requests are given ShutdownTimeout seconds to complete before
+// the server exits.
+func Serve(server *http.Server, grpcServer *grpc.Server) error {
+	if (TLSCertFile == "") != (TLSKeyFile == "") {
+		return fmt.Errorf("Both tls_cert and tls_key must be set to serve TLS")
+	}
+
+	serveErr := make(chan error, 2)
+	go func() {
+		if TLSCertFile != "" {
+			log.Println("Server is listening at", server.Addr, "(TLS)")
+			serveErr <- server.ListenAndServeTLS(TLSCertFile, TLSKeyFile)
+		} else {
+			log.Println("Server is listening at", server.Addr)
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+	if grpcServer != nil {
+		listener, err := net.Listen("tcp", grpcAddr())
+		if err != nil {
+			server.Close()
+			return err
+		}
+		go func() {
+			log.Println("gRPC server is listening at", listener.Addr())
+			serveErr <- grpcServer.Serve(listener)
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-serveErr:
+		server.Close()
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+		return err
+	case sig := <-signals:
+		log.Println("Received", sig, "- draining in-flight requests")
+	}
+
+	ctx := context.Background()
+	if ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, seconds(ShutdownTimeout))
+		defer cancel()
+	}
+	grpcStopped := make(chan struct{})
+	if grpcServer != nil {
+		go func() {
+			grpcServer.GracefulStop()
+			close(grpcStopped)
+		}()
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("Failed graceful shutdown: %v", err)
+	}
+	if grpcServer != nil {
+		select {
+		case <-grpcStopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+			return fmt.Errorf("Failed graceful shutdown of the gRPC server: %v", ctx.Err())
+		}
+	}
+	log.Println("Server stopped")
+	return nil
+}
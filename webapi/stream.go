@@ -0,0 +1,290 @@
+package webapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"yap/nlp/format/lattice"
+	nlp "yap/nlp/types"
+)
+
+const (
+	NDJSON_CONTENT_TYPE = "application/x-ndjson"
+
+	// longest accepted input line
+	MAX_STREAM_LINE = 1 << 20
+)
+
+// StreamResult is a single line of a streaming response. Sentence is the
+// zero-based index of the input line (blank lines are not counted).
+type StreamResult struct {
+	Sentence int       `json:"sentence"`
+	Nodes    []Node    `json:"nodes,omitempty"`
+	Error    *APIError `json:"error,omitempty"`
+}
+
+// streamErrors records the sentences that failed before reaching the parser
+type streamErrors struct {
+	sync.Mutex
+	errs map[int]error
+}
+
+func (s *streamErrors) Set(i int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.errs[i] = err
+}
+
+func (s *streamErrors) Get(i int) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.errs[i]
+}
+
+// A streamParser runs a single lattice through a parser pool of a model set
+// and converts the result to nodes
+type streamParser func(ctx context.Context, m *Models, lat lattice.Lattice) ([]Node, error)
+
+// duplexConn extends the read and write deadlines of a streaming request
+// per line, on Go versions that expose them to handlers
+type duplexConn interface {
+	SetReadDeadline(time.Time) error
+	SetWriteDeadline(time.Time) error
+}
+
+// enableFullDuplex lets the handler write results while the request body
+// is still being read. HTTP/2 is always full duplex; for HTTP/1 it depends
+// on support by the Go runtime the server was built with (Go 1.21 or later).
+// Streams are refused without it, as their results would be held back
+// until the whole body was read.
+func enableFullDuplex(resp http.ResponseWriter, req *http.Request) bool {
+	if req.ProtoMajor >= 2 {
+		return true
+	}
+	if fd, ok := resp.(interface{ EnableFullDuplex() error }); ok {
+		return fd.EnableFullDuplex() == nil
+	}
+	return false
+}
+
+func extendDeadline(resp http.ResponseWriter, read bool) {
+	conn, ok := resp.(duplexConn)
+	if !ok {
+		return
+	}
+	if read && ReadTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(seconds(ReadTimeout)))
+	}
+	if !read && WriteTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(seconds(WriteTimeout)))
+	}
+}
+
+// readSentenceStream reads one sentence of whitespace separated tokens per
+// line; readErr is set once the body is consumed
+func readSentenceStream(resp http.ResponseWriter, body io.Reader, readErr *error) chan nlp.BasicSentence {
+	sents := make(chan nlp.BasicSentence, 2)
+	go func() {
+		defer close(sents)
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64*1024), MAX_STREAM_LINE)
+		extendDeadline(resp, true)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			extendDeadline(resp, true)
+			if len(fields) == 0 {
+				continue
+			}
+			sent := make(nlp.BasicSentence, len(fields))
+			for i, field := range fields {
+				sent[i] = nlp.Token(field)
+			}
+			sents <- sent
+		}
+		*readErr = scanner.Err()
+	}()
+	return sents
+}
+
+// analyzeStream runs the morphological analyzer over a stream of sentences.
+// A failed sentence is recorded in failed and passed on as an empty lattice
+// so that positions in the stream are kept.
+func (m *Models) analyzeStream(sents chan nlp.BasicSentence, failed *streamErrors) chan nlp.LatticeSentence {
+	lattices := make(chan nlp.LatticeSentence, 2)
+	go func() {
+		analyzer, stats := m.newAnalyzer()
+		var i int
+		for sent := range sents {
+			lat, _, err := analyzeSentence(analyzer, stats, sent)
+			if err != nil {
+				failed.Set(i, err)
+				lat = nlp.LatticeSentence{}
+			}
+			lattices <- lat
+			i++
+		}
+		close(lattices)
+	}()
+	return lattices
+}
+
+// parseStream parses the lattices concurrently on the parser pool. Every
+// sentence gets its own result channel, sent on the returned channel in
+// input order; at most size sentences are in flight at a time.
+func (m *Models) parseStream(ctx context.Context, lattices chan lattice.Lattice, parse streamParser, failed *streamErrors, size int) chan chan StreamResult {
+	pending := make(chan chan StreamResult, size)
+	go func() {
+		var i int
+		for lat := range lattices {
+			result := make(chan StreamResult, 1)
+			pending <- result
+			if err := failed.Get(i); err != nil {
+				result <- StreamResult{Sentence: i, Error: AsAPIError(err)}
+			} else {
+				go func(j int, l lattice.Lattice) {
+					line := StreamResult{Sentence: j}
+					defer func() {
+						if r := recover(); r != nil {
+							line.Nodes, line.Error = nil, recoveredError(ERR_PARSE, r)
+						}
+						result <- line
+					}()
+					nodes, err := parse(ctx, m, l)
+					if err != nil {
+						line.Error = AsAPIError(err)
+						return
+					}
+					line.Nodes = nodes
+				}(i, lat)
+			}
+			i++
+		}
+		close(pending)
+	}()
+	return pending
+}
+
+// pipelineStream runs a stream of sentences through the analyzer and parser,
+// returning the ordered result channels of parseStream
+func (m *Models) pipelineStream(ctx context.Context, sents chan nlp.BasicSentence, parse streamParser) chan chan StreamResult {
+	failed := &streamErrors{errs: make(map[int]error)}
+	lattices := lattice.Sentence2LatticeStream(m.analyzeStream(sents, failed), maHebrew)
+	return m.parseStream(ctx, lattices, parse, failed, Workers)
+}
+
+// latticeInstance converts an analyzed lattice to an instance of the pool's
+// parser the same way batch requests do, by way of the lattice text format
+func (p *ParserPool) latticeInstance(lat lattice.Lattice) (interface{}, error) {
+	buf := new(bytes.Buffer)
+	if err := lattice.Write(buf, []lattice.Lattice{lat}); err != nil {
+		return nil, NewAPIError(http.StatusInternalServerError, ERR_ANALYZE, "failed writing lattice: %v", err)
+	}
+	instances, err := p.readLattices(buf.String())
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) != 1 {
+		return nil, NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "sentence has no analysis")
+	}
+	return instances[0], nil
+}
+
+func jointStreamParser(ctx context.Context, m *Models, lat lattice.Lattice) ([]Node, error) {
+	instance, err := m.joint.latticeInstance(lat)
+	if err != nil {
+		return nil, err
+	}
+	result, err := m.joint.Parse(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+	return GraphToNodes(result.(nlp.MorphDependencyGraph)), nil
+}
+
+func mdStreamParser(ctx context.Context, m *Models, lat lattice.Lattice) ([]Node, error) {
+	instance, err := m.md.latticeInstance(lat)
+	if err != nil {
+		return nil, err
+	}
+	result, err := m.md.Parse(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+	return TokensToNodes(MappingsToMorphemes(resultMappings(result))), nil
+}
+
+// streamHandler reads newline delimited sentences from a (chunked) request
+// body and writes one JSON result per line as soon as each sentence, and
+// all sentences before it, are done. The joint parser is only used by
+// parsing pipelines.
+func streamHandler(parse streamParser, joint bool) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		// writing the response ends reading of an HTTP/1 request body
+		// unless the connection is full duplex
+		if !enableFullDuplex(resp, req) {
+			respondWithError(resp, NewAPIError(http.StatusHTTPVersionNotSupported, ERR_BAD_REQUEST, "streaming requires HTTP/2, or HTTP/1.1 on a server built with Go 1.21 or later"))
+			return
+		}
+		m, err := requestModels(req)
+		if err != nil {
+			respondWithError(resp, err)
+			return
+		}
+		defer m.release()
+		if joint {
+			if err := m.parses(); err != nil {
+				respondWithError(resp, err)
+				return
+			}
+		}
+		var readErr error
+		sents := readSentenceStream(resp, req.Body, &readErr)
+		results := m.pipelineStream(req.Context(), sents, parse)
+
+		var (
+			writeErr error
+			count    int
+			started  bool
+		)
+		flusher, _ := resp.(http.Flusher)
+		encoder := json.NewEncoder(resp)
+		write := func(line StreamResult) {
+			if writeErr != nil {
+				// client is gone, drop the remaining results
+				return
+			}
+			if !started {
+				resp.Header().Set("Content-Type", NDJSON_CONTENT_TYPE)
+				resp.WriteHeader(http.StatusOK)
+				started = true
+			}
+			extendDeadline(resp, false)
+			if writeErr = encoder.Encode(line); writeErr != nil {
+				log.Println("Failed writing stream result:", writeErr)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		for result := range results {
+			write(<-result)
+			count++
+		}
+		if readErr != nil {
+			write(StreamResult{Sentence: count, Error: NewAPIError(http.StatusBadRequest, ERR_BAD_REQUEST, "failed reading request body: %v", readErr)})
+		}
+		if !started {
+			resp.Header().Set("Content-Type", NDJSON_CONTENT_TYPE)
+			resp.WriteHeader(http.StatusOK)
+		}
+	}
+}
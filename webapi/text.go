@@ -0,0 +1,180 @@
+package webapi
+
+import (
+	"net/http"
+	"strings"
+	"yap/nlp/tokenizer"
+	"yap/nlp/types"
+)
+
+type TextRequest struct {
+	Text string `json:"text"`
+}
+
+// TextNode is a Node with the character span of its source token in the
+// request text. Start and End are offsets in unicode characters, End exclusive.
+type TextNode struct {
+	Node
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// tokenizeRequest splits the request text into sentences, returning both
+// the positioned tokens and the analyzer input
+func tokenizeRequest(req *http.Request) ([]tokenizer.Sentence, []types.BasicSentence, error) {
+	request := TextRequest{}
+	if err := decodeRequest(req, &request); err != nil {
+		return nil, nil, err
+	}
+	if len(strings.TrimSpace(request.Text)) == 0 {
+		return nil, nil, NewAPIError(http.StatusUnprocessableEntity, ERR_INVALID_INPUT, "empty text")
+	}
+	sents := tokenizer.Tokenize(request.Text)
+	basic := make([]types.BasicSentence, len(sents))
+	for i, sent := range sents {
+		basic[i] = sent.BasicSentence()
+	}
+	return sents, basic, nil
+}
+
+func withOffsets(nodes []Node, sent tokenizer.Sentence) []TextNode {
+	retval := make([]TextNode, len(nodes))
+	for i, node := range nodes {
+		retval[i].Node = node
+		if node.Token >= 0 && node.Token < len(sent) {
+			retval[i].Start = sent[node.Token].Start
+			retval[i].End = sent[node.Token].End
+		}
+	}
+	return retval
+}
+
+func HebrewTagTextHandler(resp http.ResponseWriter, req *http.Request) {
+	format, err := responseFormat(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	sents, basic, err := tokenizeRequest(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	confidence, err := confidenceParam(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	m, err := requestModels(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	defer m.release()
+	maLattice, err := m.HebrewMorphAnalyzeBasicSentences(basic)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	instances, err := m.md.readLattices(maLattice)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	parsed, agreements, err := m.mdParse(req.Context(), instances, confidence)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+
+	nodes := make([][]Node, len(parsed))
+	for i, mappings := range parsed {
+		nodes[i] = withMappingsConfidence(TokensToNodes(MappingsToMorphemes(mappings)), mappings, agreementAt(agreements, i))
+	}
+
+	if format == FORMAT_CONLLU {
+		output := make([]interface{}, len(parsed))
+		for i, mappings := range parsed {
+			sent := MappingsToConllU(mappings, basic[i])
+			setTokenRanges(sent, sents[i])
+			setConfidence(sent, nodes[i])
+			output[i] = sent
+		}
+		respondWithConllU(resp, output)
+		return
+	}
+
+	output := make([][]TextNode, len(parsed))
+	for i := range parsed {
+		output[i] = withOffsets(nodes[i], sents[i])
+	}
+
+	respondWithJSON(resp, http.StatusOK, output)
+}
+
+func HebrewParseTextHandler(resp http.ResponseWriter, req *http.Request) {
+	format, err := responseFormat(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	sents, basic, err := tokenizeRequest(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	confidence, err := confidenceParam(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	m, err := requestModels(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	defer m.release()
+	if err := m.parses(); err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	maLattice, err := m.HebrewMorphAnalyzeBasicSentences(basic)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	instances, err := m.joint.readLattices(maLattice)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	depGraph, agreements, err := m.jointParse(req.Context(), instances, confidence)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+
+	nodes := make([][]Node, len(depGraph))
+	for i, graph := range depGraph {
+		nodes[i] = withGraphConfidence(GraphToNodes(graph), graph, agreementAt(agreements, i))
+	}
+
+	if format == FORMAT_CONLLU {
+		output := make([]interface{}, len(depGraph))
+		for i, graph := range depGraph {
+			sent := GraphToConllU(graph, basic[i])
+			setTokenRanges(sent, sents[i])
+			setConfidence(sent, nodes[i])
+			output[i] = sent
+		}
+		respondWithConllU(resp, output)
+		return
+	}
+
+	output := make([][]TextNode, len(depGraph))
+	for i := range depGraph {
+		output[i] = withOffsets(nodes[i], sents[i])
+	}
+
+	respondWithJSON(resp, http.StatusOK, output)
+}
@@ -5,14 +5,17 @@ import (
 	"github.com/gonuts/commander"
 	"github.com/gonuts/flag"
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
 	"log"
 	"net/http"
 	"strings"
 	"yap/app"
 	"yap/nlp/format/conll"
+	"yap/nlp/format/constraints"
 	"yap/nlp/format/lattice"
 	"yap/nlp/format/lex"
 	"yap/nlp/parser/joint"
+	"yap/nlp/parser/ma"
 	"yap/nlp/types"
 )
 
@@ -22,135 +25,303 @@ var (
 )
 
 type Request struct {
-	Text          string `json:text`
-	AmbLattice    string `json:amb_lattice`
-	DisambLattice string `json:disamb_lattice`
+	Text          string `json:"text"`
+	AmbLattice    string `json:"amb_lattice"`
+	DisambLattice string `json:"disamb_lattice"`
 }
 
 type ParseRequest struct {
-	Sentences []types.BasicSentence `json:sentences`
+	Sentences []types.BasicSentence `json:"sentences"`
+	// optional partial annotations, by sentence index
+	Constraints []constraints.Sentence `json:"constraints,omitempty"`
+	// optional lexical entries added for this request only
+	Lexicon []ma.Entry `json:"lexicon,omitempty"`
 }
 
 type Data struct {
-	MALattice string `json:"ma_lattice,omitempty"`
-	MDLattice string `json:"md_lattice,omitempty"`
-	DepTree   string `json:"dep_tree,omitempty"`
-	Error     error  `json:"error,omitempty"`
+	MALattice string    `json:"ma_lattice,omitempty"`
+	MDLattice string    `json:"md_lattice,omitempty"`
+	DepTree   string    `json:"dep_tree,omitempty"`
+	Error     *APIError `json:"error,omitempty"`
+}
+
+func decodeRequest(req *http.Request, request interface{}) error {
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		return NewAPIError(http.StatusBadRequest, ERR_BAD_REQUEST, "malformed request body: %v", err)
+	}
+	return nil
+}
+
+func respondWithData(resp http.ResponseWriter, data Data, err error) {
+	if err != nil {
+		apiErr := AsAPIError(err)
+		data.Error = apiErr
+		respondWithJSON(resp, apiErr.Status, data)
+		return
+	}
+	respondWithJSON(resp, http.StatusOK, data)
 }
 
 func HebrewMorphAnalyzerHandler(resp http.ResponseWriter, req *http.Request) {
 	request := Request{}
-	err := json.NewDecoder(req.Body).Decode(&request)
-	if err != nil {
-		data := Data{Error: err}
-		respondWithJSON(resp, http.StatusBadRequest, data)
+	if err := decodeRequest(req, &request); err != nil {
+		respondWithData(resp, Data{}, err)
 		return
 	}
 	rawText := strings.Replace(request.Text, " ", "\n", -1)
-	maLattice := HebrewMorphAnalyzeRawSentences(rawText)
-	data := Data{MALattice: maLattice}
-	respondWithJSON(resp, http.StatusOK, data)
+	m, err := requestModels(req)
+	if err != nil {
+		respondWithData(resp, Data{}, err)
+		return
+	}
+	defer m.release()
+	maLattice, err := m.HebrewMorphAnalyzeRawSentences(rawText)
+	respondWithData(resp, Data{MALattice: maLattice}, err)
 }
 
 func MorphDisambiguatorHandler(resp http.ResponseWriter, req *http.Request) {
 	request := Request{}
-	err := json.NewDecoder(req.Body).Decode(&request)
-	if err != nil {
-		data := Data{Error: err}
-		respondWithJSON(resp, http.StatusBadRequest, data)
+	if err := decodeRequest(req, &request); err != nil {
+		respondWithData(resp, Data{}, err)
 		return
 	}
 	ambLattice := strings.Replace(request.AmbLattice, "\\t", "\t", -1)
 	ambLattice = strings.Replace(ambLattice, "\\n", "\n", -1)
-	mdLattice := MorphDisambiguateLattices(ambLattice)
-	data := Data{MDLattice: mdLattice}
-	respondWithJSON(resp, http.StatusOK, data)
+	m, err := requestModels(req)
+	if err != nil {
+		respondWithData(resp, Data{}, err)
+		return
+	}
+	defer m.release()
+	mdLattice, err := m.MorphDisambiguateLattices(req.Context(), ambLattice)
+	respondWithData(resp, Data{MDLattice: mdLattice}, err)
 }
 
 func DepParserHandler(resp http.ResponseWriter, req *http.Request) {
 	request := Request{}
-	err := json.NewDecoder(req.Body).Decode(&request)
-	if err != nil {
-		result := Data{Error: err}
-		respondWithJSON(resp, http.StatusBadRequest, result)
+	if err := decodeRequest(req, &request); err != nil {
+		respondWithData(resp, Data{}, err)
 		return
 	}
 	disambLattice := strings.Replace(request.DisambLattice, "\\t", "\t", -1)
 	disambLattice = strings.Replace(disambLattice, "\\n", "\n", -1)
-	depTree := DepParseDisambiguatedLattice(disambLattice)
-	data := Data{DepTree: depTree}
-	respondWithJSON(resp, http.StatusOK, data)
+	m, err := requestModels(req)
+	if err != nil {
+		respondWithData(resp, Data{}, err)
+		return
+	}
+	defer m.release()
+	if err := m.parses(); err != nil {
+		respondWithData(resp, Data{}, err)
+		return
+	}
+	depTree, err := m.DepParseDisambiguatedLattice(req.Context(), disambLattice)
+	respondWithData(resp, Data{DepTree: depTree}, err)
 }
 
 func HebrewPipelineHandler(resp http.ResponseWriter, req *http.Request) {
 	request := Request{}
-	err := json.NewDecoder(req.Body).Decode(&request)
+	if err := decodeRequest(req, &request); err != nil {
+		respondWithData(resp, Data{}, err)
+		return
+	}
+	m, err := requestModels(req)
 	if err != nil {
-		data := Data{Error: err}
-		respondWithJSON(resp, http.StatusBadRequest, data)
+		respondWithData(resp, Data{}, err)
+		return
+	}
+	defer m.release()
+	if err := m.parses(); err != nil {
+		respondWithData(resp, Data{}, err)
 		return
 	}
 	rawText := strings.Replace(request.Text, " ", "\n", -1)
-	maLattice := HebrewMorphAnalyzeRawSentences(rawText)
-	mdLattice := MorphDisambiguateLattices(maLattice)
-	depTree := DepParseDisambiguatedLattice(mdLattice)
-	data := Data{MALattice: maLattice, MDLattice: mdLattice, DepTree: depTree}
-	respondWithJSON(resp, http.StatusOK, data)
+	maLattice, err := m.HebrewMorphAnalyzeRawSentences(rawText)
+	if err != nil {
+		respondWithData(resp, Data{}, err)
+		return
+	}
+	mdLattice, err := m.MorphDisambiguateLattices(req.Context(), maLattice)
+	if err != nil {
+		respondWithData(resp, Data{MALattice: maLattice}, err)
+		return
+	}
+	depTree, err := m.DepParseDisambiguatedLattice(req.Context(), mdLattice)
+	respondWithData(resp, Data{MALattice: maLattice, MDLattice: mdLattice, DepTree: depTree}, err)
 }
 
 func HebrewJointHandler(resp http.ResponseWriter, req *http.Request) {
 	request := Request{}
-	err := json.NewDecoder(req.Body).Decode(&request)
+	if err := decodeRequest(req, &request); err != nil {
+		respondWithData(resp, Data{}, err)
+		return
+	}
+	m, err := requestModels(req)
 	if err != nil {
-		data := Data{Error: err}
-		respondWithJSON(resp, http.StatusBadRequest, data)
+		respondWithData(resp, Data{}, err)
+		return
+	}
+	defer m.release()
+	if err := m.parses(); err != nil {
+		respondWithData(resp, Data{}, err)
 		return
 	}
 	rawText := strings.Replace(request.Text, " ", "\n", -1)
-	maLattice := HebrewMorphAnalyzeRawSentences(rawText)
-	depTree, mdLattice, _ := JointParseAmbiguousLattices(maLattice)
-	data := Data{MALattice: maLattice, MDLattice: mdLattice, DepTree: depTree}
-	respondWithJSON(resp, http.StatusOK, data)
+	maLattice, err := m.HebrewMorphAnalyzeRawSentences(rawText)
+	if err != nil {
+		respondWithData(resp, Data{}, err)
+		return
+	}
+	depTree, mdLattice, _, err := m.JointParseAmbiguousLattices(req.Context(), maLattice)
+	respondWithData(resp, Data{MALattice: maLattice, MDLattice: mdLattice, DepTree: depTree}, err)
 }
 
 func HebrewIndexHandler(resp http.ResponseWriter, req *http.Request) {
-	respondWithJSON(resp, http.StatusOK, nil)
+	InfoHandler(resp, req)
 }
 
 func HebrewParseHandler(resp http.ResponseWriter, req *http.Request) {
+	format, err := responseFormat(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
 	request := ParseRequest{}
-	err := json.NewDecoder(req.Body).Decode(&request)
+	if err := decodeRequest(req, &request); err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	k, err := kbestParam(req, format)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	confidence, err := confidenceParam(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	m, err := requestModels(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	defer m.release()
+	if err := m.parses(); err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	maLattice, err := m.HebrewMorphAnalyzeWithEntries(request.Sentences, request.Lexicon)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	instances, err := m.joint.readConstrainedLattices(maLattice, request.Constraints)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	if k > 1 {
+		analyses, err := kbestAnalyses(req.Context(), m.joint, instances, k, app.RenderMorphGraph, graphNodes)
+		if err != nil {
+			respondWithError(resp, err)
+			return
+		}
+		respondWithJSON(resp, http.StatusOK, analyses)
+		return
+	}
+	depGraph, agreements, err := m.jointParse(req.Context(), instances, confidence)
 	if err != nil {
-		data := Data{Error: err}
-		respondWithJSON(resp, http.StatusBadRequest, data)
+		respondWithError(resp, err)
 		return
 	}
-	maLattice := HebrewMorphAnalyzeBasicSentences(request.Sentences)
-	depGraph := JointRawParseAmbiguousLattices(maLattice)
 
 	output := make([][]Node, len(depGraph))
 	for i, graph := range depGraph {
-		output[i] = GraphToNodes(graph)
+		output[i] = withGraphConfidence(GraphToNodes(graph), graph, agreementAt(agreements, i))
+	}
+
+	if format == FORMAT_CONLLU {
+		sents := make([]interface{}, len(depGraph))
+		for i, graph := range depGraph {
+			sent := GraphToConllU(graph, request.Sentences[i])
+			setConfidence(sent, output[i])
+			sents[i] = sent
+		}
+		respondWithConllU(resp, sents)
+		return
 	}
 
 	respondWithJSON(resp, http.StatusOK, output)
 }
 
 func HebrewTagHandler(resp http.ResponseWriter, req *http.Request) {
+	format, err := responseFormat(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
 	request := ParseRequest{}
-	err := json.NewDecoder(req.Body).Decode(&request)
+	if err := decodeRequest(req, &request); err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	k, err := kbestParam(req, format)
 	if err != nil {
-		data := Data{Error: err}
-		respondWithJSON(resp, http.StatusBadRequest, data)
+		respondWithError(resp, err)
+		return
+	}
+	confidence, err := confidenceParam(req)
+	if err != nil {
+		respondWithError(resp, err)
 		return
 	}
 
-	maLattice := HebrewMorphAnalyzeBasicSentences(request.Sentences)
-	parsed := RawMorphDisambiguateLattices(maLattice)
+	m, err := requestModels(req)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	defer m.release()
+	maLattice, err := m.HebrewMorphAnalyzeWithEntries(request.Sentences, request.Lexicon)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	instances, err := m.md.readConstrainedLattices(maLattice, request.Constraints)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
+	if k > 1 {
+		analyses, err := kbestAnalyses(req.Context(), m.md, instances, k, app.RenderMDConfig, mdNodes)
+		if err != nil {
+			respondWithError(resp, err)
+			return
+		}
+		respondWithJSON(resp, http.StatusOK, analyses)
+		return
+	}
+	parsed, agreements, err := m.mdParse(req.Context(), instances, confidence)
+	if err != nil {
+		respondWithError(resp, err)
+		return
+	}
 
 	output := make([][]Node, len(parsed))
-	for i, tokens := range parsed {
-		output[i] = TokensToNodes(tokens)
+	for i, mappings := range parsed {
+		output[i] = withMappingsConfidence(TokensToNodes(MappingsToMorphemes(mappings)), mappings, agreementAt(agreements, i))
+	}
+
+	if format == FORMAT_CONLLU {
+		sents := make([]interface{}, len(parsed))
+		for i, mappings := range parsed {
+			sent := MappingsToConllU(mappings, request.Sentences[i])
+			setConfidence(sent, output[i])
+			sents[i] = sent
+		}
+		respondWithConllU(resp, sents)
+		return
 	}
 
 	respondWithJSON(resp, http.StatusOK, output)
@@ -158,14 +329,14 @@ func HebrewTagHandler(resp http.ResponseWriter, req *http.Request) {
 
 func respondWithJSON(resp http.ResponseWriter, code int, payload interface{}) {
 	resp.Header().Set("Content-Type", "application/json")
-	resp.WriteHeader(code)
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
-		errJson, _ := json.Marshal(err)
-		resp.Write(errJson)
-	} else {
-		resp.Write(jsonPayload)
+		apiErr := NewAPIError(http.StatusInternalServerError, ERR_INTERNAL, "failed encoding response: %v", err)
+		jsonPayload, _ = json.Marshal(ErrorResponse{apiErr})
+		code = apiErr.Status
 	}
+	resp.WriteHeader(code)
+	resp.Write(jsonPayload)
 }
 
 func loggingMiddleware(next http.Handler) http.Handler {
@@ -186,6 +357,17 @@ listen to api requests
 
 	$ ./yap api [options]
 
+The gRPC service defined in webapi/yappb/yap.proto is served on
+grpc_port, next to the REST API.
+
+The server shuts down gracefully on SIGTERM or SIGINT, waiting for
+in-flight requests to complete. On SIGHUP it reloads the models in the
+background and swaps them in once loaded.
+
+The flags configure the default pipeline; more pipelines, e.g. a UD model
+with the data-driven analyzer, are read from the YAML list in -pipelines.
+Requests select one with ?pipeline=<name>.
+
 `,
 		Flag: *flag.NewFlagSet("api", flag.ExitOnError),
 	}
@@ -194,11 +376,31 @@ listen to api requests
 	cmd.Flag.BoolVar(&app.HebMaAlwaysnnp, "ma_always_nnp", false, "Always add NNP to tokens and prefixed subtokens")
 	cmd.Flag.BoolVar(&app.HebMaNnpnofeats, "ma_add_nnp_no_feats", false, "Add NNP in lex but without features")
 	cmd.Flag.BoolVar(&app.HebMaShowoov, "ma_show_oov", false, "Output OOV tokens")
+	cmd.Flag.StringVar(&UserLexiconFile, "ma_user_lexicon", "", "User lexicon file, consulted before the lexicon and edited through /admin/lexicon; empty = in memory only")
 	cmd.Flag.BoolVar(&lex.LOG_FAILURES, "ma_show_lex_error", false, "Log errors encountered when loading the lexicon")
 	cmd.Flag.IntVar(&app.BeamSize, "beam", 64, "Beam size")
 	cmd.Flag.BoolVar(&app.UsePOP, "use_end_token", true, "Use end token (pop)")
 	cmd.Flag.BoolVar(&lattice.IGNORE_LEMMA, "nolemma", true, "Ignore lemmas")
 	cmd.Flag.BoolVar(&TagOnly, "tagonly", false, "No dependency parser")
+	cmd.Flag.StringVar(&PipelineName, "pipeline_name", "heb", "Name of the pipeline configured by the flags")
+	cmd.Flag.StringVar(&PipelinesFile, "pipelines", "", "YAML file listing more pipelines to serve; unset fields take the flag values")
+	cmd.Flag.IntVar(&Workers, "workers", 0, "Number of sentences parsed concurrently per model; 0 = number of CPUs")
+	cmd.Flag.IntVar(&ParseTimeout, "parse_timeout", 0, "Beam search time budget per sentence in milliseconds; 0 = none")
+	cmd.Flag.BoolVar(&ParseTimeoutGreedy, "parse_timeout_greedy", true, "Finish a sentence exceeding parse_timeout greedily instead of failing it")
+	cmd.Flag.StringVar(&ListenAddr, "addr", "", "Address to bind to; empty = all interfaces")
+	cmd.Flag.IntVar(&ListenPort, "port", 8000, "Port to listen on")
+	cmd.Flag.IntVar(&GRPCPort, "grpc_port", 8001, "Port to serve the gRPC service on; 0 = no gRPC service")
+	cmd.Flag.StringVar(&TLSCertFile, "tls_cert", "", "TLS certificate file; serves HTTPS when set together with tls_key")
+	cmd.Flag.StringVar(&TLSKeyFile, "tls_key", "", "TLS private key file")
+	cmd.Flag.IntVar(&ReadTimeout, "read_timeout", 60, "Request read timeout in seconds; 0 = none")
+	cmd.Flag.IntVar(&WriteTimeout, "write_timeout", 300, "Response write timeout in seconds; 0 = none")
+	cmd.Flag.IntVar(&IdleTimeout, "idle_timeout", 120, "Keep-alive idle connection timeout in seconds; 0 = none")
+	cmd.Flag.IntVar(&ShutdownTimeout, "shutdown_timeout", 60, "Seconds to wait for in-flight requests on SIGTERM; 0 = wait indefinitely")
+	cmd.Flag.StringVar(&AdminToken, "admin_token", "", "Bearer token required by the /admin endpoints; empty = no admin endpoints")
+	cmd.Flag.IntVar(&MaxJobs, "max_jobs", 100, "Maximum number of batch jobs kept; the oldest finished jobs are evicted first")
+	cmd.Flag.IntVar(&JobRunners, "job_runners", 1, "Number of batch jobs processed concurrently")
+	cmd.Flag.StringVar(&JobDir, "job_dir", "", "Directory to spill batch job results to; empty = keep results in memory")
+	cmd.Flag.IntVar(&JobPageSize, "job_page_size", 100, "Default and maximum number of results per job status page")
 	//cmd.Flag.BoolVar(&conll.IGNORE_LEMMA, "conll_nolemma", true, "Ignore lemmas")
 	cmd.Flag.StringVar(&conll.WORD_TYPE, "conll_wordtype", "form", "Word type [form, lemma, lemma+f (=lemma if present else form)]")
 	cmd.Flag.StringVar(&app.MdParamFuncName, "md_param_func", "Funcs_Main_POS_Both_Prop", "MD param func types: ["+types.AllParamFuncNames+"]")
@@ -214,29 +416,63 @@ listen to api requests
 }
 
 func StartAPIServer(cmd *commander.Command, args []string) error {
-	HebrewMorphAnalyazerInitialize(cmd, args)
-	MorphDisambiguatorInitialize(cmd, args)
-	if !TagOnly {
-		DepParserInitialize(cmd, args)
-		JointParserInitialize()
+	if Workers <= 0 {
+		Workers = app.CPUs
 	}
 
+	specs, err := ReadPipelineSpecs()
+	if err != nil {
+		return err
+	}
+	PipelinesInitialize(specs)
+
 	router = mux.NewRouter()
-	//router.HandleFunc("/yap/heb/ma", HebrewMorphAnalyzerHandler)
-	//router.HandleFunc("/yap/heb/md", MorphDisambiguatorHandler)
-	//router.HandleFunc("/yap/heb/dep", DepParserHandler)
-	//router.HandleFunc("/yap/heb/pipeline", HebrewPipelineHandler)
-	//router.HandleFunc("/yap/heb/joint", HebrewJointHandler)
-	router.HandleFunc("/", HebrewIndexHandler)
-	router.HandleFunc("/tag", HebrewTagHandler)
-	if !TagOnly {
-		router.HandleFunc("/parse", HebrewParseHandler)
+	router.HandleFunc("/healthz", HealthHandler)
+	router.HandleFunc("/readyz", ReadyHandler)
+	router.HandleFunc("/info", InfoHandler)
+	router.HandleFunc("/metrics", MetricsHandler)
+
+	registerAdmin(router)
+
+	// everything else needs the models
+	api := router.PathPrefix("/").Subrouter()
+	//api.HandleFunc("/yap/heb/ma", HebrewMorphAnalyzerHandler)
+	//api.HandleFunc("/yap/heb/md", MorphDisambiguatorHandler)
+	//api.HandleFunc("/yap/heb/dep", DepParserHandler)
+	//api.HandleFunc("/yap/heb/pipeline", HebrewPipelineHandler)
+	//api.HandleFunc("/yap/heb/joint", HebrewJointHandler)
+	api.HandleFunc("/", HebrewIndexHandler)
+	api.HandleFunc("/tag", HebrewTagHandler)
+	api.HandleFunc("/tag/text", HebrewTagTextHandler)
+	api.HandleFunc("/tag/stream", streamHandler(mdStreamParser, false))
+	if anyParses(specs) {
+		api.HandleFunc("/parse", HebrewParseHandler)
+		api.HandleFunc("/parse/text", HebrewParseTextHandler)
+		api.HandleFunc("/parse/stream", streamHandler(jointStreamParser, true))
 	}
+	api.HandleFunc("/jobs", SubmitJobHandler).Methods("POST")
+	api.HandleFunc("/jobs/{id}", JobStatusHandler).Methods("GET")
+	api.Use(readinessMiddleware)
 	router.Use(loggingMiddleware)
+	router.Use(metricsMiddleware)
+	router.Use(recoveryMiddleware)
 
-	log.Println()
-	log.Println("Server is ready at port 8000")
+	// serve health checks while the models load
+	go func() {
+		UserLexiconInitialize()
+		JobsInitialize()
+		if err := LoadPipelines(specs); err != nil {
+			log.Fatalln("Failed loading models:", err)
+		}
+		log.Println("Server is ready to serve requests")
+	}()
+	go reloadOnHangup()
 
-	log.Fatal(http.ListenAndServe(":8000", router))
-	return nil
+	var grpcServer *grpc.Server
+	if GRPCPort > 0 {
+		if grpcServer, err = NewGRPCServer(); err != nil {
+			return err
+		}
+	}
+	return Serve(NewServer(router), grpcServer)
 }
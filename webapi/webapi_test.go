@@ -0,0 +1,107 @@
+package webapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yap/alg/search"
+	"yap/util"
+)
+
+const testLattice = "0\t1\tgnn\tgnn\tNN\tNN\tgen=M|num=S\t1\n1\t2\t.\t.\tyyDOT\tyyDOT\t_\t2\n\n"
+
+// stubEnums are empty enumerations an input is read into
+func stubEnums() enums {
+	return enums{
+		EWord:      util.NewEnumSet(10),
+		EPOS:       util.NewEnumSet(10),
+		EWPOS:      util.NewEnumSet(10),
+		EMHost:     util.NewEnumSet(10),
+		EMSuffix:   util.NewEnumSet(10),
+		EMorphProp: util.NewEnumSet(10),
+		ETrans:     util.NewEnumSet(10),
+		ETokens:    util.NewEnumSet(10),
+	}
+}
+
+// servePipelines serves a tag only pipeline "test", whose search panics as
+// its beam has no base configuration, and a pipeline "loading" without
+// models
+func servePipelines(t *testing.T) {
+	prevName := PipelineName
+	PipelineName = "test"
+	PipelinesInitialize([]PipelineSpec{{Name: "test", TagOnly: true}, {Name: "loading"}})
+	setModels(&Models{
+		spec:    PipelineSpec{Name: "test", TagOnly: true},
+		md:      NewParserPool("md", 2, &search.Beam{Size: 1}, stubEnums()),
+		drained: make(chan struct{}),
+	})
+	t.Cleanup(func() {
+		PipelineName = prevName
+		PipelinesInitialize(nil)
+	})
+}
+
+func TestHandlerErrors(t *testing.T) {
+	servePipelines(t)
+	panicking := func(http.ResponseWriter, *http.Request) { panic("handler failed") }
+	body := func(request Request) string {
+		encoded, _ := json.Marshal(request)
+		return string(encoded)
+	}
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		url      string
+		body     string
+		status   int
+		code     string
+		sentence int
+	}{
+		{"malformed body", MorphDisambiguatorHandler, "/", "{", http.StatusBadRequest, ERR_BAD_REQUEST, -1},
+		{"unknown pipeline", MorphDisambiguatorHandler, "/?pipeline=none", "{}", http.StatusNotFound, ERR_NOT_FOUND, -1},
+		{"loading pipeline", MorphDisambiguatorHandler, "/?pipeline=loading", "{}", http.StatusServiceUnavailable, ERR_UNAVAILABLE, -1},
+		{"tag only pipeline", DepParserHandler, "/", "{}", http.StatusBadRequest, ERR_BAD_REQUEST, -1},
+		{"malformed lattice", MorphDisambiguatorHandler, "/", body(Request{AmbLattice: "0\t1\n\n"}), http.StatusBadRequest, ERR_INVALID_INPUT, -1},
+		{"parser panic", MorphDisambiguatorHandler, "/", body(Request{AmbLattice: testLattice + testLattice}), http.StatusInternalServerError, ERR_PARSE, 0},
+		{"stream over HTTP/1", streamHandler(mdStreamParser, false), "/", "gnn .\n", http.StatusHTTPVersionNotSupported, ERR_BAD_REQUEST, -1},
+		{"handler panic", panicking, "/", "{}", http.StatusInternalServerError, ERR_INTERNAL, -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", test.url, strings.NewReader(test.body))
+			recoveryMiddleware(test.handler).ServeHTTP(resp, req)
+			if resp.Code != test.status {
+				t.Errorf("got status %d, want %d", resp.Code, test.status)
+			}
+			if contentType := resp.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("got content type %q", contentType)
+			}
+			var decoded struct {
+				Error map[string]interface{} `json:"error"`
+			}
+			if err := json.Unmarshal(resp.Body.Bytes(), &decoded); err != nil {
+				t.Fatalf("failed decoding %q: %v", resp.Body.String(), err)
+			}
+			if decoded.Error["code"] != test.code {
+				t.Errorf("got code %v, want %s", decoded.Error["code"], test.code)
+			}
+			if message, _ := decoded.Error["message"].(string); len(message) == 0 {
+				t.Error("got no message")
+			}
+			sentence, hasSentence := decoded.Error["sentence"].(float64)
+			if test.sentence < 0 && hasSentence {
+				t.Errorf("got sentence %v, want none", sentence)
+			}
+			if test.sentence >= 0 && (!hasSentence || int(sentence) != test.sentence) {
+				t.Errorf("got sentence %v, want %d", decoded.Error["sentence"], test.sentence)
+			}
+			if _, exists := decoded.Error["status"]; exists {
+				t.Error("got the status in the error object")
+			}
+		})
+	}
+}
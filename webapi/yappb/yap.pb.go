@@ -0,0 +1,993 @@
+// Protocol buffer definitions of the yap gRPC service.
+//
+// Regenerate yap.pb.go with:
+//
+//	protoc --go_out=plugins=grpc,paths=source_relative:. yap.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        (unknown)
+// source: yap.proto
+
+package yappb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Sentence is a pre-tokenized input sentence
+type Sentence struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Tokens []string `protobuf:"bytes,1,rep,name=tokens,proto3" json:"tokens,omitempty"`
+}
+
+func (x *Sentence) Reset() {
+	*x = Sentence{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_yap_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Sentence) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Sentence) ProtoMessage() {}
+
+func (x *Sentence) ProtoReflect() protoreflect.Message {
+	mi := &file_yap_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Sentence.ProtoReflect.Descriptor instead.
+func (*Sentence) Descriptor() ([]byte, []int) {
+	return file_yap_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Sentence) GetTokens() []string {
+	if x != nil {
+		return x.Tokens
+	}
+	return nil
+}
+
+type Request struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sentences []*Sentence `protobuf:"bytes,1,rep,name=sentences,proto3" json:"sentences,omitempty"`
+}
+
+func (x *Request) Reset() {
+	*x = Request{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_yap_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Request) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Request) ProtoMessage() {}
+
+func (x *Request) ProtoReflect() protoreflect.Message {
+	mi := &file_yap_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Request.ProtoReflect.Descriptor instead.
+func (*Request) Descriptor() ([]byte, []int) {
+	return file_yap_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Request) GetSentences() []*Sentence {
+	if x != nil {
+		return x.Sentences
+	}
+	return nil
+}
+
+// Feature is a single morphological feature, e.g. gen=M
+type Feature struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (x *Feature) Reset() {
+	*x = Feature{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_yap_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Feature) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Feature) ProtoMessage() {}
+
+func (x *Feature) ProtoReflect() protoreflect.Message {
+	mi := &file_yap_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Feature.ProtoReflect.Descriptor instead.
+func (*Feature) Descriptor() ([]byte, []int) {
+	return file_yap_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Feature) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Feature) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+// Morpheme is a disambiguated morpheme; token is the zero-based index of
+// the input token it belongs to
+type Morpheme struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Token    int32      `protobuf:"varint,1,opt,name=token,proto3" json:"token,omitempty"`
+	Form     string     `protobuf:"bytes,2,opt,name=form,proto3" json:"form,omitempty"`
+	Lemma    string     `protobuf:"bytes,3,opt,name=lemma,proto3" json:"lemma,omitempty"`
+	Cpos     string     `protobuf:"bytes,4,opt,name=cpos,proto3" json:"cpos,omitempty"`
+	Pos      string     `protobuf:"bytes,5,opt,name=pos,proto3" json:"pos,omitempty"`
+	Features []*Feature `protobuf:"bytes,6,rep,name=features,proto3" json:"features,omitempty"`
+}
+
+func (x *Morpheme) Reset() {
+	*x = Morpheme{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_yap_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Morpheme) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Morpheme) ProtoMessage() {}
+
+func (x *Morpheme) ProtoReflect() protoreflect.Message {
+	mi := &file_yap_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Morpheme.ProtoReflect.Descriptor instead.
+func (*Morpheme) Descriptor() ([]byte, []int) {
+	return file_yap_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Morpheme) GetToken() int32 {
+	if x != nil {
+		return x.Token
+	}
+	return 0
+}
+
+func (x *Morpheme) GetForm() string {
+	if x != nil {
+		return x.Form
+	}
+	return ""
+}
+
+func (x *Morpheme) GetLemma() string {
+	if x != nil {
+		return x.Lemma
+	}
+	return ""
+}
+
+func (x *Morpheme) GetCpos() string {
+	if x != nil {
+		return x.Cpos
+	}
+	return ""
+}
+
+func (x *Morpheme) GetPos() string {
+	if x != nil {
+		return x.Pos
+	}
+	return ""
+}
+
+func (x *Morpheme) GetFeatures() []*Feature {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+// Arc is a dependency arc between morphemes, indexed from zero in sentence
+// order; the root arc has head -1
+type Arc struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Head      int32  `protobuf:"varint,1,opt,name=head,proto3" json:"head,omitempty"`
+	Dependent int32  `protobuf:"varint,2,opt,name=dependent,proto3" json:"dependent,omitempty"`
+	Label     string `protobuf:"bytes,3,opt,name=label,proto3" json:"label,omitempty"`
+}
+
+func (x *Arc) Reset() {
+	*x = Arc{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_yap_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Arc) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Arc) ProtoMessage() {}
+
+func (x *Arc) ProtoReflect() protoreflect.Message {
+	mi := &file_yap_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Arc.ProtoReflect.Descriptor instead.
+func (*Arc) Descriptor() ([]byte, []int) {
+	return file_yap_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Arc) GetHead() int32 {
+	if x != nil {
+		return x.Head
+	}
+	return 0
+}
+
+func (x *Arc) GetDependent() int32 {
+	if x != nil {
+		return x.Dependent
+	}
+	return 0
+}
+
+func (x *Arc) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+// Error is a failure of a single sentence in a streaming response
+type Error struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Code    string `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_yap_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_yap_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_yap_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// Result is the analysis of a single sentence. Sentence is the zero-based
+// index of the sentence in the request; arcs are only set by Parse.
+type Result struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sentence  int32       `protobuf:"varint,1,opt,name=sentence,proto3" json:"sentence,omitempty"`
+	Morphemes []*Morpheme `protobuf:"bytes,2,rep,name=morphemes,proto3" json:"morphemes,omitempty"`
+	Arcs      []*Arc      `protobuf:"bytes,3,rep,name=arcs,proto3" json:"arcs,omitempty"`
+	Error     *Error      `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_yap_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_yap_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_yap_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Result) GetSentence() int32 {
+	if x != nil {
+		return x.Sentence
+	}
+	return 0
+}
+
+func (x *Result) GetMorphemes() []*Morpheme {
+	if x != nil {
+		return x.Morphemes
+	}
+	return nil
+}
+
+func (x *Result) GetArcs() []*Arc {
+	if x != nil {
+		return x.Arcs
+	}
+	return nil
+}
+
+func (x *Result) GetError() *Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+type Response struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Results []*Result `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+}
+
+func (x *Response) Reset() {
+	*x = Response{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_yap_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Response) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Response) ProtoMessage() {}
+
+func (x *Response) ProtoReflect() protoreflect.Message {
+	mi := &file_yap_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Response.ProtoReflect.Descriptor instead.
+func (*Response) Descriptor() ([]byte, []int) {
+	return file_yap_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Response) GetResults() []*Result {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+var File_yap_proto protoreflect.FileDescriptor
+
+var file_yap_proto_rawDesc = []byte{
+	0x0a, 0x09, 0x79, 0x61, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x03, 0x79, 0x61, 0x70,
+	0x22, 0x22, 0x0a, 0x08, 0x53, 0x65, 0x6e, 0x74, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06,
+	0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x74, 0x6f,
+	0x6b, 0x65, 0x6e, 0x73, 0x22, 0x36, 0x0a, 0x07, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x2b, 0x0a, 0x09, 0x73, 0x65, 0x6e, 0x74, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x0d, 0x2e, 0x79, 0x61, 0x70, 0x2e, 0x53, 0x65, 0x6e, 0x74, 0x65, 0x6e, 0x63,
+	0x65, 0x52, 0x09, 0x73, 0x65, 0x6e, 0x74, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x22, 0x33, 0x0a, 0x07,
+	0x46, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x22, 0x9a, 0x01, 0x0a, 0x08, 0x4d, 0x6f, 0x72, 0x70, 0x68, 0x65, 0x6d, 0x65, 0x12, 0x14,
+	0x0a, 0x05, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x74,
+	0x6f, 0x6b, 0x65, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x66, 0x6f, 0x72, 0x6d, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x66, 0x6f, 0x72, 0x6d, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x65, 0x6d, 0x6d,
+	0x61, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6c, 0x65, 0x6d, 0x6d, 0x61, 0x12, 0x12,
+	0x0a, 0x04, 0x63, 0x70, 0x6f, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x70,
+	0x6f, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x70, 0x6f, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x03, 0x70, 0x6f, 0x73, 0x12, 0x28, 0x0a, 0x08, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x73,
+	0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x79, 0x61, 0x70, 0x2e, 0x46, 0x65, 0x61,
+	0x74, 0x75, 0x72, 0x65, 0x52, 0x08, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x73, 0x22, 0x4d,
+	0x0a, 0x03, 0x41, 0x72, 0x63, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x65, 0x61, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x04, 0x68, 0x65, 0x61, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x64, 0x65, 0x70,
+	0x65, 0x6e, 0x64, 0x65, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x64, 0x65,
+	0x70, 0x65, 0x6e, 0x64, 0x65, 0x6e, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x61, 0x62, 0x65, 0x6c,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x22, 0x35, 0x0a,
+	0x05, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73,
+	0x73, 0x61, 0x67, 0x65, 0x22, 0x91, 0x01, 0x0a, 0x06, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12,
+	0x1a, 0x0a, 0x08, 0x73, 0x65, 0x6e, 0x74, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x08, 0x73, 0x65, 0x6e, 0x74, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x2b, 0x0a, 0x09, 0x6d,
+	0x6f, 0x72, 0x70, 0x68, 0x65, 0x6d, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0d,
+	0x2e, 0x79, 0x61, 0x70, 0x2e, 0x4d, 0x6f, 0x72, 0x70, 0x68, 0x65, 0x6d, 0x65, 0x52, 0x09, 0x6d,
+	0x6f, 0x72, 0x70, 0x68, 0x65, 0x6d, 0x65, 0x73, 0x12, 0x1c, 0x0a, 0x04, 0x61, 0x72, 0x63, 0x73,
+	0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x08, 0x2e, 0x79, 0x61, 0x70, 0x2e, 0x41, 0x72, 0x63,
+	0x52, 0x04, 0x61, 0x72, 0x63, 0x73, 0x12, 0x20, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x79, 0x61, 0x70, 0x2e, 0x45, 0x72, 0x72, 0x6f,
+	0x72, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x22, 0x31, 0x0a, 0x08, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x25, 0x0a, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x18,
+	0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x79, 0x61, 0x70, 0x2e, 0x52, 0x65, 0x73, 0x75,
+	0x6c, 0x74, 0x52, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x32, 0xa5, 0x01, 0x0a, 0x03,
+	0x59, 0x61, 0x70, 0x12, 0x22, 0x0a, 0x03, 0x54, 0x61, 0x67, 0x12, 0x0c, 0x2e, 0x79, 0x61, 0x70,
+	0x2e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0d, 0x2e, 0x79, 0x61, 0x70, 0x2e, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x24, 0x0a, 0x05, 0x50, 0x61, 0x72, 0x73, 0x65,
+	0x12, 0x0c, 0x2e, 0x79, 0x61, 0x70, 0x2e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0d,
+	0x2e, 0x79, 0x61, 0x70, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x28, 0x0a,
+	0x09, 0x54, 0x61, 0x67, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x0c, 0x2e, 0x79, 0x61, 0x70,
+	0x2e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0b, 0x2e, 0x79, 0x61, 0x70, 0x2e, 0x52,
+	0x65, 0x73, 0x75, 0x6c, 0x74, 0x30, 0x01, 0x12, 0x2a, 0x0a, 0x0b, 0x50, 0x61, 0x72, 0x73, 0x65,
+	0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x0c, 0x2e, 0x79, 0x61, 0x70, 0x2e, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x0b, 0x2e, 0x79, 0x61, 0x70, 0x2e, 0x52, 0x65, 0x73, 0x75, 0x6c,
+	0x74, 0x30, 0x01, 0x42, 0x12, 0x5a, 0x10, 0x79, 0x61, 0x70, 0x2f, 0x77, 0x65, 0x62, 0x61, 0x70,
+	0x69, 0x2f, 0x79, 0x61, 0x70, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_yap_proto_rawDescOnce sync.Once
+	file_yap_proto_rawDescData = file_yap_proto_rawDesc
+)
+
+func file_yap_proto_rawDescGZIP() []byte {
+	file_yap_proto_rawDescOnce.Do(func() {
+		file_yap_proto_rawDescData = protoimpl.X.CompressGZIP(file_yap_proto_rawDescData)
+	})
+	return file_yap_proto_rawDescData
+}
+
+var file_yap_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_yap_proto_goTypes = []interface{}{
+	(*Sentence)(nil), // 0: yap.Sentence
+	(*Request)(nil),  // 1: yap.Request
+	(*Feature)(nil),  // 2: yap.Feature
+	(*Morpheme)(nil), // 3: yap.Morpheme
+	(*Arc)(nil),      // 4: yap.Arc
+	(*Error)(nil),    // 5: yap.Error
+	(*Result)(nil),   // 6: yap.Result
+	(*Response)(nil), // 7: yap.Response
+}
+var file_yap_proto_depIdxs = []int32{
+	0,  // 0: yap.Request.sentences:type_name -> yap.Sentence
+	2,  // 1: yap.Morpheme.features:type_name -> yap.Feature
+	3,  // 2: yap.Result.morphemes:type_name -> yap.Morpheme
+	4,  // 3: yap.Result.arcs:type_name -> yap.Arc
+	5,  // 4: yap.Result.error:type_name -> yap.Error
+	6,  // 5: yap.Response.results:type_name -> yap.Result
+	1,  // 6: yap.Yap.Tag:input_type -> yap.Request
+	1,  // 7: yap.Yap.Parse:input_type -> yap.Request
+	1,  // 8: yap.Yap.TagStream:input_type -> yap.Request
+	1,  // 9: yap.Yap.ParseStream:input_type -> yap.Request
+	7,  // 10: yap.Yap.Tag:output_type -> yap.Response
+	7,  // 11: yap.Yap.Parse:output_type -> yap.Response
+	6,  // 12: yap.Yap.TagStream:output_type -> yap.Result
+	6,  // 13: yap.Yap.ParseStream:output_type -> yap.Result
+	10, // [10:14] is the sub-list for method output_type
+	6,  // [6:10] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_yap_proto_init() }
+func file_yap_proto_init() {
+	if File_yap_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_yap_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Sentence); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_yap_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Request); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_yap_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Feature); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_yap_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Morpheme); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_yap_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Arc); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_yap_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Error); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_yap_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Result); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_yap_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Response); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_yap_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_yap_proto_goTypes,
+		DependencyIndexes: file_yap_proto_depIdxs,
+		MessageInfos:      file_yap_proto_msgTypes,
+	}.Build()
+	File_yap_proto = out.File
+	file_yap_proto_rawDesc = nil
+	file_yap_proto_goTypes = nil
+	file_yap_proto_depIdxs = nil
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// YapClient is the client API for Yap service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type YapClient interface {
+	// Tag runs morphological analysis and disambiguation
+	Tag(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	// Parse runs the joint morpho-syntactic parser
+	Parse(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	// TagStream sends the result of every sentence as soon as it, and all
+	// sentences before it, are tagged
+	TagStream(ctx context.Context, in *Request, opts ...grpc.CallOption) (Yap_TagStreamClient, error)
+	// ParseStream sends the result of every sentence as soon as it, and all
+	// sentences before it, are parsed
+	ParseStream(ctx context.Context, in *Request, opts ...grpc.CallOption) (Yap_ParseStreamClient, error)
+}
+
+type yapClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewYapClient(cc grpc.ClientConnInterface) YapClient {
+	return &yapClient{cc}
+}
+
+func (c *yapClient) Tag(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/yap.Yap/Tag", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *yapClient) Parse(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/yap.Yap/Parse", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *yapClient) TagStream(ctx context.Context, in *Request, opts ...grpc.CallOption) (Yap_TagStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Yap_serviceDesc.Streams[0], "/yap.Yap/TagStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &yapTagStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Yap_TagStreamClient interface {
+	Recv() (*Result, error)
+	grpc.ClientStream
+}
+
+type yapTagStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *yapTagStreamClient) Recv() (*Result, error) {
+	m := new(Result)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *yapClient) ParseStream(ctx context.Context, in *Request, opts ...grpc.CallOption) (Yap_ParseStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Yap_serviceDesc.Streams[1], "/yap.Yap/ParseStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &yapParseStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Yap_ParseStreamClient interface {
+	Recv() (*Result, error)
+	grpc.ClientStream
+}
+
+type yapParseStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *yapParseStreamClient) Recv() (*Result, error) {
+	m := new(Result)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// YapServer is the server API for Yap service.
+type YapServer interface {
+	// Tag runs morphological analysis and disambiguation
+	Tag(context.Context, *Request) (*Response, error)
+	// Parse runs the joint morpho-syntactic parser
+	Parse(context.Context, *Request) (*Response, error)
+	// TagStream sends the result of every sentence as soon as it, and all
+	// sentences before it, are tagged
+	TagStream(*Request, Yap_TagStreamServer) error
+	// ParseStream sends the result of every sentence as soon as it, and all
+	// sentences before it, are parsed
+	ParseStream(*Request, Yap_ParseStreamServer) error
+}
+
+// UnimplementedYapServer can be embedded to have forward compatible implementations.
+type UnimplementedYapServer struct {
+}
+
+func (*UnimplementedYapServer) Tag(context.Context, *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Tag not implemented")
+}
+func (*UnimplementedYapServer) Parse(context.Context, *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Parse not implemented")
+}
+func (*UnimplementedYapServer) TagStream(*Request, Yap_TagStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method TagStream not implemented")
+}
+func (*UnimplementedYapServer) ParseStream(*Request, Yap_ParseStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ParseStream not implemented")
+}
+
+func RegisterYapServer(s *grpc.Server, srv YapServer) {
+	s.RegisterService(&_Yap_serviceDesc, srv)
+}
+
+func _Yap_Tag_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YapServer).Tag(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/yap.Yap/Tag",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YapServer).Tag(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Yap_Parse_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YapServer).Parse(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/yap.Yap/Parse",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YapServer).Parse(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Yap_TagStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Request)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(YapServer).TagStream(m, &yapTagStreamServer{stream})
+}
+
+type Yap_TagStreamServer interface {
+	Send(*Result) error
+	grpc.ServerStream
+}
+
+type yapTagStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *yapTagStreamServer) Send(m *Result) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Yap_ParseStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Request)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(YapServer).ParseStream(m, &yapParseStreamServer{stream})
+}
+
+type Yap_ParseStreamServer interface {
+	Send(*Result) error
+	grpc.ServerStream
+}
+
+type yapParseStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *yapParseStreamServer) Send(m *Result) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Yap_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "yap.Yap",
+	HandlerType: (*YapServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Tag",
+			Handler:    _Yap_Tag_Handler,
+		},
+		{
+			MethodName: "Parse",
+			Handler:    _Yap_Parse_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "TagStream",
+			Handler:       _Yap_TagStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ParseStream",
+			Handler:       _Yap_ParseStream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "yap.proto",
+}